@@ -0,0 +1,101 @@
+// address.go - WOTS and HORST instance addresses
+
+package sphincs256
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// AddressSize is the length of an encoded Address in bytes.
+const AddressSize = 8
+
+// Address identifies a WOTS or HORST instance of a key: the subtree of the
+// hypertree at a level, and the leaf within that subtree.  The instance
+// seeds are derived from the packed address, see PRF.
+type Address struct {
+	// Level is the hypertree layer, 0 for the bottom subtrees, or
+	// LayerHORST for HORST instances.
+	Level int
+
+	// Subtree is the index of the subtree within the layer.
+	Subtree uint64
+
+	// Leaf is the index of the leaf within the subtree.
+	Leaf int
+}
+
+// Pack returns the address packed as a 64 bit integer, with the level in
+// bits 0-3, the subtree in bits 4-58 and the leaf in bits 59-63.  Pack does
+// not check that the fields are in range, use Valid first.
+func (a Address) Pack() uint64 {
+	// 4 bits to encode level.
+	t := uint64(a.Level)
+	// 55 bits to encode subtree.
+	t |= a.Subtree << 4
+	// 5 bits to encode leaf.
+	t |= uint64(a.Leaf) << 59
+	return t
+}
+
+// UnpackAddress returns the address packed in t.
+func UnpackAddress(t uint64) Address {
+	return Address{
+		Level:   int(t & 0xf),
+		Subtree: (t >> 4) & (1<<55 - 1),
+		Leaf:    int(t >> 59),
+	}
+}
+
+// Valid returns true iff every field is in range for the level.
+func (a Address) Valid() bool {
+	if a.Level < 0 || a.Level > LayerHORST || a.Leaf < 0 || a.Leaf >= 1<<subtreeHeight {
+		return false
+	}
+	// The subtrees at layer i (and HORST, which shares the bottom layer's
+	// index) are numbered by the leaf index bits above the subtree.
+	level := a.Level
+	if level == LayerHORST {
+		level = 0
+	}
+	return a.Subtree>>uint(totalTreeHeight-(level+1)*subtreeHeight) == 0
+}
+
+// MarshalBinary encodes the packed address as a 64 bit little endian
+// integer, which is the encoding the standard PRF hashes.
+func (a Address) MarshalBinary() ([]byte, error) {
+	if !a.Valid() {
+		return nil, fmt.Errorf("sphincs256: invalid address %v", a)
+	}
+	return binary.LittleEndian.AppendUint64(nil, a.Pack()), nil
+}
+
+// UnmarshalBinary decodes an address encoded by MarshalBinary.
+func (a *Address) UnmarshalBinary(data []byte) error {
+	if len(data) != AddressSize {
+		return fmt.Errorf("sphincs256: invalid address length: %d", len(data))
+	}
+	b := UnpackAddress(binary.LittleEndian.Uint64(data))
+	if !b.Valid() {
+		return fmt.Errorf("sphincs256: invalid address %v", b)
+	}
+	*a = b
+	return nil
+}
+
+// String returns the address as "level/subtree/leaf", with the HORST level
+// written as "horst".
+func (a Address) String() string {
+	if a.Level == LayerHORST {
+		return fmt.Sprintf("horst/%d/%d", a.Subtree, a.Leaf)
+	}
+	return fmt.Sprintf("%d/%d/%d", a.Level, a.Subtree, a.Leaf)
+}
+
+// SignatureAddresses returns the addresses of the instances used by a
+// signature with leaf index leafidx: the HORST instance, and the WOTS
+// instance at each layer, bottom up.
+func SignatureAddresses(leafidx uint64) (horst Address, layers [LayerHORST]Address) {
+	horst = horstAddress(leafidx & (1<<totalTreeHeight - 1))
+	return horst, layerAddresses(horst)
+}
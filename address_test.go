@@ -0,0 +1,47 @@
+// address_test.go - Instance address tests
+
+package sphincs256
+
+import "testing"
+
+func TestAddress(t *testing.T) {
+	const leafidx = 0x0fedcba987654321
+
+	h, layers := SignatureAddresses(leafidx)
+	if h.Level != LayerHORST || h.Leaf != leafidx&31 || h.Subtree != leafidx>>5 {
+		t.Fatalf("SignatureAddresses() HORST address mismatch: %v", h)
+	}
+	if layers[0].Subtree != h.Subtree || layers[0].Leaf != h.Leaf {
+		t.Fatalf("SignatureAddresses() layer 0 address mismatch: %v", layers[0])
+	}
+	if top := layers[LayerHORST-1]; top.Subtree != 0 || top.Leaf != leafidx>>55 {
+		t.Fatalf("SignatureAddresses() top address mismatch: %v", top)
+	}
+
+	for _, a := range append(layers[:], h) {
+		if !a.Valid() {
+			t.Fatalf("address %v is not valid", a)
+		}
+		if UnpackAddress(a.Pack()) != a {
+			t.Fatalf("Pack() round trip failed for %v", a)
+		}
+		b, err := a.MarshalBinary()
+		if err != nil || len(b) != AddressSize {
+			t.Fatalf("MarshalBinary() failed: %v", err)
+		}
+		var c Address
+		if err = c.UnmarshalBinary(b); err != nil || c != a {
+			t.Fatalf("UnmarshalBinary() round trip failed for %v: %v", a, err)
+		}
+	}
+
+	for _, a := range []Address{
+		{Level: LayerHORST + 1},
+		{Level: 0, Leaf: 32},
+		{Level: LayerHORST - 1, Subtree: 1},
+	} {
+		if _, err := a.MarshalBinary(); err == nil {
+			t.Errorf("MarshalBinary() accepted invalid address %v", a)
+		}
+	}
+}
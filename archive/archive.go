@@ -0,0 +1,84 @@
+// archive.go - Long-term archive countersigning
+
+// Package archive implements "crypto refresh" of archived signed material:
+// an existing artifact and its signature (of any, possibly classical,
+// algorithm) are countersigned with SPHINCS-256, and the countersignature is
+// time-stamped, so that the archive stays verifiable after the original
+// algorithm is broken.
+//
+// The countersigned message is "sphincs256 archive countersignature v1\x00"
+// followed by SHA-512(artifact) and SHA-512(signature).  The time-stamp is
+// requested over SHA-256 of the SPHINCS-256 countersignature, so that it
+// proves the countersignature existed at the time-stamped time.
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+
+	"github.com/yawning/sphincs256"
+)
+
+// DigestSize is the length of the digest that is time-stamped in bytes.
+const DigestSize = sha256.Size
+
+const countersignLabel = "sphincs256 archive countersignature v1\x00"
+
+// Timestamper obtains time-stamp tokens over digests.
+type Timestamper interface {
+	Timestamp(ctx context.Context, digest *[DigestSize]byte) ([]byte, error)
+}
+
+// TokenVerifier checks that token is a valid time-stamp token over digest,
+// from a trusted time-stamping authority.  Validating RFC 3161 tokens
+// requires a CMS implementation, which this package does not provide.
+type TokenVerifier func(token []byte, digest *[DigestSize]byte) error
+
+// Countersignature is a time-stamped SPHINCS-256 countersignature of an
+// artifact and its original signature.
+type Countersignature struct {
+	Signature *[sphincs256.SignatureSize]byte
+	Token     []byte
+}
+
+func countersignedMessage(artifact, signature []byte) []byte {
+	a := sha512.Sum512(artifact)
+	s := sha512.Sum512(signature)
+
+	m := make([]byte, 0, len(countersignLabel)+len(a)+len(s))
+	m = append(m, countersignLabel...)
+	m = append(m, a[:]...)
+	return append(m, s[:]...)
+}
+
+// Countersign countersigns artifact and its original signature with
+// privateKey, and time-stamps the result with ts.
+func Countersign(ctx context.Context, privateKey *[sphincs256.PrivateKeySize]byte, artifact, signature []byte, ts Timestamper) (*Countersignature, error) {
+	cs := &Countersignature{
+		Signature: sphincs256.Sign(privateKey, countersignedMessage(artifact, signature)),
+	}
+
+	digest := sha256.Sum256(cs.Signature[:])
+	token, err := ts.Timestamp(ctx, &digest)
+	if err != nil {
+		return nil, fmt.Errorf("archive: failed to time-stamp countersignature: %w", err)
+	}
+	cs.Token = token
+	return cs, nil
+}
+
+// Verify returns nil iff cs is a valid countersignature by publicKey of
+// artifact and its original signature, with a time-stamp token accepted by
+// verifyToken.  The original signature itself is not checked.
+func (cs *Countersignature) Verify(publicKey *[sphincs256.PublicKeySize]byte, artifact, signature []byte, verifyToken TokenVerifier) error {
+	if err := sphincs256.VerifyWithOptions(publicKey, countersignedMessage(artifact, signature), cs.Signature, nil); err != nil {
+		return err
+	}
+	digest := sha256.Sum256(cs.Signature[:])
+	if err := verifyToken(cs.Token, &digest); err != nil {
+		return fmt.Errorf("archive: invalid time-stamp token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// archive_test.go - Archive countersigning tests
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yawning/sphincs256"
+)
+
+// fakeTSA answers time-stamp requests with an unsigned token, whose nonce is
+// the request nonce plus nonceDelta.
+func fakeTSA(t *testing.T, status int, nonceDelta int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req timeStampReq
+		if _, err := asn1.Unmarshal(body, &req); err != nil {
+			t.Errorf("malformed time-stamp request: %s", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if !req.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || req.Nonce == nil {
+			t.Errorf("unexpected time-stamp request: %+v", req)
+		}
+		info, _ := asn1.Marshal(tstInfo{
+			Version:        1,
+			Policy:         asn1.ObjectIdentifier{1, 2, 3},
+			MessageImprint: req.MessageImprint,
+			SerialNumber:   big.NewInt(42),
+			GenTime:        time.Now().UTC().Truncate(time.Second),
+			Nonce:          new(big.Int).Add(req.Nonce, big.NewInt(nonceDelta)),
+		})
+		sd, _ := asn1.Marshal(signedData{
+			Version:          3,
+			DigestAlgorithms: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+			EncapContentInfo: encapsulatedContentInfo{EContentType: oidTSTInfo, EContent: info},
+		})
+		token, _ := asn1.Marshal(contentInfo{
+			ContentType: oidSignedData,
+			Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+		})
+		resp, _ := asn1.Marshal(timeStampResp{
+			Status:         pkiStatusInfo{Status: status},
+			TimeStampToken: asn1.RawValue{FullBytes: token},
+		})
+		w.Header().Set("Content-Type", tsrContentType)
+		w.Write(resp)
+	}))
+}
+
+func verifyFakeToken(token []byte, digest *[DigestSize]byte) error {
+	info, err := parseTSTInfo(token)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(info.MessageImprint.HashedMessage, digest[:]) {
+		return errors.New("token does not match digest")
+	}
+	return nil
+}
+
+func TestCountersign(t *testing.T) {
+	pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	artifact := []byte("The Dunwich Horror")
+	oldSig := []byte("an RSA-1024 signature, presumably")
+
+	srv := fakeTSA(t, 0, 0)
+	defer srv.Close()
+
+	cs, err := Countersign(context.Background(), sk, artifact, oldSig, &RFC3161{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("failed Countersign(): %s", err)
+	}
+	if err = cs.Verify(pk, artifact, oldSig, verifyFakeToken); err != nil {
+		t.Errorf("failed Verify(): %s", err)
+	}
+	if err = cs.Verify(pk, artifact, oldSig[1:], verifyFakeToken); err == nil {
+		t.Errorf("Verify() accepted a different original signature")
+	}
+
+	rejecting := fakeTSA(t, 2, 0)
+	defer rejecting.Close()
+	if _, err = Countersign(context.Background(), sk, artifact, oldSig, &RFC3161{URL: rejecting.URL}); err == nil {
+		t.Errorf("Countersign() succeeded with a rejected time-stamp request")
+	}
+
+	replaying := fakeTSA(t, 0, 1)
+	defer replaying.Close()
+	if _, err = Countersign(context.Background(), sk, artifact, oldSig, &RFC3161{URL: replaying.URL}); err == nil {
+		t.Errorf("Countersign() accepted a token with a mismatched nonce")
+	}
+}
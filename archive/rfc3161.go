@@ -0,0 +1,201 @@
+// rfc3161.go - RFC 3161 time-stamp protocol client
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/yawning/sphincs256"
+)
+
+var (
+	oidSHA256     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+)
+
+const (
+	tsqContentType = "application/timestamp-query"
+	tsrContentType = "application/timestamp-reply"
+
+	maxResponseSize = 1 << 20
+)
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type messageImprint struct {
+	HashAlgorithm algorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString asn1.RawValue  `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// The time-stamp token is a CMS ContentInfo holding SignedData, which
+// encapsulates the DER encoded TSTInfo.  Only the fields up to the nonce are
+// decoded, as encoding/asn1 ignores trailing SEQUENCE elements.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo encapsulatedContentInfo
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Accuracy       accuracy  `asn1:"optional"`
+	Ordering       bool      `asn1:"optional"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+// parseTSTInfo extracts the TSTInfo from a time-stamp token.  The token's
+// signature is not checked.
+func parseTSTInfo(token []byte) (*tstInfo, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(token, &ci); err != nil {
+		return nil, fmt.Errorf("archive: malformed time-stamp token: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("archive: time-stamp token is not signed data")
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("archive: malformed time-stamp token: %w", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("archive: time-stamp token does not hold TSTInfo")
+	}
+	info := new(tstInfo)
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, info); err != nil {
+		return nil, fmt.Errorf("archive: malformed TSTInfo: %w", err)
+	}
+	return info, nil
+}
+
+// RFC3161 is a Timestamper that requests time-stamp tokens from an RFC 3161
+// time-stamping authority over HTTP.
+type RFC3161 struct {
+	// URL is the URL of the time-stamping authority.
+	URL string
+
+	// Client is the HTTP client used, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Timestamp implements Timestamper.  The token is checked to have been
+// granted, and to be over digest with the nonce of the request, so that a
+// replayed or substituted token is rejected.  Its signature is not checked,
+// which is left to the TokenVerifier.
+func (t *RFC3161) Timestamp(ctx context.Context, digest *[DigestSize]byte) ([]byte, error) {
+	nonce, err := rand.Int(sphincs256.DefaultSource(), new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	req, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: algorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest[:],
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", tsqContentType)
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	hresp, err := client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer hresp.Body.Close()
+	if hresp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("archive: time-stamping authority returned HTTP %d", hresp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(hresp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp timeStampResp
+	rest, err := asn1.Unmarshal(body, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("archive: malformed time-stamp response: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("archive: trailing data after time-stamp response")
+	}
+	// granted (0) or grantedWithMods (1).
+	if resp.Status.Status != 0 && resp.Status.Status != 1 {
+		return nil, fmt.Errorf("archive: time-stamp request rejected with status %d", resp.Status.Status)
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, fmt.Errorf("archive: time-stamp response has no token")
+	}
+
+	info, err := parseTSTInfo(resp.TimeStampToken.FullBytes)
+	if err != nil {
+		return nil, err
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("archive: time-stamp token nonce does not match the request")
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || !bytes.Equal(info.MessageImprint.HashedMessage, digest[:]) {
+		return nil, fmt.Errorf("archive: time-stamp token is not over the requested digest")
+	}
+	return resp.TimeStampToken.FullBytes, nil
+}
@@ -0,0 +1,34 @@
+// audit.go - Signature determinism auditing
+
+package sphincs256
+
+import (
+	"crypto/subtle"
+	"fmt"
+)
+
+// AuditSignature recomputes the signature that privateKey deterministically
+// produces for message, and compares it to signature in constant time.  It
+// returns nil iff they are identical.
+//
+// Verify does not bind every field of a signature to the private key: R and
+// the leaf index are free, and the HORST instance is never checked against
+// the private key's seeds, so a signer can choose or grind it (and with it
+// the HORST and WOTS parts) while the signature still verifies.  Since
+// signing is deterministic, an auditor holding the private key can rule out
+// covert data only by comparing the whole signature, which is what this
+// does.
+func AuditSignature(privateKey *[PrivateKeySize]byte, message []byte, signature *[SignatureSize]byte) error {
+	expected := Sign(privateKey, message)
+
+	if subtle.ConstantTimeCompare(expected[:messageHashSeedBytes], signature[:messageHashSeedBytes]) != 1 {
+		return fmt.Errorf("sphincs256: signature R does not match deterministic derivation")
+	}
+	if subtle.ConstantTimeCompare(expected[messageHashSeedBytes:randomnessSize], signature[messageHashSeedBytes:randomnessSize]) != 1 {
+		return fmt.Errorf("sphincs256: signature leaf index does not match deterministic derivation")
+	}
+	if subtle.ConstantTimeCompare(expected[randomnessSize:], signature[randomnessSize:]) != 1 {
+		return fmt.Errorf("sphincs256: signature does not match deterministic derivation")
+	}
+	return nil
+}
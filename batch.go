@@ -0,0 +1,115 @@
+// batch.go - Batch key generation
+
+package sphincs256
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/yawning/sphincs256/utils"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	batchKeyLabel  = "sphincs256 batch key v1"
+	deviceKeyLabel = "sphincs256 device key v1"
+)
+
+// GenerateKeys generates n public/private key pairs using randomness from
+// rand (the default Source if nil), and calls fn with each key pair in
+// order.  The entropy for each key is read from rand sequentially, but the
+// public keys are derived in parallel.  Generation stops at the first error
+// returned by fn, which is then returned.
+func GenerateKeys(n int, rand io.Reader, fn func(publicKey *[PublicKeySize]byte, privateKey *[PrivateKeySize]byte) error) error {
+	return generateKeys(n, func(i int, sk []byte) error {
+		_, err := io.ReadFull(randReader(rand), sk)
+		return err
+	}, fn)
+}
+
+// GenerateKeysFromSeed is like GenerateKeys, except that the i-th private
+// key is derived from masterSeed with HKDF-SHA512 (no salt, info set to
+// "sphincs256 batch key v1" followed by i as a 64 bit big endian integer).
+// Any key of the batch can be regenerated from masterSeed and its index.
+func GenerateKeysFromSeed(masterSeed []byte, n int, fn func(publicKey *[PublicKeySize]byte, privateKey *[PrivateKeySize]byte) error) error {
+	return generateKeys(n, func(i int, sk []byte) error {
+		var info [len(batchKeyLabel) + 8]byte
+		copy(info[:], batchKeyLabel)
+		binary.BigEndian.PutUint64(info[len(batchKeyLabel):], uint64(i))
+		return deriveKey(sk, masterSeed, string(info[:]))
+	}, fn)
+}
+
+// DeriveDeviceKey derives the key pair of the device identified by deviceID
+// from masterSeed, so that any device's key can be regenerated from the
+// master seed alone.
+//
+// Version 1 of the derivation (the only one) sets the private key to
+// HKDF-SHA512 keyed by masterSeed, with no salt and info set to
+// "sphincs256 device key v1" followed by deviceID.  Future versions will use
+// a different label, and existing derivations will never change.
+func DeriveDeviceKey(masterSeed, deviceID []byte) (publicKey *[PublicKeySize]byte, privateKey *[PrivateKeySize]byte, err error) {
+	if len(deviceID) == 0 {
+		return nil, nil, fmt.Errorf("sphincs256: empty device identifier")
+	}
+
+	privateKey = new([PrivateKeySize]byte)
+	publicKey = new([PublicKeySize]byte)
+	if err = deriveKey(privateKey[:], masterSeed, deviceKeyLabel+string(deviceID)); err != nil {
+		return nil, nil, err
+	}
+	derivePublicKey(publicKey[:], privateKey[:])
+	return
+}
+
+// deriveKey fills the private key sk with HKDF-SHA512 output keyed by secret.
+func deriveKey(sk, secret []byte, info string) error {
+	if len(secret) < seedBytes {
+		return fmt.Errorf("sphincs256: master seed must be at least %d bytes", seedBytes)
+	}
+	_, err := io.ReadFull(hkdf.New(sha512.New, secret, nil, []byte(info)), sk[:PrivateKeySize])
+	return err
+}
+
+func generateKeys(n int, entropy func(i int, sk []byte) error, fn func(publicKey *[PublicKeySize]byte, privateKey *[PrivateKeySize]byte) error) error {
+	w := workers()
+	pks := make([]*[PublicKeySize]byte, w)
+	sks := make([]*[PrivateKeySize]byte, w)
+
+	for base := 0; base < n; base += w {
+		batch := n - base
+		if batch > w {
+			batch = w
+		}
+
+		for j := 0; j < batch; j++ {
+			pks[j] = new([PublicKeySize]byte)
+			sks[j] = new([PrivateKeySize]byte)
+			if err := entropy(base+j, sks[j][:]); err != nil {
+				zeroKeys(sks[:j+1])
+				return err
+			}
+		}
+		// Already parallel across keys, so derive each key serially.
+		parallelFor(batch, func(j int) {
+			derivePublicKeyYield(pks[j][:], sks[j][:], nil)
+		})
+		for j := 0; j < batch; j++ {
+			if err := fn(pks[j], sks[j]); err != nil {
+				zeroKeys(sks[j+1 : batch])
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// zeroKeys zeroes the private keys in sks, which have not been handed to
+// the caller.
+func zeroKeys(sks []*[PrivateKeySize]byte) {
+	for _, sk := range sks {
+		utils.Zerobytes(sk[:])
+	}
+}
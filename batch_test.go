@@ -0,0 +1,123 @@
+// batch_test.go - Batch key generation tests
+
+package sphincs256
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// checkKeyVector compares the SHA-256 digests of a derived key pair with
+// fixed vectors.  The private key vectors were computed independently from
+// the documented HKDF-SHA512 derivations, which must never change.
+func checkKeyVector(t *testing.T, what string, pk *[PublicKeySize]byte, sk *[PrivateKeySize]byte, expectedSk, expectedPk string) {
+	t.Helper()
+	skDigest, pkDigest := sha256.Sum256(sk[:]), sha256.Sum256(pk[:])
+	if hex.EncodeToString(skDigest[:]) != expectedSk {
+		t.Errorf("%s: sk mismatch", what)
+	}
+	if hex.EncodeToString(pkDigest[:]) != expectedPk {
+		t.Errorf("%s: pk mismatch", what)
+	}
+}
+
+func TestGenerateKeys(t *testing.T) {
+	const n = 5
+
+	// Drawing the keys from the same stream must match GenerateKey().
+	entropy := make([]byte, n*PrivateKeySize)
+	for i := range entropy {
+		entropy[i] = byte(i * 7)
+	}
+	r := bytes.NewReader(entropy)
+
+	i := 0
+	err := GenerateKeys(n, bytes.NewReader(entropy), func(pk *[PublicKeySize]byte, sk *[PrivateKeySize]byte) error {
+		expectedPk, expectedSk, err := GenerateKey(r)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(pk[:], expectedPk[:]) || !bytes.Equal(sk[:], expectedSk[:]) {
+			t.Errorf("key pair %d mismatch", i)
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed GenerateKeys(): %s", err)
+	}
+	if i != n {
+		t.Fatalf("GenerateKeys() produced %d key pairs, expected %d", i, n)
+	}
+
+	if err = GenerateKeys(n, bytes.NewReader(entropy[:PrivateKeySize]), func(*[PublicKeySize]byte, *[PrivateKeySize]byte) error { return nil }); err == nil {
+		t.Errorf("GenerateKeys() succeeded with a short entropy source")
+	}
+}
+
+func TestGenerateKeysFromSeed(t *testing.T) {
+	seed := bytes.Repeat([]byte{0x42}, 32)
+
+	vectors := [][2]string{
+		{"44e4d003545c0cabc91fc20b8436efc66c0061d06c940fc755e9e766edaa6b15", "d388e9bb6b3434735232d0ac33288c87e45df358fc48996097fef3fa3ba62549"},
+		{"c7726af7a53e763639616f1a63937c468885b60773ede41b39e0a46bc9c9e1cb", "3babb162de9ca2b57460ff17babd3d1a0d0a3783151d541952827482cde85e66"},
+	}
+	var first, again [][]byte
+	collect := func(dst *[][]byte) func(*[PublicKeySize]byte, *[PrivateKeySize]byte) error {
+		return func(pk *[PublicKeySize]byte, sk *[PrivateKeySize]byte) error {
+			if i := len(*dst); i < len(vectors) {
+				checkKeyVector(t, "batch key", pk, sk, vectors[i][0], vectors[i][1])
+			}
+			*dst = append(*dst, pk[:])
+			return nil
+		}
+	}
+	if err := GenerateKeysFromSeed(seed, 3, collect(&first)); err != nil {
+		t.Fatalf("failed GenerateKeysFromSeed(): %s", err)
+	}
+	if err := GenerateKeysFromSeed(seed, 3, collect(&again)); err != nil {
+		t.Fatalf("failed GenerateKeysFromSeed(): %s", err)
+	}
+	for i := range first {
+		if !bytes.Equal(first[i], again[i]) {
+			t.Errorf("key pair %d is not deterministic", i)
+		}
+		if i > 0 && bytes.Equal(first[i], first[i-1]) {
+			t.Errorf("key pair %d is identical to its predecessor", i)
+		}
+	}
+
+	if err := GenerateKeysFromSeed(seed[:16], 1, collect(&first)); err == nil {
+		t.Errorf("GenerateKeysFromSeed() accepted a short master seed")
+	}
+}
+
+func TestDeriveDeviceKey(t *testing.T) {
+	seed := bytes.Repeat([]byte{0x42}, 32)
+
+	pk, sk, err := DeriveDeviceKey(seed, []byte("device-0001"))
+	if err != nil {
+		t.Fatalf("failed DeriveDeviceKey(): %s", err)
+	}
+	checkKeyVector(t, "device key", pk, sk, "de102cd75785d4a24ef4f04f2c32636d9edbb02727d02c5511a1d8cbdf028eba", "9c906d76c8178cdca9d6f689dc61ad43304a87d48f2254047456132a744b76d5")
+	pk2, sk2, err := DeriveDeviceKey(seed, []byte("device-0001"))
+	if err != nil {
+		t.Fatalf("failed DeriveDeviceKey(): %s", err)
+	}
+	if !bytes.Equal(pk[:], pk2[:]) || !bytes.Equal(sk[:], sk2[:]) {
+		t.Errorf("device key derivation is not deterministic")
+	}
+	pk3, _, err := DeriveDeviceKey(seed, []byte("device-0002"))
+	if err != nil {
+		t.Fatalf("failed DeriveDeviceKey(): %s", err)
+	}
+	if bytes.Equal(pk[:], pk3[:]) {
+		t.Errorf("distinct devices derived the same key")
+	}
+
+	if _, _, err = DeriveDeviceKey(seed, nil); err == nil {
+		t.Errorf("DeriveDeviceKey() accepted an empty device identifier")
+	}
+}
@@ -0,0 +1,277 @@
+// bundle.go - Offline verification bundles
+
+// Package bundle implements a single file format that carries everything an
+// air-gapped verifier needs to check a SPHINCS-256 signature: the signed
+// payload (or its digest), the signature, the signer's public key or its
+// fingerprint, and optionally a time-stamp token and a signed revocation
+// snapshot.
+//
+// A bundle is encoded as the label "sphincs256 bundle v1\x00" followed by
+// fields, each a 1 byte tag, a 4 byte big endian length and the value.
+// Every field appears at most once, in increasing tag order:
+//
+//	1 payload      the signed message
+//	2 digest       the sphincs256.ChunkedDigest of a detached message
+//	3 signature    the signature
+//	4 fingerprint  the Fingerprint of the signer's public key
+//	5 public key   the signer's public key
+//	6 timestamp    a time-stamp token over SHA-256 of the signature
+//	7 revocation   a revocation snapshot
+//
+// Exactly one of payload and digest, and the signature and fingerprint are
+// required.  Bundles with a digest carry a chunked signature, so that the
+// payload itself can be shipped separately.
+//
+// Bundles that embed the public key can be verified without any prior key
+// distribution, while fingerprint only bundles require the verifier to hold
+// the key.  Verifiers choose which they accept with a KeyPolicy.
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/archive"
+)
+
+// FingerprintSize is the length of a public key fingerprint in bytes.
+const FingerprintSize = sha256.Size
+
+const label = "sphincs256 bundle v1\x00"
+
+const (
+	tagPayload = iota + 1
+	tagDigest
+	tagSignature
+	tagFingerprint
+	tagPublicKey
+	tagTimestamp
+	tagRevocation
+)
+
+// ErrMalformed is the error returned when a bundle can not be decoded.
+var ErrMalformed = errors.New("bundle: malformed bundle")
+
+// Fingerprint returns the fingerprint of publicKey, its SHA-256 digest.
+func Fingerprint(publicKey *[sphincs256.PublicKeySize]byte) [FingerprintSize]byte {
+	return sha256.Sum256(publicKey[:])
+}
+
+// FingerprintHex returns the Fingerprint of publicKey in lowercase hex, the
+// form used by the text formats in this module.
+func FingerprintHex(publicKey *[sphincs256.PublicKeySize]byte) string {
+	fp := Fingerprint(publicKey)
+	return hex.EncodeToString(fp[:])
+}
+
+// Bundle is an offline verification bundle.
+type Bundle struct {
+	// Payload is the signed message, or nil for a detached bundle.
+	Payload []byte
+
+	// Digest is the sphincs256.ChunkedDigest of the message of a detached
+	// bundle, or nil.
+	Digest []byte
+
+	Signature   *[sphincs256.SignatureSize]byte
+	Fingerprint [FingerprintSize]byte
+
+	// PublicKey is the signer's public key, or nil if only the fingerprint
+	// is included.
+	PublicKey *[sphincs256.PublicKeySize]byte
+
+	// Timestamp is a time-stamp token over SHA-256 of the signature, or nil.
+	Timestamp []byte
+
+	// Revocation is a revocation snapshot, or nil.
+	Revocation *Revocation
+}
+
+// CreateOptions are the options for Create.
+type CreateOptions struct {
+	// Detached makes the bundle carry the chunked digest of the message
+	// rather than the message.
+	Detached bool
+
+	// ChunkSize is the chunk size of detached bundles, or 0 for
+	// sphincs256.DefaultChunkSize.
+	ChunkSize int
+
+	// EmbedPublicKey includes the public key, rather than only its
+	// fingerprint.
+	EmbedPublicKey bool
+
+	// Timestamper, if non-nil, is used to time-stamp the signature.
+	Timestamper archive.Timestamper
+
+	// Revocation, if non-nil, is included in the bundle.
+	Revocation *Revocation
+}
+
+// Create signs message with privateKey and returns the bundle.  A nil opts
+// is equivalent to the zero value.
+func Create(ctx context.Context, privateKey *[sphincs256.PrivateKeySize]byte, message []byte, opts *CreateOptions) (*Bundle, error) {
+	if opts == nil {
+		opts = new(CreateOptions)
+	}
+
+	b := &Bundle{Revocation: opts.Revocation}
+	pk := (*sphincs256.PrivateKey)(privateKey).Public().(*sphincs256.PublicKey)
+	b.Fingerprint = Fingerprint((*[sphincs256.PublicKeySize]byte)(pk))
+	if opts.EmbedPublicKey {
+		b.PublicKey = (*[sphincs256.PublicKeySize]byte)(pk)
+	}
+
+	if opts.Detached {
+		chunkSize := opts.ChunkSize
+		if chunkSize == 0 {
+			chunkSize = sphincs256.DefaultChunkSize
+		}
+		d, err := sphincs256.ChunkedDigest(bytes.NewReader(message), chunkSize)
+		if err != nil {
+			return nil, err
+		}
+		b.Digest = d[:]
+		b.Signature = sphincs256.SignChunkedDigest(privateKey, d)
+	} else {
+		b.Payload = append([]byte{}, message...)
+		b.Signature = sphincs256.Sign(privateKey, b.Payload)
+	}
+
+	if opts.Timestamper != nil {
+		digest := sha256.Sum256(b.Signature[:])
+		token, err := opts.Timestamper.Timestamp(ctx, &digest)
+		if err != nil {
+			return nil, fmt.Errorf("bundle: failed to time-stamp signature: %v", err)
+		}
+		b.Timestamp = token
+	}
+	return b, nil
+}
+
+// MarshalBinary encodes the bundle.
+func (b *Bundle) MarshalBinary() ([]byte, error) {
+	if (b.Payload == nil) == (b.Digest == nil) {
+		return nil, errors.New("bundle: exactly one of payload and digest must be set")
+	}
+	if b.Signature == nil {
+		return nil, errors.New("bundle: missing signature")
+	}
+
+	out := []byte(label)
+	put := func(tag byte, v []byte) {
+		out = append(out, tag)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(v)))
+		out = append(out, v...)
+	}
+	if b.Payload != nil {
+		put(tagPayload, b.Payload)
+	} else {
+		put(tagDigest, b.Digest)
+	}
+	put(tagSignature, b.Signature[:])
+	put(tagFingerprint, b.Fingerprint[:])
+	if b.PublicKey != nil {
+		put(tagPublicKey, b.PublicKey[:])
+	}
+	if b.Timestamp != nil {
+		put(tagTimestamp, b.Timestamp)
+	}
+	if b.Revocation != nil {
+		put(tagRevocation, b.Revocation.marshal())
+	}
+	return out, nil
+}
+
+// Parse decodes a bundle.  The bundle is not verified.
+func Parse(data []byte) (*Bundle, error) {
+	if !bytes.HasPrefix(data, []byte(label)) {
+		return nil, fmt.Errorf("%w: bad label", ErrMalformed)
+	}
+	data = data[len(label):]
+
+	b := new(Bundle)
+	var last byte
+	var sawFingerprint bool
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, fmt.Errorf("%w: truncated field", ErrMalformed)
+		}
+		tag, n := data[0], binary.BigEndian.Uint32(data[1:])
+		if uint64(n) > uint64(len(data)-5) {
+			return nil, fmt.Errorf("%w: truncated field", ErrMalformed)
+		}
+		v := append([]byte{}, data[5:5+n]...)
+		data = data[5+n:]
+
+		if tag <= last {
+			return nil, fmt.Errorf("%w: field %d out of order", ErrMalformed, tag)
+		}
+		last = tag
+
+		switch tag {
+		case tagPayload:
+			b.Payload = v
+		case tagDigest:
+			if len(v) != sphincs256.ChunkedDigestSize {
+				return nil, fmt.Errorf("%w: invalid digest length", ErrMalformed)
+			}
+			b.Digest = v
+		case tagSignature:
+			if len(v) != sphincs256.SignatureSize {
+				return nil, fmt.Errorf("%w: invalid signature length", ErrMalformed)
+			}
+			b.Signature = (*[sphincs256.SignatureSize]byte)(v)
+		case tagFingerprint:
+			if len(v) != FingerprintSize {
+				return nil, fmt.Errorf("%w: invalid fingerprint length", ErrMalformed)
+			}
+			b.Fingerprint, sawFingerprint = [FingerprintSize]byte(v), true
+		case tagPublicKey:
+			if len(v) != sphincs256.PublicKeySize {
+				return nil, fmt.Errorf("%w: invalid public key length", ErrMalformed)
+			}
+			b.PublicKey = (*[sphincs256.PublicKeySize]byte)(v)
+		case tagTimestamp:
+			b.Timestamp = v
+		case tagRevocation:
+			r, err := parseRevocation(v)
+			if err != nil {
+				return nil, err
+			}
+			b.Revocation = r
+		default:
+			return nil, fmt.Errorf("%w: unknown field %d", ErrMalformed, tag)
+		}
+	}
+
+	switch {
+	case (b.Payload == nil) == (b.Digest == nil):
+		return nil, fmt.Errorf("%w: exactly one of payload and digest is required", ErrMalformed)
+	case b.Signature == nil:
+		return nil, fmt.Errorf("%w: missing signature", ErrMalformed)
+	case !sawFingerprint:
+		return nil, fmt.Errorf("%w: missing fingerprint", ErrMalformed)
+	}
+	return b, nil
+}
+
+// ReadFrom is a convenience wrapper that reads and parses a bundle of at
+// most maxSize bytes from r.
+func ReadFrom(r io.Reader, maxSize int64) (*Bundle, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("bundle: bundle exceeds %d bytes", maxSize)
+	}
+	return Parse(data)
+}
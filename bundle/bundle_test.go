@@ -0,0 +1,179 @@
+// bundle_test.go - Offline verification bundle tests
+
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yawning/sphincs256"
+)
+
+type fakeTimestamper struct{}
+
+func (fakeTimestamper) Timestamp(ctx context.Context, digest *[sha256.Size]byte) ([]byte, error) {
+	return append([]byte("token:"), digest[:]...), nil
+}
+
+func verifyFakeToken(token []byte, digest *[sha256.Size]byte) error {
+	if !bytes.Equal(token, append([]byte("token:"), digest[:]...)) {
+		return errors.New("bad token")
+	}
+	return nil
+}
+
+func roundTrip(t *testing.T, b *Bundle) *Bundle {
+	data, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+	b, err = Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	return b
+}
+
+func TestBundle(t *testing.T) {
+	pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	apk, ask, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	now := time.Now()
+	fp := Fingerprint(pk)
+	rev := NewRevocation(ask, now, [][FingerprintSize]byte{Fingerprint(apk)})
+
+	msg := []byte("firmware image")
+	b, err := Create(context.Background(), sk, msg, &CreateOptions{
+		EmbedPublicKey: true,
+		Timestamper:    fakeTimestamper{},
+		Revocation:     rev,
+	})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	b = roundTrip(t, b)
+
+	opts := &VerifyOptions{
+		Keys:                []*[sphincs256.PublicKeySize]byte{pk},
+		RevocationAuthority: apk,
+		RequireRevocation:   true,
+		MaxRevocationAge:    time.Hour,
+		TokenVerifier:       verifyFakeToken,
+		RequireTimestamp:    true,
+	}
+	if err := b.Verify(nil, opts); err != nil {
+		t.Fatalf("Verify() failed: %v", err)
+	}
+
+	if err := b.Verify(nil, &VerifyOptions{Keys: []*[sphincs256.PublicKeySize]byte{apk}}); !errors.Is(err, ErrUntrustedKey) {
+		t.Errorf("Verify() with an untrusted key: got %v", err)
+	}
+	if err := b.Verify(nil, &VerifyOptions{KeyPolicy: AcceptEmbedded}); err != nil {
+		t.Errorf("Verify() with an embedded key and AcceptEmbedded failed: %v", err)
+	}
+	if err := b.Verify(nil, &VerifyOptions{Keys: opts.Keys, KeyPolicy: RejectEmbedded}); !errors.Is(err, ErrEmbeddedKey) {
+		t.Errorf("Verify() with an embedded key and RejectEmbedded: got %v", err)
+	}
+	forged := *b
+	forged.PublicKey = apk
+	forged.Fingerprint = Fingerprint(apk)
+	if err := forged.Verify(nil, &VerifyOptions{KeyPolicy: AcceptEmbedded}); !errors.Is(err, sphincs256.ErrVerifyFailed) {
+		t.Errorf("Verify() with a substituted embedded key: got %v", err)
+	}
+	stale := *opts
+	stale.Now = func() time.Time { return now.Add(2 * time.Hour) }
+	if err := b.Verify(nil, &stale); err == nil {
+		t.Errorf("Verify() accepted a stale revocation snapshot")
+	}
+
+	noAge := *opts
+	noAge.MaxRevocationAge = 0
+	if err := b.Verify(nil, &noAge); err == nil {
+		t.Errorf("Verify() accepted a RevocationAuthority without MaxRevocationAge")
+	}
+	implied := *opts
+	implied.RequireRevocation = false
+	omitted := *b
+	omitted.Revocation = nil
+	if err := omitted.Verify(nil, &implied); err == nil {
+		t.Errorf("Verify() accepted a bundle without a revocation snapshot")
+	}
+
+	// Revoke the signing key.
+	revoked := NewRevocation(ask, now, [][FingerprintSize]byte{fp})
+	fresh := *opts
+	fresh.Revocation = revoked
+	if err := b.Verify(nil, &fresh); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Verify() with a revoked key in the verifier's snapshot: got %v", err)
+	}
+	b.Revocation = revoked
+	if err := b.Verify(nil, opts); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Verify() with a revoked key: got %v", err)
+	}
+	b.Revocation.Revoked = nil
+	if err := b.Verify(nil, opts); err == nil {
+		t.Errorf("Verify() accepted a tampered revocation snapshot")
+	}
+
+	b.Payload[0] ^= 1
+	if err := b.Verify(nil, &VerifyOptions{Keys: opts.Keys}); !errors.Is(err, sphincs256.ErrVerifyFailed) {
+		t.Errorf("Verify() with a modified payload: got %v", err)
+	}
+}
+
+func TestDetached(t *testing.T) {
+	pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+
+	payload := bytes.Repeat([]byte{0xa5}, 10000)
+	b, err := Create(context.Background(), sk, payload, &CreateOptions{Detached: true, ChunkSize: 1024})
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	b = roundTrip(t, b)
+	if b.Payload != nil || b.PublicKey != nil {
+		t.Fatalf("detached fingerprint-only bundle carries payload or key")
+	}
+
+	opts := &VerifyOptions{Keys: []*[sphincs256.PublicKeySize]byte{pk}}
+	if err := b.Verify(bytes.NewReader(payload), opts); err != nil {
+		t.Fatalf("Verify() failed: %v", err)
+	}
+	if err := b.Verify(nil, opts); err == nil {
+		t.Errorf("Verify() accepted a detached bundle without the payload")
+	}
+	if err := b.Verify(bytes.NewReader(payload), &VerifyOptions{KeyPolicy: AcceptEmbedded}); !errors.Is(err, ErrUntrustedKey) {
+		t.Errorf("Verify() of a fingerprint only bundle without the key: got %v", err)
+	}
+	payload[0] ^= 1
+	if err := b.Verify(bytes.NewReader(payload), opts); !errors.Is(err, ErrPayloadMismatch) {
+		t.Errorf("Verify() with a modified payload: got %v", err)
+	}
+
+	data, _ := b.MarshalBinary()
+	if _, err := Parse(data[:len(data)-1]); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Parse() accepted a truncated bundle: %v", err)
+	}
+
+	// A digest claiming a huge chunk size is rejected before hashing.
+	off := sphincs256.ChunkedDigestSize - sha256.Size - 16
+	for _, chunkSize := range []uint64{sphincs256.MaxChunkSize + 1, 1 << 30, 1 << 62} {
+		binary.BigEndian.PutUint64(b.Digest[off:], chunkSize)
+		if err := b.Verify(bytes.NewReader(payload), opts); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Verify() with chunk size %d: got %v", chunkSize, err)
+		}
+	}
+}
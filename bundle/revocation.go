@@ -0,0 +1,103 @@
+// revocation.go - Revocation snapshots
+
+package bundle
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/yawning/sphincs256"
+)
+
+const revocationLabel = "sphincs256 revocation v1\x00"
+
+// Revocation is a snapshot of the revoked signing keys, signed by a
+// revocation authority.
+type Revocation struct {
+	// Issued is the time the snapshot was issued, with one second
+	// resolution.
+	Issued time.Time
+
+	// Revoked are the fingerprints of the revoked keys.
+	Revoked [][FingerprintSize]byte
+
+	Signature *[sphincs256.SignatureSize]byte
+}
+
+// NewRevocation returns a revocation snapshot of revoked, issued at issued
+// and signed with the revocation authority's privateKey.
+func NewRevocation(privateKey *[sphincs256.PrivateKeySize]byte, issued time.Time, revoked [][FingerprintSize]byte) *Revocation {
+	r := &Revocation{
+		Issued:  time.Unix(issued.Unix(), 0),
+		Revoked: append([][FingerprintSize]byte{}, revoked...),
+	}
+	r.Signature = sphincs256.Sign(privateKey, r.signedMessage())
+	return r
+}
+
+// Verify returns nil if the snapshot is signed by the revocation authority
+// with publicKey.
+func (r *Revocation) Verify(publicKey *[sphincs256.PublicKeySize]byte) error {
+	if r.Signature == nil {
+		return fmt.Errorf("bundle: revocation snapshot is not signed")
+	}
+	if err := sphincs256.VerifyWithOptions(publicKey, r.signedMessage(), r.Signature, nil); err != nil {
+		return fmt.Errorf("bundle: invalid revocation snapshot signature: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked returns true iff fingerprint is in the snapshot.
+func (r *Revocation) IsRevoked(fingerprint *[FingerprintSize]byte) bool {
+	for i := range r.Revoked {
+		if r.Revoked[i] == *fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// signedMessage returns the label followed by the snapshot contents.
+func (r *Revocation) signedMessage() []byte {
+	m := []byte(revocationLabel)
+	return append(m, r.contents()...)
+}
+
+// contents encodes the issue time as 64 bit big endian Unix seconds, and
+// the revoked fingerprints prefixed by their 32 bit big endian count.
+func (r *Revocation) contents() []byte {
+	b := make([]byte, 0, 12+len(r.Revoked)*FingerprintSize)
+	b = binary.BigEndian.AppendUint64(b, uint64(r.Issued.Unix()))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(r.Revoked)))
+	for i := range r.Revoked {
+		b = append(b, r.Revoked[i][:]...)
+	}
+	return b
+}
+
+func (r *Revocation) marshal() []byte {
+	b := r.contents()
+	if r.Signature != nil {
+		b = append(b, r.Signature[:]...)
+	}
+	return b
+}
+
+func parseRevocation(b []byte) (*Revocation, error) {
+	if len(b) < 12 {
+		return nil, fmt.Errorf("%w: truncated revocation snapshot", ErrMalformed)
+	}
+	r := &Revocation{Issued: time.Unix(int64(binary.BigEndian.Uint64(b)), 0)}
+	n := uint64(binary.BigEndian.Uint32(b[8:]))
+	b = b[12:]
+	if uint64(len(b)) != n*FingerprintSize+sphincs256.SignatureSize {
+		return nil, fmt.Errorf("%w: invalid revocation snapshot length", ErrMalformed)
+	}
+	r.Revoked = make([][FingerprintSize]byte, n)
+	for i := range r.Revoked {
+		copy(r.Revoked[i][:], b[i*FingerprintSize:])
+	}
+	r.Signature = (*[sphincs256.SignatureSize]byte)(b[n*FingerprintSize:])
+	return r, nil
+}
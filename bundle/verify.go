@@ -0,0 +1,224 @@
+// verify.go - Offline verification bundle verification
+
+package bundle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/archive"
+)
+
+var (
+	// ErrUntrustedKey is the error returned when the bundle's signing key is
+	// not one of the trusted keys.
+	ErrUntrustedKey = errors.New("bundle: signing key is not trusted")
+
+	// ErrRevoked is the error returned when the bundle's signing key is
+	// revoked.
+	ErrRevoked = errors.New("bundle: signing key is revoked")
+
+	// ErrPayloadMismatch is the error returned when a detached payload does
+	// not match the bundle's digest.
+	ErrPayloadMismatch = errors.New("bundle: payload does not match digest")
+
+	// ErrEmbeddedKey is the error returned when a bundle embeds its public
+	// key, and the policy is RejectEmbedded.
+	ErrEmbeddedKey = errors.New("bundle: embedded public keys are not accepted")
+)
+
+// KeyPolicy controls how public keys embedded in bundles are treated.
+type KeyPolicy int
+
+const (
+	// KeyringOnly requires the signing key to be one of the trusted keys.
+	// An embedded key is only checked against the bundle's fingerprint.
+	// This is the default.
+	KeyringOnly KeyPolicy = iota
+
+	// RejectEmbedded is KeyringOnly, and additionally rejects bundles that
+	// embed a key.  It suits closed distribution, where keys are only ever
+	// provisioned out of band and an embedded key indicates a mistake or an
+	// attempt to confuse the verifier.
+	RejectEmbedded
+
+	// AcceptEmbedded uses the embedded key if the fingerprint is not one of
+	// the trusted keys.  It suits open distribution, where bundles are self
+	// contained, and only proves that the payload was signed by the key
+	// with the bundle's fingerprint.  Callers must decide whether to trust
+	// that fingerprint, for instance by pinning it on first use.
+	AcceptEmbedded
+)
+
+// VerifyOptions are the options for Bundle.Verify.
+type VerifyOptions struct {
+	// Keys are the trusted signing keys.  The bundle's key is looked up by
+	// fingerprint.
+	Keys []*[sphincs256.PublicKeySize]byte
+
+	// KeyPolicy controls how embedded public keys are treated.
+	KeyPolicy KeyPolicy
+
+	// RevocationAuthority is the public key that revocation snapshots must
+	// be signed with.  If nil, any snapshot in the bundle is ignored.  If
+	// set, a snapshot is required, and MaxRevocationAge must be non-zero.
+	RevocationAuthority *[sphincs256.PublicKeySize]byte
+
+	// Revocation is a revocation snapshot obtained by the verifier, and
+	// takes precedence over the one in the bundle.
+	//
+	// The bundle is assembled by the signer, so a revoked key's holder can
+	// embed a snapshot that was issued before the revocation.  Only
+	// MaxRevocationAge limits such a replay, and a snapshot fetched from
+	// the revocation authority by the verifier avoids it.
+	Revocation *Revocation
+
+	// RequireRevocation rejects bundles without a revocation snapshot.  It
+	// is implied by RevocationAuthority.
+	RequireRevocation bool
+
+	// MaxRevocationAge rejects revocation snapshots issued longer than this
+	// ago.  It bounds how long a snapshot from before a revocation can be
+	// replayed, and is required if RevocationAuthority is set.
+	MaxRevocationAge time.Duration
+
+	// TokenVerifier checks the time-stamp token.  If nil, any token in the
+	// bundle is ignored.
+	TokenVerifier archive.TokenVerifier
+
+	// RequireTimestamp rejects bundles without a time-stamp token.
+	RequireTimestamp bool
+
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// Verify returns nil if the bundle's signature is valid and made by a
+// trusted key, and the optional parts of the bundle satisfy opts.  For
+// detached bundles, the message is read from payload and must match the
+// digest.  payload is ignored for other bundles.
+func (b *Bundle) Verify(payload io.Reader, opts *VerifyOptions) error {
+	if opts == nil {
+		opts = new(VerifyOptions)
+	}
+	if b.Signature == nil {
+		return fmt.Errorf("%w: missing signature", ErrMalformed)
+	}
+
+	pk, err := b.signingKey(opts)
+	if err != nil {
+		return err
+	}
+	if err = b.verifyRevocation(opts); err != nil {
+		return err
+	}
+	if err = b.verifyTimestamp(opts); err != nil {
+		return err
+	}
+
+	if b.Digest != nil {
+		if payload == nil {
+			return errors.New("bundle: detached bundle requires the payload")
+		}
+		if len(b.Digest) != sphincs256.ChunkedDigestSize {
+			return fmt.Errorf("%w: invalid digest length", ErrMalformed)
+		}
+		// The chunk size precedes the message length and tree root, and
+		// bounds the memory used to hash the payload.
+		off := sphincs256.ChunkedDigestSize - sha256.Size - 16
+		chunkSize := binary.BigEndian.Uint64(b.Digest[off:])
+		if chunkSize == 0 || chunkSize > sphincs256.MaxChunkSize {
+			return fmt.Errorf("%w: invalid chunk size", ErrMalformed)
+		}
+		d, err := sphincs256.ChunkedDigest(payload, int(chunkSize))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(d[:], b.Digest) {
+			return ErrPayloadMismatch
+		}
+		return sphincs256.VerifyChunkedDigest(pk, d, b.Signature, nil)
+	}
+	return sphincs256.VerifyWithOptions(pk, b.Payload, b.Signature, nil)
+}
+
+// signingKey returns the key matching the bundle's fingerprint, as allowed
+// by the key policy.
+func (b *Bundle) signingKey(opts *VerifyOptions) (*[sphincs256.PublicKeySize]byte, error) {
+	if b.PublicKey != nil {
+		if opts.KeyPolicy == RejectEmbedded {
+			return nil, ErrEmbeddedKey
+		}
+		fp := Fingerprint(b.PublicKey)
+		if subtle.ConstantTimeCompare(fp[:], b.Fingerprint[:]) != 1 {
+			return nil, fmt.Errorf("%w: public key does not match fingerprint", ErrMalformed)
+		}
+	}
+	for _, k := range opts.Keys {
+		if Fingerprint(k) == b.Fingerprint {
+			return k, nil
+		}
+	}
+	if b.PublicKey != nil && opts.KeyPolicy == AcceptEmbedded {
+		return b.PublicKey, nil
+	}
+	return nil, ErrUntrustedKey
+}
+
+// verifyRevocation checks the signing key against the verifier's revocation
+// snapshot, or failing that, the bundle's.
+func (b *Bundle) verifyRevocation(opts *VerifyOptions) error {
+	if opts.RevocationAuthority == nil {
+		if opts.RequireRevocation {
+			return errors.New("bundle: no verifiable revocation snapshot")
+		}
+		return nil
+	}
+	if opts.MaxRevocationAge <= 0 {
+		return errors.New("bundle: RevocationAuthority requires MaxRevocationAge")
+	}
+
+	r := opts.Revocation
+	if r == nil {
+		r = b.Revocation
+	}
+	if r == nil {
+		return errors.New("bundle: no verifiable revocation snapshot")
+	}
+	if err := r.Verify(opts.RevocationAuthority); err != nil {
+		return err
+	}
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+	if now().Sub(r.Issued) > opts.MaxRevocationAge {
+		return fmt.Errorf("bundle: revocation snapshot issued %v is too old", r.Issued)
+	}
+	if r.IsRevoked(&b.Fingerprint) {
+		return ErrRevoked
+	}
+	return nil
+}
+
+func (b *Bundle) verifyTimestamp(opts *VerifyOptions) error {
+	if b.Timestamp == nil || opts.TokenVerifier == nil {
+		if opts.RequireTimestamp {
+			return errors.New("bundle: no verifiable time-stamp token")
+		}
+		return nil
+	}
+
+	digest := sha256.Sum256(b.Signature[:])
+	if err := opts.TokenVerifier(b.Timestamp, &digest); err != nil {
+		return fmt.Errorf("bundle: invalid time-stamp token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+// canonical.go - Canonical signature encoding
+
+package sphincs256
+
+import (
+	"fmt"
+)
+
+// CanonicalizeSignature parses an encoded signature and returns it
+// re-serialized, rejecting any encoding that is not canonical.
+//
+// Verify ignores the 4 most significant bits of the 64 bit leaf index, so
+// flipping them yields distinct signatures that all verify.  Systems that
+// address or deduplicate signatures by their hash should only accept
+// signatures that pass through this function.
+func CanonicalizeSignature(signature []byte) (*[SignatureSize]byte, error) {
+	if len(signature) != SignatureSize {
+		return nil, fmt.Errorf("sphincs256: invalid signature length: %d", len(signature))
+	}
+
+	// The leaf index has totalTreeHeight significant bits.
+	if signature[randomnessSize-1]>>(totalTreeHeight%8) != 0 {
+		return nil, fmt.Errorf("sphincs256: non-canonical signature leaf index")
+	}
+
+	var sig [SignatureSize]byte
+	copy(sig[:], signature)
+	return &sig, nil
+}
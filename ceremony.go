@@ -0,0 +1,160 @@
+// ceremony.go - Multi-party key generation ceremonies
+
+package sphincs256
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/yawning/sphincs256/utils"
+)
+
+const (
+	// CommitmentSize is the length of an entropy share commitment in bytes.
+	CommitmentSize = sha256.Size
+
+	// MinShareSize is the minimum length of an entropy share in bytes.
+	MinShareSize = 32
+
+	ceremonyCommitLabel = "sphincs256 ceremony commit v1"
+	ceremonyKeyLabel    = "sphincs256 ceremony key v1"
+)
+
+// CommitShare returns the commitment to an entropy share, which is
+// SHA-256("sphincs256 ceremony commit v1" || share).
+func CommitShare(share []byte) [CommitmentSize]byte {
+	h := sha256.New()
+	h.Write([]byte(ceremonyCommitLabel))
+	h.Write(share)
+
+	var c [CommitmentSize]byte
+	copy(c[:], h.Sum(nil))
+	return c
+}
+
+// Transcript is the record of a key generation ceremony where multiple
+// participants contribute entropy shares to a key pair.  As long as at least
+// one participant's share is secret and uniformly random, so is the key.
+//
+// The ceremony runs in two phases.  First every participant publishes the
+// commitment to their share.  Once all commitments are recorded, the shares
+// are revealed and checked against the commitments, so that no participant
+// can choose their share after seeing the others.
+//
+// The commitments may be published, however the shares determine the private
+// key, and a transcript that includes them must be protected as such.
+type Transcript struct {
+	Commitments [][CommitmentSize]byte
+	Shares      [][]byte
+}
+
+// Commit records a participant's commitment, and returns the participant's
+// index.  Commitments may not be added once the reveal phase has started.
+func (t *Transcript) Commit(commitment [CommitmentSize]byte) (int, error) {
+	if t.revealing() {
+		return 0, fmt.Errorf("sphincs256: ceremony is in the reveal phase")
+	}
+	t.Commitments = append(t.Commitments, commitment)
+	return len(t.Commitments) - 1, nil
+}
+
+// Reveal records the share of participant i after checking it against the
+// participant's commitment.  The first call to Reveal ends the commit phase.
+func (t *Transcript) Reveal(i int, share []byte) error {
+	if i < 0 || i >= len(t.Commitments) {
+		return fmt.Errorf("sphincs256: invalid ceremony participant: %d", i)
+	}
+	if len(share) < MinShareSize {
+		return fmt.Errorf("sphincs256: entropy share must be at least %d bytes", MinShareSize)
+	}
+	c := CommitShare(share)
+	if subtle.ConstantTimeCompare(c[:], t.Commitments[i][:]) != 1 {
+		return fmt.Errorf("sphincs256: entropy share does not match commitment %d", i)
+	}
+
+	if !t.revealing() {
+		t.Shares = make([][]byte, len(t.Commitments))
+	}
+	if t.Shares[i] != nil {
+		return fmt.Errorf("sphincs256: entropy share %d already revealed", i)
+	}
+	t.Shares[i] = append([]byte{}, share...)
+	return nil
+}
+
+// GenerateKey combines the revealed shares into a key pair.  All shares must
+// have been revealed.
+//
+// The shares are combined as HKDF-SHA512 (no salt, info set to "sphincs256
+// ceremony key v1") keyed by SHA-512("sphincs256 ceremony key v1" || n ||
+// commitment_0 || len(share_0) || share_0 || ...), where n and the lengths
+// are 64 bit big endian integers.
+func (t *Transcript) GenerateKey() (publicKey *[PublicKeySize]byte, privateKey *[PrivateKeySize]byte, err error) {
+	if err = t.check(); err != nil {
+		return nil, nil, err
+	}
+
+	var tmp [8]byte
+	h := sha512.New()
+	h.Write([]byte(ceremonyKeyLabel))
+	binary.BigEndian.PutUint64(tmp[:], uint64(len(t.Commitments)))
+	h.Write(tmp[:])
+	for i := range t.Commitments {
+		h.Write(t.Commitments[i][:])
+		binary.BigEndian.PutUint64(tmp[:], uint64(len(t.Shares[i])))
+		h.Write(tmp[:])
+		h.Write(t.Shares[i])
+	}
+	secret := h.Sum(nil)
+	defer utils.Zerobytes(secret)
+
+	privateKey = new([PrivateKeySize]byte)
+	publicKey = new([PublicKeySize]byte)
+	if err = deriveKey(privateKey[:], secret, ceremonyKeyLabel); err != nil {
+		return nil, nil, err
+	}
+	derivePublicKey(publicKey[:], privateKey[:])
+	return
+}
+
+// Audit independently re-checks a complete transcript, and returns nil iff
+// every share matches its commitment and the shares combine to publicKey.
+func (t *Transcript) Audit(publicKey *[PublicKeySize]byte) error {
+	for i, share := range t.Shares {
+		c := CommitShare(share)
+		if i >= len(t.Commitments) || subtle.ConstantTimeCompare(c[:], t.Commitments[i][:]) != 1 {
+			return fmt.Errorf("sphincs256: entropy share does not match commitment %d", i)
+		}
+	}
+	pk, sk, err := t.GenerateKey()
+	if err != nil {
+		return err
+	}
+	utils.Zerobytes(sk[:])
+	if subtle.ConstantTimeCompare(pk[:], publicKey[:]) != 1 {
+		return fmt.Errorf("sphincs256: ceremony transcript does not match public key")
+	}
+	return nil
+}
+
+func (t *Transcript) revealing() bool {
+	return t.Shares != nil
+}
+
+func (t *Transcript) check() error {
+	if len(t.Commitments) == 0 {
+		return fmt.Errorf("sphincs256: ceremony has no participants")
+	}
+	if len(t.Shares) != len(t.Commitments) {
+		return fmt.Errorf("sphincs256: ceremony is incomplete")
+	}
+	for i, share := range t.Shares {
+		if share == nil {
+			return fmt.Errorf("sphincs256: entropy share %d not revealed", i)
+		}
+	}
+	return nil
+}
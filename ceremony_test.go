@@ -0,0 +1,55 @@
+// ceremony_test.go - Multi-party key generation ceremony tests
+
+package sphincs256
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCeremony(t *testing.T) {
+	shares := [][]byte{
+		bytes.Repeat([]byte{0x01}, MinShareSize),
+		bytes.Repeat([]byte{0x02}, MinShareSize+1),
+		bytes.Repeat([]byte{0x03}, MinShareSize),
+	}
+
+	var tr Transcript
+	for i, share := range shares {
+		idx, err := tr.Commit(CommitShare(share))
+		if err != nil || idx != i {
+			t.Fatalf("failed Commit(): %d, %v", idx, err)
+		}
+	}
+	if _, _, err := tr.GenerateKey(); err == nil {
+		t.Fatalf("GenerateKey() succeeded before the reveal phase")
+	}
+	if err := tr.Reveal(0, shares[1]); err == nil {
+		t.Fatalf("Reveal() accepted a share not matching the commitment")
+	}
+	for i, share := range shares {
+		if err := tr.Reveal(i, share); err != nil {
+			t.Fatalf("failed Reveal(): %s", err)
+		}
+	}
+	if _, err := tr.Commit(CommitShare(shares[0])); err == nil {
+		t.Fatalf("Commit() succeeded during the reveal phase")
+	}
+
+	pk, sk, err := tr.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	checkKeyVector(t, "ceremony key", pk, sk, "eea76f29115a235d808288182b1944a24599098f3a382ca0999b449e1b75b8b9", "2fed2b1f5a7899d9a05f8b0b82b26721412c98fa8a21a6601bf44d6998f0488f")
+	if err = tr.Audit(pk); err != nil {
+		t.Errorf("failed Audit(): %s", err)
+	}
+	if !Verify(pk, shares[0], Sign(sk, shares[0])) {
+		t.Errorf("failed Verify()")
+	}
+
+	tr.Shares[2][0] ^= 0xff
+	if err = tr.Audit(pk); err == nil {
+		t.Errorf("Audit() accepted a tampered transcript")
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"encoding/binary"
 )
 
+// Implementation is the name of the Permute implementation in use.
+const Implementation = "portable"
+
 // Permute is the modified permutation variant of the salsa20_wordtobyte()
 // routine, used by SPHINCS-256's hashing.
 func Permute(buf *[64]byte) {
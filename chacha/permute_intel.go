@@ -6,6 +6,9 @@ import (
 	"unsafe"
 )
 
+// Implementation is the name of the Permute implementation in use.
+const Implementation = "unsafe-le"
+
 func Permute(x *[64]byte) {
 	// Yes, this uses unsafe to bypass the type system.  It's ok since x will
 	// always be valid, and this lets us pass x directly into the round
@@ -0,0 +1,212 @@
+// chunked.go - Chunked parallel message hashing
+
+package sphincs256
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	gohash "hash"
+	"io"
+
+	"github.com/dchest/blake512"
+	"github.com/yawning/sphincs256/hash"
+	"github.com/yawning/sphincs256/utils"
+)
+
+const (
+	// DefaultChunkSize is the default chunk size for chunked signing.
+	DefaultChunkSize = 1 << 20
+
+	// MaxChunkSize is the largest chunk size accepted for chunked signing
+	// and verification.  It bounds the memory used when the chunk size comes
+	// from an untrusted source.
+	MaxChunkSize = 1 << 24
+
+	// ChunkedDigestSize is the length of a chunked message digest in bytes.
+	ChunkedDigestSize = len(chunkedLabel) + 8 + 8 + sha256.Size
+
+	chunkedLabel = "sphincs256 chunked v1\x00"
+
+	// chunkedBatchSize is the most ChunkedDigest reads at a time, whatever
+	// the number of workers.
+	chunkedBatchSize = MaxChunkSize
+)
+
+// SignChunked signs the message with privateKey, hashing it as a Merkle tree
+// of chunkSize byte chunks, so that hashing is spread over all cores.  The
+// signature is over the message's ChunkedDigest, and is only valid for
+// VerifyChunked.
+func SignChunked(privateKey *[PrivateKeySize]byte, message []byte, chunkSize int) (*[SignatureSize]byte, error) {
+	d, err := chunkedDigestOf(message, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	return SignChunkedDigest(privateKey, d), nil
+}
+
+// SignChunkedDigest signs a ChunkedDigest computed by the caller, such as of
+// a message that is not held in memory, and returns the SignChunked
+// signature.
+//
+// Chunked signatures are domain separated from Sign signatures: the leaf
+// index, R and the message digest are each derived by hashing the standard
+// value again with the chunked label.  Neither kind of signature is valid as
+// the other, even over identical bytes.
+func SignChunkedDigest(privateKey *[PrivateKeySize]byte, digest *[ChunkedDigestSize]byte) *[SignatureSize]byte {
+	h := newRandomnessHash(privateKey[:])
+	h.Write(digest[:])
+	rnd := h.Sum(nil)
+	h = blake512.New()
+	h.Write([]byte(chunkedLabel))
+	h.Write(rnd)
+	utils.Zerobytes(rnd)
+	leafidx, r := randomnessFromHash(h)
+
+	sm, _ := signMessage(privateKey, nil, leafidx, &r, nil, true, func(h gohash.Hash) error {
+		h.Write(digest[:])
+		return nil
+	})
+	return sm
+}
+
+// VerifyChunkedDigest takes a public key, a ChunkedDigest and a signature,
+// and returns nil if the signature is a valid SignChunked signature of the
+// message with that digest, using the provided options.
+func VerifyChunkedDigest(publicKey *[PublicKeySize]byte, digest *[ChunkedDigestSize]byte, signature *[SignatureSize]byte, opts *VerifyOptions) error {
+	var tpk [PublicKeySize]byte
+
+	if err := opts.limits().check(0, VerifyMemory); err != nil {
+		return err
+	}
+	if err := checkVerify(publicKey); err != nil {
+		return err
+	}
+	copy(tpk[:], publicKey[:])
+	mH := chunkedDomain(hashMessage(signature[:], tpk[:], digest[:]))
+	return verify(tpk[:nMasks*hash.Size], tpk[nMasks*hash.Size:], mH, signature, opts)
+}
+
+// chunkedDomain maps a message digest into the chunked signature domain.
+func chunkedDomain(mH []byte) []byte {
+	h := blake512.New()
+	h.Write([]byte(chunkedLabel))
+	h.Write(mH)
+	return h.Sum(mH[:0])
+}
+
+// VerifyChunked takes a public key, message, signature and chunk size, and
+// returns nil if the signature is a valid SignChunked signature.
+func VerifyChunked(publicKey *[PublicKeySize]byte, message []byte, signature *[SignatureSize]byte, chunkSize int) error {
+	d, err := chunkedDigestOf(message, chunkSize)
+	if err != nil {
+		return err
+	}
+	return VerifyChunkedDigest(publicKey, d, signature, nil)
+}
+
+// ChunkedDigest returns the digest of the message read from r that
+// SignChunked signs.  It is:
+//
+//	"sphincs256 chunked v1\x00" || chunkSize || length || root
+//
+// where chunkSize and the message length are 64 bit big endian integers, and
+// root is the root of a binary tree over the message split in chunkSize byte
+// chunks (an empty message is a single empty chunk).  Leaf i is
+// SHA-256(0x00 || i || chunk) with i a 64 bit big endian integer, and each
+// interior node is SHA-256(0x01 || left || right).  A node without a sibling
+// is promoted to the next level unchanged.
+func ChunkedDigest(r io.Reader, chunkSize int) (*[ChunkedDigestSize]byte, error) {
+	if err := checkChunkSize(chunkSize); err != nil {
+		return nil, err
+	}
+
+	// Up to one chunk per worker, and at most chunkedBatchSize bytes, is
+	// read at a time, and the buffer only grows as data actually arrives.
+	var leaves [][sha256.Size]byte
+	var length uint64
+	var buf bytes.Buffer
+	chunks := workers()
+	if max := chunkedBatchSize / chunkSize; chunks > max {
+		chunks = max
+	}
+	batchSize := int64(chunks) * int64(chunkSize)
+	for {
+		buf.Reset()
+		n, err := io.CopyN(&buf, r, batchSize)
+		if n > 0 || len(leaves) == 0 {
+			leaves = hashChunks(leaves, buf.Bytes(), chunkSize)
+			length += uint64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return encodeChunkedDigest(chunkSize, length, leaves), nil
+}
+
+func checkChunkSize(chunkSize int) error {
+	if chunkSize <= 0 || chunkSize > MaxChunkSize {
+		return fmt.Errorf("sphincs256: invalid chunk size: %d", chunkSize)
+	}
+	return nil
+}
+
+func chunkedDigestOf(message []byte, chunkSize int) (*[ChunkedDigestSize]byte, error) {
+	if err := checkChunkSize(chunkSize); err != nil {
+		return nil, err
+	}
+	leaves := hashChunks(nil, message, chunkSize)
+	return encodeChunkedDigest(chunkSize, uint64(len(message)), leaves), nil
+}
+
+// hashChunks appends the leaf hashes of the chunks of b to leaves, hashing
+// the chunks in parallel.  An empty b is hashed as a single empty chunk.
+func hashChunks(leaves [][sha256.Size]byte, b []byte, chunkSize int) [][sha256.Size]byte {
+	n := (len(b) + chunkSize - 1) / chunkSize
+	if n == 0 {
+		n = 1
+	}
+	base := len(leaves)
+	leaves = append(leaves, make([][sha256.Size]byte, n)...)
+	parallelFor(n, func(i int) {
+		var idx [8]byte
+		chunk := b[i*chunkSize:]
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		binary.BigEndian.PutUint64(idx[:], uint64(base+i))
+
+		h := sha256.New()
+		h.Write([]byte{0x00})
+		h.Write(idx[:])
+		h.Write(chunk)
+		h.Sum(leaves[base+i][:0])
+	})
+	return leaves
+}
+
+func encodeChunkedDigest(chunkSize int, length uint64, leaves [][sha256.Size]byte) *[ChunkedDigestSize]byte {
+	for len(leaves) > 1 {
+		next := leaves[:0]
+		for i := 0; i < len(leaves); i += 2 {
+			if i+1 == len(leaves) {
+				next = append(next, leaves[i])
+				break
+			}
+			next = append(next, chunkedParent(&leaves[i], &leaves[i+1]))
+		}
+		leaves = next
+	}
+
+	var d [ChunkedDigestSize]byte
+	off := copy(d[:], chunkedLabel)
+	binary.BigEndian.PutUint64(d[off:], uint64(chunkSize))
+	binary.BigEndian.PutUint64(d[off+8:], length)
+	copy(d[off+16:], leaves[0][:])
+	return &d
+}
@@ -0,0 +1,92 @@
+// chunked_test.go - Chunked parallel message hashing tests
+
+package sphincs256
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math"
+	"testing"
+)
+
+func TestChunkedDigest(t *testing.T) {
+	msg := make([]byte, 1000)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+
+	for _, chunkSize := range []int{1, 7, 64, 1000, 4096} {
+		for _, l := range []int{0, 1, 63, 64, 65, 999, 1000} {
+			d, err := chunkedDigestOf(msg[:l], chunkSize)
+			if err != nil {
+				t.Fatalf("failed chunkedDigestOf(): %s", err)
+			}
+			for _, det := range []bool{false, true} {
+				SetDeterministic(det)
+				dr, err := ChunkedDigest(bytes.NewReader(msg[:l]), chunkSize)
+				if err != nil {
+					t.Fatalf("failed ChunkedDigest(): %s", err)
+				}
+				if *d != *dr {
+					t.Errorf("chunkSize %d, length %d: streamed digest mismatch", chunkSize, l)
+				}
+			}
+			SetDeterministic(false)
+		}
+	}
+
+	a, _ := chunkedDigestOf(msg, 64)
+	b, _ := chunkedDigestOf(msg, 128)
+	if *a == *b {
+		t.Errorf("digest does not bind the chunk size")
+	}
+	for _, chunkSize := range []int{0, -1, MaxChunkSize + 1, math.MaxInt} {
+		if _, err := chunkedDigestOf(msg, chunkSize); err == nil {
+			t.Errorf("chunkedDigestOf() accepted chunk size %d", chunkSize)
+		}
+		if _, err := ChunkedDigest(bytes.NewReader(msg), chunkSize); err == nil {
+			t.Errorf("ChunkedDigest() accepted chunk size %d", chunkSize)
+		}
+	}
+	if _, err := ChunkedDigest(bytes.NewReader(msg), MaxChunkSize); err != nil {
+		t.Errorf("ChunkedDigest() rejected chunk size MaxChunkSize: %s", err)
+	}
+}
+
+func TestSignChunked(t *testing.T) {
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	msg := bytes.Repeat([]byte("Iä! Iä! Cthulhu fhtagn! "), 1000)
+
+	sig, err := SignChunked(sk, msg, 4096)
+	if err != nil {
+		t.Fatalf("failed SignChunked(): %s", err)
+	}
+	if err = VerifyChunked(pk, msg, sig, 4096); err != nil {
+		t.Errorf("failed VerifyChunked(): %s", err)
+	}
+	if err = VerifyChunked(pk, msg, sig, 1024); err == nil {
+		t.Errorf("VerifyChunked() accepted a different chunk size")
+	}
+	if Verify(pk, msg, sig) {
+		t.Errorf("Verify() accepted a chunked signature")
+	}
+
+	// A Sign signature over the digest itself is not a chunked signature,
+	// and vice versa.
+	d, err := chunkedDigestOf(msg, 4096)
+	if err != nil {
+		t.Fatalf("failed chunkedDigestOf(): %s", err)
+	}
+	if err = VerifyChunked(pk, msg, Sign(sk, d[:]), 4096); err == nil {
+		t.Errorf("VerifyChunked() accepted a Sign signature of the digest")
+	}
+	if Verify(pk, d[:], sig) {
+		t.Errorf("Verify() accepted a chunked signature as one of the digest")
+	}
+	if err = VerifyChunkedDigest(pk, d, SignChunkedDigest(sk, d), nil); err != nil {
+		t.Errorf("failed VerifyChunkedDigest(): %s", err)
+	}
+}
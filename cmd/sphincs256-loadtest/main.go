@@ -0,0 +1,37 @@
+// main.go - Verification throughput load test command
+
+// Command sphincs256-loadtest measures SPHINCS-256 verification throughput
+// and tail latency on the local machine.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/yawning/sphincs256/loadtest"
+)
+
+func main() {
+	var cfg loadtest.Config
+	flag.IntVar(&cfg.Concurrency, "c", 0, "concurrent verification workers (default GOMAXPROCS)")
+	flag.DurationVar(&cfg.Duration, "d", 0, "test duration (default 10s)")
+	flag.IntVar(&cfg.Signatures, "n", 0, "distinct signatures to verify (default 16)")
+	flag.IntVar(&cfg.MessageSize, "size", 0, "message size in bytes (default 256)")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	r, err := loadtest.Run(ctx, &cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sphincs256-loadtest: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(r)
+	if r.Failures != 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,39 @@
+// main.go - Mixed workload stress and soak command
+
+// Command sphincs256-stress runs a long, mixed SPHINCS-256 workload and
+// checks for wrong results, memory growth and goroutine leaks.  Build it
+// with -race to also detect data races.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/yawning/sphincs256/stress"
+)
+
+func main() {
+	var cfg stress.Config
+	flag.IntVar(&cfg.Workers, "c", 0, "concurrent workers (default 2 * GOMAXPROCS)")
+	flag.DurationVar(&cfg.Duration, "d", 0, "run duration (default 1m)")
+	flag.IntVar(&cfg.CacheSize, "keys", 0, "prepared public key cache size (default 8)")
+	flag.IntVar(&cfg.MessageSize, "size", 0, "message size in bytes (default 1024)")
+	flag.Uint64Var(&cfg.MaxHeapGrowth, "max-heap-growth", 0, "allowed live heap growth in bytes (default 64 MiB)")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	r, err := stress.Run(ctx, &cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sphincs256-stress: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(r)
+	if !r.OK() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,64 @@
+// main.go - Bulk artifact verification command
+
+// Command sphincs256-verifyall verifies every artifact in a manifest (see
+// the verifyall package) and writes a JSON report to standard output.  It
+// exits with status 1 unless every artifact passes.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/yawning/sphincs256/verifyall"
+)
+
+func main() {
+	var opts verifyall.Options
+	root := flag.String("root", "", "directory the manifest paths are relative to (default the manifest's directory)")
+	flag.IntVar(&opts.Concurrency, "c", 0, "concurrent verifications (default GOMAXPROCS)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] manifest.json\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	m, err := verifyall.ParseManifest(f)
+	f.Close()
+	if err != nil {
+		fatal(err)
+	}
+	if *root == "" {
+		*root = filepath.Dir(flag.Arg(0))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	r := verifyall.Run(ctx, os.DirFS(*root), m, &opts)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(r); err != nil {
+		fatal(err)
+	}
+	if !r.OK() {
+		os.Exit(1)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "sphincs256-verifyall: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,186 @@
+// ctencoding.go - Constant time hex and base64 encoding
+
+// Package ctencoding implements hex and base64 encoding and decoding in time
+// independent of the encoded data, for private key material.
+//
+// The encoding/hex and encoding/base64 packages map characters through
+// lookup tables, whose memory access pattern depends on the data, and stop
+// at the first invalid character.  The functions here compute every
+// character arithmetically, and only report whether the input as a whole
+// was valid.  The timing depends only on the input length, and for base64,
+// on where line breaks and padding are, which are not considered secret.
+package ctencoding
+
+import "errors"
+
+// ErrInvalid is the error returned when the input is not validly encoded.
+// No indication of where is given, as that would depend on the data.
+var ErrInvalid = errors.New("ctencoding: invalid encoding")
+
+// EncodeHex returns the lowercase hex encoding of src.
+func EncodeHex(src []byte) []byte {
+	dst := make([]byte, 2*len(src))
+	for i, b := range src {
+		dst[2*i] = hexChar(int(b >> 4))
+		dst[2*i+1] = hexChar(int(b & 0x0f))
+	}
+	return dst
+}
+
+// DecodeHex decodes the hex encoded src, in either case.
+func DecodeHex(src []byte) ([]byte, error) {
+	if len(src)%2 != 0 {
+		return nil, ErrInvalid
+	}
+
+	dst := make([]byte, len(src)/2)
+	bad := 0
+	for i := range dst {
+		hi, lo := hexValue(src[2*i]), hexValue(src[2*i+1])
+		bad |= hi | lo
+		dst[i] = byte(hi<<4 | lo)
+	}
+	if bad < 0 {
+		zero(dst)
+		return nil, ErrInvalid
+	}
+	return dst, nil
+}
+
+// EncodeBase64 returns the padded standard base64 encoding of src.  If
+// lineLength is positive, a newline is inserted after every lineLength
+// characters and at the end, as in PEM.
+func EncodeBase64(src []byte, lineLength int) []byte {
+	n := (len(src) + 2) / 3 * 4
+	if lineLength > 0 {
+		n += (n + lineLength - 1) / lineLength
+	}
+
+	dst := make([]byte, 0, n)
+	col := 0
+	put := func(c byte) {
+		dst = append(dst, c)
+		if col++; col == lineLength {
+			dst = append(dst, '\n')
+			col = 0
+		}
+	}
+	for ; len(src) >= 3; src = src[3:] {
+		v := int(src[0])<<16 | int(src[1])<<8 | int(src[2])
+		put(base64Char(v >> 18))
+		put(base64Char(v >> 12 & 0x3f))
+		put(base64Char(v >> 6 & 0x3f))
+		put(base64Char(v & 0x3f))
+	}
+	switch len(src) {
+	case 1:
+		v := int(src[0]) << 16
+		put(base64Char(v >> 18))
+		put(base64Char(v >> 12 & 0x3f))
+		put('=')
+		put('=')
+	case 2:
+		v := int(src[0])<<16 | int(src[1])<<8
+		put(base64Char(v >> 18))
+		put(base64Char(v >> 12 & 0x3f))
+		put(base64Char(v >> 6 & 0x3f))
+		put('=')
+	}
+	if lineLength > 0 && col != 0 {
+		dst = append(dst, '\n')
+	}
+	return dst
+}
+
+// DecodeBase64 decodes the padded standard base64 encoded src, ignoring
+// line breaks.  Non-canonical encodings, with non-zero bits after the end
+// of the data, are rejected.
+func DecodeBase64(src []byte) ([]byte, error) {
+	chars := make([]byte, 0, len(src))
+	for _, c := range src {
+		if c != '\r' && c != '\n' {
+			chars = append(chars, c)
+		}
+	}
+	defer zero(chars)
+	if len(chars)%4 != 0 {
+		return nil, ErrInvalid
+	}
+
+	pad := 0
+	for pad < 2 && len(chars) > pad && chars[len(chars)-1-pad] == '=' {
+		pad++
+	}
+	chars = chars[:len(chars)-pad]
+
+	dst := make([]byte, 0, len(chars)*3/4)
+	bad := 0
+	for ; len(chars) >= 4; chars = chars[4:] {
+		a, b, c, d := base64Value(chars[0]), base64Value(chars[1]), base64Value(chars[2]), base64Value(chars[3])
+		bad |= a | b | c | d
+		v := a<<18 | b<<12 | c<<6 | d
+		dst = append(dst, byte(v>>16), byte(v>>8), byte(v))
+	}
+	switch len(chars) {
+	case 2:
+		a, b := base64Value(chars[0]), base64Value(chars[1])
+		bad |= a | b
+		bad |= -(b & 0x0f)
+		dst = append(dst, byte(a<<2|b>>4))
+	case 3:
+		a, b, c := base64Value(chars[0]), base64Value(chars[1]), base64Value(chars[2])
+		bad |= a | b | c
+		bad |= -(c & 0x03)
+		v := a<<12 | b<<6 | c
+		dst = append(dst, byte(v>>10), byte(v>>2))
+	}
+	if bad < 0 {
+		zero(dst)
+		return nil, ErrInvalid
+	}
+	return dst, nil
+}
+
+// hexChar returns the lowercase hex digit of 0 <= v < 16.
+func hexChar(v int) byte {
+	// '0' + v, plus 'a' - ('9' + 1) if v > 9.
+	return byte(v + '0' + ((9-v)>>8)&('a'-'9'-1))
+}
+
+// hexValue returns the value of the hex digit c, or -1.
+func hexValue(c byte) int {
+	ch := int(c)
+	v := -1
+	v += ((('0' - 1 - ch) & (ch - '9' - 1)) >> 8) & (ch - '0' + 1)
+	v += ((('A' - 1 - ch) & (ch - 'F' - 1)) >> 8) & (ch - 'A' + 11)
+	v += ((('a' - 1 - ch) & (ch - 'f' - 1)) >> 8) & (ch - 'a' + 11)
+	return v
+}
+
+// base64Char returns the standard base64 character of 0 <= v < 64.
+func base64Char(v int) byte {
+	d := int('A')
+	d += ((25 - v) >> 8) & ('a' - 26 - 'A')
+	d -= ((51 - v) >> 8) & ('a' - 26 - ('0' - 52))
+	d -= ((61 - v) >> 8) & ('0' - 52 - ('+' - 62))
+	d += ((62 - v) >> 8) & ('/' - 63 - ('+' - 62))
+	return byte(v + d)
+}
+
+// base64Value returns the value of the standard base64 character c, or -1.
+func base64Value(c byte) int {
+	ch := int(c)
+	v := -1
+	v += ((('A' - 1 - ch) & (ch - 'Z' - 1)) >> 8) & (ch - 'A' + 1)
+	v += ((('a' - 1 - ch) & (ch - 'z' - 1)) >> 8) & (ch - 'a' + 27)
+	v += ((('0' - 1 - ch) & (ch - '9' - 1)) >> 8) & (ch - '0' + 53)
+	v += ((('+' - 1 - ch) & (ch - '+' - 1)) >> 8) & 63
+	v += ((('/' - 1 - ch) & (ch - '/' - 1)) >> 8) & 64
+	return v
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
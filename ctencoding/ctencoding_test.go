@@ -0,0 +1,67 @@
+// ctencoding_test.go - Constant time encoding tests
+
+package ctencoding
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"testing"
+)
+
+func TestHex(t *testing.T) {
+	src := make([]byte, 256)
+	for i := range src {
+		src[i] = byte(i)
+	}
+	enc := EncodeHex(src)
+	if !bytes.Equal(enc, []byte(hex.EncodeToString(src))) {
+		t.Fatalf("EncodeHex() does not match encoding/hex")
+	}
+	for _, s := range [][]byte{enc, bytes.ToUpper(enc)} {
+		dec, err := DecodeHex(s)
+		if err != nil || !bytes.Equal(dec, src) {
+			t.Fatalf("DecodeHex() failed: %v", err)
+		}
+	}
+
+	for _, s := range []string{"0", "0g", "g0", "0:", "/0", "@0", "0G", "`0"} {
+		if _, err := DecodeHex([]byte(s)); err != ErrInvalid {
+			t.Errorf("DecodeHex(%q) returned %v", s, err)
+		}
+	}
+}
+
+func TestBase64(t *testing.T) {
+	src := make([]byte, 300)
+	for i := range src {
+		src[i] = byte(i * 7)
+	}
+	for n := 0; n <= len(src); n++ {
+		enc := EncodeBase64(src[:n], 0)
+		if !bytes.Equal(enc, []byte(base64.StdEncoding.EncodeToString(src[:n]))) {
+			t.Fatalf("EncodeBase64() does not match encoding/base64 for length %d", n)
+		}
+		dec, err := DecodeBase64(enc)
+		if err != nil || !bytes.Equal(dec, src[:n]) {
+			t.Fatalf("DecodeBase64() failed for length %d: %v", n, err)
+		}
+	}
+
+	// Wrapped output matches PEM, and decodes.
+	enc := EncodeBase64(src, 64)
+	p := pem.EncodeToMemory(&pem.Block{Type: "T", Bytes: src})
+	if !bytes.Contains(p, enc) {
+		t.Fatalf("EncodeBase64() with line length 64 does not match PEM")
+	}
+	if dec, err := DecodeBase64(enc); err != nil || !bytes.Equal(dec, src) {
+		t.Fatalf("DecodeBase64() of wrapped data failed: %v", err)
+	}
+
+	for _, s := range []string{"A", "AA", "AAA", "AB==", "AAB=", "A===", "====", "AA=A", "-_AA", "AA A", "AAAA="} {
+		if _, err := DecodeBase64([]byte(s)); err != ErrInvalid {
+			t.Errorf("DecodeBase64(%q) returned %v", s, err)
+		}
+	}
+}
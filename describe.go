@@ -0,0 +1,108 @@
+// describe.go - Configuration self-description
+
+package sphincs256
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/yawning/sphincs256/chacha"
+	"github.com/yawning/sphincs256/horst"
+	"github.com/yawning/sphincs256/wots"
+)
+
+// Description is a structured description of the active configuration, for
+// logging at startup and for forensic traceability.
+type Description struct {
+	// Algorithm is the signature algorithm, "SPHINCS-256".
+	Algorithm string `json:"algorithm"`
+
+	// MessageHash is the digest used for the message and its randomness.
+	MessageHash string `json:"message_hash"`
+
+	// SeedHash is the digest used for deriving per-leaf seeds.
+	SeedHash string `json:"seed_hash"`
+
+	// TreeHash is the function used for the hash trees and WOTS chains.
+	TreeHash string `json:"tree_hash"`
+
+	// PRG is the stream cipher used to expand seeds.
+	PRG string `json:"prg"`
+
+	// Permutation is the implementation of the ChaCha12 permutation in use.
+	Permutation string `json:"permutation"`
+
+	// Parameters is the parameter set.
+	Parameters Parameters `json:"parameters"`
+
+	// Compat lists the ways this implementation knowingly differs from the
+	// SUPERCOP reference code.  "leafidx-le" means that the leaf index is
+	// decoded as little endian regardless of the host byte order.
+	Compat []string `json:"compat"`
+
+	// Deterministic is true iff the deterministic execution mode was
+	// enabled when Describe was called.  It is a snapshot of process-global
+	// state set by SetDeterministic.
+	Deterministic bool `json:"deterministic"`
+
+	// Workers is the number of goroutines that were used for
+	// parallelizable work when Describe was called.  It is a snapshot of
+	// process-global state set by SetWorkers and SetDeterministic.
+	Workers int `json:"workers"`
+
+	// GoVersion, GOOS and GOARCH describe the Go runtime.
+	GoVersion string `json:"go_version"`
+	GOOS      string `json:"goos"`
+	GOARCH    string `json:"goarch"`
+}
+
+// Parameters is a SPHINCS-256 parameter set.
+type Parameters struct {
+	TotalTreeHeight int `json:"total_tree_height"`
+	SubtreeHeight   int `json:"subtree_height"`
+	WOTSW           int `json:"wots_w"`
+	HORSTT          int `json:"horst_t"`
+	HORSTK          int `json:"horst_k"`
+	PublicKeySize   int `json:"public_key_size"`
+	PrivateKeySize  int `json:"private_key_size"`
+	SignatureSize   int `json:"signature_size"`
+}
+
+// Describe returns a description of the active configuration.  The
+// Deterministic and Workers fields reflect process-global settings at the
+// time of the call, and are not updated if those settings later change.
+func Describe() *Description {
+	return &Description{
+		Algorithm:   "SPHINCS-256",
+		MessageHash: "BLAKE-512",
+		SeedHash:    "BLAKE-256",
+		TreeHash:    "ChaCha12-permutation",
+		PRG:         "ChaCha12",
+		Permutation: chacha.Implementation,
+		Parameters: Parameters{
+			TotalTreeHeight: totalTreeHeight,
+			SubtreeHeight:   subtreeHeight,
+			WOTSW:           wots.W,
+			HORSTT:          horst.T,
+			HORSTK:          horst.K,
+			PublicKeySize:   PublicKeySize,
+			PrivateKeySize:  PrivateKeySize,
+			SignatureSize:   SignatureSize,
+		},
+		Compat:        []string{"leafidx-le"},
+		Deterministic: IsDeterministic(),
+		Workers:       workers(),
+		GoVersion:     runtime.Version(),
+		GOOS:          runtime.GOOS,
+		GOARCH:        runtime.GOARCH,
+	}
+}
+
+// String returns a single line summary of the description.
+func (d *Description) String() string {
+	return fmt.Sprintf("%s (h=%d d=%d w=%d t=%d k=%d) hash=%s/%s/%s prg=%s permute=%s compat=%v deterministic=%v workers=%d %s %s/%s",
+		d.Algorithm, d.Parameters.TotalTreeHeight, d.Parameters.TotalTreeHeight/d.Parameters.SubtreeHeight,
+		d.Parameters.WOTSW, d.Parameters.HORSTT, d.Parameters.HORSTK,
+		d.MessageHash, d.SeedHash, d.TreeHash, d.PRG, d.Permutation, d.Compat,
+		d.Deterministic, d.Workers, d.GoVersion, d.GOOS, d.GOARCH)
+}
@@ -0,0 +1,23 @@
+// describe_test.go - Configuration self-description tests
+
+package sphincs256
+
+import "testing"
+
+func TestDescribe(t *testing.T) {
+	SetDeterministic(true)
+	d := Describe()
+	SetDeterministic(false)
+
+	if !d.Deterministic || d.Workers != 1 {
+		t.Errorf("Describe() does not reflect the deterministic mode: %s", d)
+	}
+	if d.Parameters.SignatureSize != SignatureSize || d.Parameters.TotalTreeHeight != totalTreeHeight {
+		t.Errorf("Describe() has the wrong parameters: %s", d)
+	}
+
+	// The runtime settings are a snapshot, not a live view.
+	if Describe().Deterministic || d.Workers != 1 {
+		t.Errorf("Describe() does not snapshot the deterministic mode: %s", d)
+	}
+}
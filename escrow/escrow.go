@@ -0,0 +1,285 @@
+// escrow.go - Private key escrow
+
+// Package escrow exports SPHINCS-256 private keys for k-of-n escrow, for
+// organizations with mandatory key recovery policies.
+//
+// The private key is split with Shamir's secret sharing (see the shamir
+// package) into one share per escrow recipient, and each share is encrypted
+// to the recipient's X25519 public key.  Any threshold of the recipients can
+// recover the key, while fewer learn nothing about it.
+//
+// Recovery proceeds as follows:
+//
+//  1. The escrow Package is retrieved, and parsed with Parse.
+//  2. Each participating recipient calls Package.DecryptShare with their
+//     X25519 private key, and hands the resulting share to the recovery
+//     officer over a confidential channel.  Recipients never need to
+//     reveal their private keys.
+//  3. Once at least Threshold shares are collected, Package.Recover
+//     combines them, and checks that the recovered private key corresponds
+//     to the escrowed public key before returning it.
+//
+// Each share is encrypted with AES-256-GCM, under a key derived with
+// HKDF-SHA256 from an ephemeral X25519 exchange with the recipient, and
+// authenticated together with the escrowed public key, the threshold and
+// the share's index, so that shares can not be moved between packages.
+package escrow
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/shamir"
+	"github.com/yawning/sphincs256/utils"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// RecipientKeySize is the length of an X25519 public key in bytes.
+	RecipientKeySize = 32
+
+	// EncryptedShareSize is the encoded length of an EncryptedShare in
+	// bytes.
+	EncryptedShareSize = 1 + 2*RecipientKeySize + sphincs256.PrivateKeySize + tagSize
+
+	label   = "sphincs256 escrow v1\x00"
+	tagSize = 16
+)
+
+// ErrWrongKey is the error returned when a share can not be decrypted with
+// the given recipient key.
+var ErrWrongKey = errors.New("escrow: share is not encrypted to this key")
+
+// EncryptedShare is a private key share encrypted to an escrow recipient.
+type EncryptedShare struct {
+	// Index is the share's Shamir index, starting at 1.
+	Index byte
+
+	// Recipient is the recipient's X25519 public key.
+	Recipient [RecipientKeySize]byte
+
+	// Ephemeral is the sender's ephemeral X25519 public key.
+	Ephemeral [RecipientKeySize]byte
+
+	// Ciphertext is the encrypted share and its authentication tag.
+	Ciphertext []byte
+}
+
+// Package is an escrowed private key.
+type Package struct {
+	// PublicKey is the public key of the escrowed private key.
+	PublicKey [sphincs256.PublicKeySize]byte
+
+	// Threshold is the number of shares needed for recovery.
+	Threshold int
+
+	// Shares are the encrypted shares, one per recipient.
+	Shares []EncryptedShare
+}
+
+// Export escrows privateKey to recipients, threshold of whom are needed to
+// recover it, using rand (the default sphincs256.Source if nil) as the
+// source of entropy.
+func Export(rand io.Reader, privateKey *[sphincs256.PrivateKeySize]byte, recipients []*ecdh.PublicKey, threshold int) (*Package, error) {
+	if rand == nil {
+		rand = sphincs256.DefaultSource()
+	}
+	if len(recipients) > shamir.MaxShares {
+		return nil, fmt.Errorf("escrow: %d recipients exceeds the limit of %d", len(recipients), shamir.MaxShares)
+	}
+	shares, err := shamir.Split(privateKey[:], len(recipients), threshold, rand)
+	if err != nil {
+		return nil, fmt.Errorf("escrow: %v", err)
+	}
+	defer func() {
+		for _, s := range shares {
+			utils.Zerobytes(s.Y)
+		}
+	}()
+
+	p := &Package{Threshold: threshold, Shares: make([]EncryptedShare, len(recipients))}
+	pk := (*sphincs256.PrivateKey)(privateKey).Public().(*sphincs256.PublicKey)
+	p.PublicKey = *pk
+	for i, r := range recipients {
+		if r.Curve() != ecdh.X25519() {
+			return nil, fmt.Errorf("escrow: recipient %d is not an X25519 key", i)
+		}
+		// GenerateKey ignores rand, so the ephemeral key is read from it
+		// directly to honor the caller's source.
+		var ephBytes [32]byte
+		if _, err := io.ReadFull(rand, ephBytes[:]); err != nil {
+			return nil, err
+		}
+		eph, err := ecdh.X25519().NewPrivateKey(ephBytes[:])
+		utils.Zerobytes(ephBytes[:])
+		if err != nil {
+			return nil, err
+		}
+		shared, err := eph.ECDH(r)
+		if err != nil {
+			return nil, fmt.Errorf("escrow: recipient %d: %v", i, err)
+		}
+
+		es := &p.Shares[i]
+		es.Index = shares[i].X
+		copy(es.Recipient[:], r.Bytes())
+		copy(es.Ephemeral[:], eph.PublicKey().Bytes())
+		aead, err := p.aead(es, shared)
+		utils.Zerobytes(shared)
+		if err != nil {
+			return nil, err
+		}
+		es.Ciphertext = aead.Seal(nil, make([]byte, aead.NonceSize()), shares[i].Y, p.associatedData(es))
+	}
+	return p, nil
+}
+
+// DecryptShare decrypts the share encrypted to recipientKey, for recovery
+// with Recover.
+func (p *Package) DecryptShare(recipientKey *ecdh.PrivateKey) (*shamir.Share, error) {
+	pub := recipientKey.PublicKey().Bytes()
+	for i := range p.Shares {
+		es := &p.Shares[i]
+		if subtle.ConstantTimeCompare(es.Recipient[:], pub) != 1 {
+			continue
+		}
+
+		eph, err := ecdh.X25519().NewPublicKey(es.Ephemeral[:])
+		if err != nil {
+			return nil, fmt.Errorf("escrow: invalid ephemeral key: %v", err)
+		}
+		shared, err := recipientKey.ECDH(eph)
+		if err != nil {
+			return nil, fmt.Errorf("escrow: %v", err)
+		}
+		aead, err := p.aead(es, shared)
+		utils.Zerobytes(shared)
+		if err != nil {
+			return nil, err
+		}
+		y, err := aead.Open(nil, make([]byte, aead.NonceSize()), es.Ciphertext, p.associatedData(es))
+		if err != nil {
+			return nil, fmt.Errorf("escrow: share %d failed to decrypt", es.Index)
+		}
+		return &shamir.Share{X: es.Index, Y: y}, nil
+	}
+	return nil, ErrWrongKey
+}
+
+// Recover combines at least Threshold decrypted shares into the private
+// key, and checks it against the escrowed public key.
+func (p *Package) Recover(shares []*shamir.Share) (*[sphincs256.PrivateKeySize]byte, error) {
+	if len(shares) < p.Threshold {
+		return nil, fmt.Errorf("escrow: %d shares given, %d are needed", len(shares), p.Threshold)
+	}
+	ss := make([]shamir.Share, len(shares))
+	for i, s := range shares {
+		ss[i] = *s
+	}
+	secret, err := shamir.Combine(ss)
+	if err != nil {
+		return nil, fmt.Errorf("escrow: %v", err)
+	}
+	defer utils.Zerobytes(secret)
+	if len(secret) != sphincs256.PrivateKeySize {
+		return nil, errors.New("escrow: shares have the wrong length")
+	}
+
+	sk := new([sphincs256.PrivateKeySize]byte)
+	copy(sk[:], secret)
+	pk := (*sphincs256.PrivateKey)(sk).Public().(*sphincs256.PublicKey)
+	if subtle.ConstantTimeCompare(pk[:], p.PublicKey[:]) != 1 {
+		utils.Zerobytes(sk[:])
+		return nil, errors.New("escrow: recovered key does not match the escrowed public key")
+	}
+	return sk, nil
+}
+
+func (p *Package) aead(es *EncryptedShare, shared []byte) (cipher.AEAD, error) {
+	salt := append(es.Ephemeral[:], es.Recipient[:]...)
+	key := make([]byte, 32)
+	defer utils.Zerobytes(key)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(label)), key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	// Each key encrypts a single share, so a fixed nonce is safe.
+	return cipher.NewGCM(block)
+}
+
+func (p *Package) associatedData(es *EncryptedShare) []byte {
+	h := sha256.New()
+	h.Write([]byte(label))
+	h.Write(p.PublicKey[:])
+	h.Write([]byte{byte(p.Threshold), byte(len(p.Shares)), es.Index})
+	h.Write(es.Recipient[:])
+	return h.Sum(nil)
+}
+
+// MarshalBinary encodes the package as the label "sphincs256 escrow
+// v1\x00", the public key, the threshold and number of shares (1 byte
+// each), and the shares, each the index, the recipient and ephemeral keys,
+// and the ciphertext.
+func (p *Package) MarshalBinary() ([]byte, error) {
+	if p.Threshold < 1 || p.Threshold > len(p.Shares) || len(p.Shares) > shamir.MaxShares {
+		return nil, fmt.Errorf("escrow: invalid threshold %d of %d", p.Threshold, len(p.Shares))
+	}
+	b := make([]byte, 0, len(label)+sphincs256.PublicKeySize+2+len(p.Shares)*EncryptedShareSize)
+	b = append(b, label...)
+	b = append(b, p.PublicKey[:]...)
+	b = append(b, byte(p.Threshold), byte(len(p.Shares)))
+	for i := range p.Shares {
+		es := &p.Shares[i]
+		if len(es.Ciphertext) != sphincs256.PrivateKeySize+tagSize {
+			return nil, fmt.Errorf("escrow: share %d has an invalid ciphertext length", es.Index)
+		}
+		b = append(b, es.Index)
+		b = append(b, es.Recipient[:]...)
+		b = append(b, es.Ephemeral[:]...)
+		b = append(b, es.Ciphertext...)
+	}
+	return b, nil
+}
+
+// Parse decodes a package encoded with MarshalBinary.
+func Parse(data []byte) (*Package, error) {
+	if !bytes.HasPrefix(data, []byte(label)) {
+		return nil, errors.New("escrow: bad label")
+	}
+	data = data[len(label):]
+	if len(data) < sphincs256.PublicKeySize+2 {
+		return nil, errors.New("escrow: truncated package")
+	}
+
+	p := new(Package)
+	copy(p.PublicKey[:], data)
+	data = data[sphincs256.PublicKeySize:]
+	p.Threshold, p.Shares = int(data[0]), make([]EncryptedShare, data[1])
+	data = data[2:]
+	if p.Threshold < 1 || p.Threshold > len(p.Shares) {
+		return nil, fmt.Errorf("escrow: invalid threshold %d of %d", p.Threshold, len(p.Shares))
+	}
+	if len(data) != len(p.Shares)*EncryptedShareSize {
+		return nil, errors.New("escrow: invalid package length")
+	}
+	for i := range p.Shares {
+		es := &p.Shares[i]
+		es.Index = data[0]
+		copy(es.Recipient[:], data[1:])
+		copy(es.Ephemeral[:], data[1+RecipientKeySize:])
+		es.Ciphertext = append([]byte{}, data[1+2*RecipientKeySize:EncryptedShareSize]...)
+		data = data[EncryptedShareSize:]
+	}
+	return p, nil
+}
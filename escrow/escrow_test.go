@@ -0,0 +1,78 @@
+// escrow_test.go - Private key escrow tests
+
+package escrow
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/shamir"
+)
+
+func TestEscrow(t *testing.T) {
+	_, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+
+	var keys []*ecdh.PrivateKey
+	var recipients []*ecdh.PublicKey
+	for i := 0; i < 4; i++ {
+		k, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("ecdh GenerateKey() failed: %v", err)
+		}
+		keys, recipients = append(keys, k), append(recipients, k.PublicKey())
+	}
+
+	p, err := Export(nil, sk, recipients, 3)
+	if err != nil {
+		t.Fatalf("Export() failed: %v", err)
+	}
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+	if p, err = Parse(b); err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	var shares []*shamir.Share
+	for _, k := range []*ecdh.PrivateKey{keys[3], keys[0], keys[2]} {
+		s, err := p.DecryptShare(k)
+		if err != nil {
+			t.Fatalf("DecryptShare() failed: %v", err)
+		}
+		shares = append(shares, s)
+	}
+	if _, err = p.Recover(shares[:2]); err == nil {
+		t.Errorf("Recover() succeeded with too few shares")
+	}
+	recovered, err := p.Recover(shares)
+	if err != nil {
+		t.Fatalf("Recover() failed: %v", err)
+	}
+	if *recovered != *sk {
+		t.Fatalf("Recover() returned the wrong key")
+	}
+
+	// A corrupted share is caught by the public key check.
+	shares[1].Y[0] ^= 1
+	if _, err = p.Recover(shares); err == nil {
+		t.Errorf("Recover() accepted a corrupted share")
+	}
+
+	outsider, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	if _, err = p.DecryptShare(outsider); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("DecryptShare() with an unrelated key: got %v", err)
+	}
+
+	// Shares are bound to their package.
+	p.Threshold = 2
+	if _, err = p.DecryptShare(keys[1]); err == nil {
+		t.Errorf("DecryptShare() accepted a share from an altered package")
+	}
+}
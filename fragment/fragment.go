@@ -0,0 +1,227 @@
+// fragment.go - Wire codec for constrained links
+
+// Package fragment splits SPHINCS-256 public keys, signatures and other
+// payloads into small, individually checksummed frames for transports such
+// as LoRa and BLE, and reassembles them on the receiving side.
+//
+// Each frame is encoded as:
+//
+//	version    (1 byte, 1)
+//	kind       (1 byte)
+//	flags      (1 byte)
+//	transfer   (4 bytes, big endian)
+//	sequence   (2 bytes, big endian)
+//	total      (2 bytes, big endian)
+//	payload    (up to mtu - Overhead bytes)
+//	CRC-32     (4 bytes, big endian, IEEE, over all preceding bytes)
+//
+// The transfer ID is derived from the kind and the payload.  Encoding is
+// deterministic, so a sender can regenerate the frames of a transfer at any
+// time and resend only those the receiver reports as missing.
+//
+// The payload is DEFLATE compressed if that makes it smaller.  Keys and
+// signatures are indistinguishable from random data and are sent as is.
+package fragment
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/yawning/sphincs256"
+)
+
+const (
+	// Version is the frame format version.
+	Version = 1
+
+	// HeaderSize is the size of the frame header in bytes.
+	HeaderSize = 11
+
+	// Overhead is the number of bytes in each frame that are not payload.
+	Overhead = HeaderSize + crc32.Size
+
+	// MinMTU is the smallest supported frame size.
+	MinMTU = Overhead + 1
+
+	// MaxFrameSize is the largest supported frame size.  Larger MTUs are
+	// treated as MaxFrameSize.
+	MaxFrameSize = 1<<16 - 1
+
+	// MaxPayloadSize is the largest payload, after decompression, that is
+	// accepted.
+	MaxPayloadSize = 1 << 20
+
+	// MaxFrames is the largest number of frames in a transfer.
+	MaxFrames = 1<<16 - 1
+
+	flagCompressed = 1 << 0
+)
+
+// Kind is the type of a payload.
+type Kind byte
+
+const (
+	// KindRaw is an opaque payload.
+	KindRaw Kind = iota
+
+	// KindPublicKey is an encoded public key.
+	KindPublicKey
+
+	// KindSignature is an encoded signature.
+	KindSignature
+
+	// KindSignedMessage is a signature followed by the message, as returned
+	// by sphincs256.Sign and accepted by sphincs256.Open.
+	KindSignedMessage
+)
+
+var (
+	// ErrChecksum is the error returned when a frame is truncated or its
+	// checksum does not match.
+	ErrChecksum = errors.New("fragment: frame checksum mismatch")
+
+	// ErrTransfer is the error returned when a frame does not belong to the
+	// transfer being reassembled.
+	ErrTransfer = errors.New("fragment: frame belongs to a different transfer")
+
+	// ErrIncomplete is the error returned when a payload is requested before
+	// all frames have been received.
+	ErrIncomplete = errors.New("fragment: transfer incomplete")
+)
+
+// Frame is a decoded frame.
+type Frame struct {
+	Kind       Kind
+	Compressed bool
+	Transfer   uint32
+	Sequence   uint16
+	Total      uint16
+	Payload    []byte
+}
+
+// Split encodes payload as a sequence of frames of at most mtu bytes each.
+func Split(kind Kind, payload []byte, mtu int) ([][]byte, error) {
+	if mtu < MinMTU {
+		return nil, fmt.Errorf("fragment: mtu %d is less than %d", mtu, MinMTU)
+	}
+	if len(payload) > MaxPayloadSize {
+		return nil, fmt.Errorf("fragment: payload of %d bytes is too large", len(payload))
+	}
+	if mtu > MaxFrameSize {
+		mtu = MaxFrameSize
+	}
+
+	var flags byte
+	body := payload
+	if c := compress(payload); len(c) < len(payload) {
+		body, flags = c, flagCompressed
+	}
+
+	chunk := mtu - Overhead
+	n := (len(body) + chunk - 1) / chunk
+	if n == 0 {
+		n = 1
+	}
+	if n > MaxFrames {
+		return nil, fmt.Errorf("fragment: %d frames exceeds the limit of %d", n, MaxFrames)
+	}
+
+	id := transferID(kind, payload)
+	frames := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		p := body[i*chunk:]
+		if len(p) > chunk {
+			p = p[:chunk]
+		}
+		f := make([]byte, HeaderSize, HeaderSize+len(p)+crc32.Size)
+		f[0] = Version
+		f[1] = byte(kind)
+		f[2] = flags
+		binary.BigEndian.PutUint32(f[3:], id)
+		binary.BigEndian.PutUint16(f[7:], uint16(i))
+		binary.BigEndian.PutUint16(f[9:], uint16(n))
+		f = append(f, p...)
+		f = binary.BigEndian.AppendUint32(f, crc32.ChecksumIEEE(f))
+		frames = append(frames, f)
+	}
+	return frames, nil
+}
+
+// SplitPublicKey encodes publicKey as frames of at most mtu bytes each.
+func SplitPublicKey(publicKey *[sphincs256.PublicKeySize]byte, mtu int) ([][]byte, error) {
+	return Split(KindPublicKey, publicKey[:], mtu)
+}
+
+// SplitSignature encodes signature as frames of at most mtu bytes each.
+func SplitSignature(signature *[sphincs256.SignatureSize]byte, mtu int) ([][]byte, error) {
+	return Split(KindSignature, signature[:], mtu)
+}
+
+// ParseFrame decodes and checks a single frame.  The returned payload
+// aliases b.
+func ParseFrame(b []byte) (*Frame, error) {
+	if len(b) < MinMTU {
+		return nil, ErrChecksum
+	}
+	if len(b) > MaxFrameSize {
+		return nil, fmt.Errorf("fragment: frame of %d bytes is too large", len(b))
+	}
+	body, sum := b[:len(b)-crc32.Size], b[len(b)-crc32.Size:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return nil, ErrChecksum
+	}
+	if body[0] != Version {
+		return nil, fmt.Errorf("fragment: unsupported frame version %d", body[0])
+	}
+	if body[2]&^flagCompressed != 0 {
+		return nil, fmt.Errorf("fragment: unknown frame flags 0x%02x", body[2])
+	}
+
+	f := &Frame{
+		Kind:       Kind(body[1]),
+		Compressed: body[2]&flagCompressed != 0,
+		Transfer:   binary.BigEndian.Uint32(body[3:]),
+		Sequence:   binary.BigEndian.Uint16(body[7:]),
+		Total:      binary.BigEndian.Uint16(body[9:]),
+		Payload:    body[HeaderSize:],
+	}
+	if f.Total == 0 || f.Sequence >= f.Total {
+		return nil, fmt.Errorf("fragment: invalid frame sequence %d/%d", f.Sequence, f.Total)
+	}
+	return f, nil
+}
+
+// transferID derives the transfer ID of a payload.
+func transferID(kind Kind, payload []byte) uint32 {
+	h := sha256.New()
+	h.Write([]byte{byte(kind)})
+	h.Write(payload)
+	return binary.BigEndian.Uint32(h.Sum(nil))
+}
+
+func compress(b []byte) []byte {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func decompress(b []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(b))
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, MaxPayloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("fragment: corrupt compressed payload: %v", err)
+	}
+	if len(out) > MaxPayloadSize {
+		return nil, fmt.Errorf("fragment: decompressed payload is too large")
+	}
+	return out, nil
+}
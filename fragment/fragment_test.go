@@ -0,0 +1,159 @@
+// fragment_test.go - Wire codec tests
+
+package fragment
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	mrand "math/rand"
+	"testing"
+
+	"github.com/yawning/sphincs256"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var sig [sphincs256.SignatureSize]byte
+	rand.Read(sig[:])
+
+	const mtu = 51 // LoRa, SF12 at 125 kHz.
+	frames, err := SplitSignature(&sig, mtu)
+	if err != nil {
+		t.Fatalf("SplitSignature() failed: %v", err)
+	}
+	for _, f := range frames {
+		if len(f) > mtu {
+			t.Fatalf("frame of %d bytes exceeds the mtu", len(f))
+		}
+	}
+
+	// Deliver half the frames out of order with duplicates, then save the
+	// state, as if the link dropped.
+	order := mrand.Perm(len(frames))
+	r := NewReassembler()
+	for _, i := range order[:len(order)/2] {
+		r.Add(frames[i])
+		r.Add(frames[i])
+	}
+	if _, _, err := r.Payload(); err != ErrIncomplete {
+		t.Fatalf("Payload() on incomplete transfer: got %v", err)
+	}
+	state, _ := r.MarshalBinary()
+
+	// Resume, and request only what is missing.
+	r = NewReassembler()
+	if err := r.UnmarshalBinary(state); err != nil {
+		t.Fatalf("UnmarshalBinary() failed: %v", err)
+	}
+	missing := r.Missing()
+	if len(missing) != len(frames)-len(frames)/2 {
+		t.Fatalf("Missing() returned %d frames, expected %d", len(missing), len(frames)-len(frames)/2)
+	}
+	for _, i := range missing {
+		bad := append([]byte{}, frames[i]...)
+		bad[HeaderSize] ^= 1
+		if _, err := r.Add(bad); err != ErrChecksum {
+			t.Fatalf("Add() accepted a corrupt frame: %v", err)
+		}
+		r.Add(frames[i])
+	}
+
+	kind, payload, err := r.Payload()
+	if err != nil {
+		t.Fatalf("Payload() failed: %v", err)
+	}
+	if kind != KindSignature || !bytes.Equal(payload, sig[:]) {
+		t.Fatalf("reassembled payload mismatch")
+	}
+}
+
+func TestMaxFrameSize(t *testing.T) {
+	payload := make([]byte, 2*(MaxFrameSize-Overhead))
+	rand.Read(payload)
+
+	frames, err := Split(KindRaw, payload, 1<<20)
+	if err != nil {
+		t.Fatalf("Split() failed: %v", err)
+	}
+	r := NewReassembler()
+	for _, f := range frames {
+		if len(f) != MaxFrameSize {
+			t.Fatalf("frame of %d bytes, expected %d", len(f), MaxFrameSize)
+		}
+		if _, err = r.Add(f); err != nil {
+			t.Fatalf("Add() failed: %v", err)
+		}
+	}
+
+	// Frames of the largest size survive saving and restoring the state.
+	state, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() failed: %v", err)
+	}
+	r = NewReassembler()
+	if err = r.UnmarshalBinary(state); err != nil {
+		t.Fatalf("UnmarshalBinary() failed: %v", err)
+	}
+	if _, got, err := r.Payload(); err != nil || !bytes.Equal(got, payload) {
+		t.Fatalf("reassembled payload mismatch: %v", err)
+	}
+
+	if _, err = NewReassembler().Add(append(frames[0], 0)); err == nil {
+		t.Errorf("Add() accepted a frame larger than MaxFrameSize")
+	}
+}
+
+func TestOversizedTransfer(t *testing.T) {
+	// A hostile sender claims the largest transfer of the largest frames.
+	frame := func(seq uint16, total uint16, n int) []byte {
+		f := make([]byte, HeaderSize, HeaderSize+n+crc32.Size)
+		f[0] = Version
+		binary.BigEndian.PutUint16(f[7:], seq)
+		binary.BigEndian.PutUint16(f[9:], total)
+		f = append(f, make([]byte, n)...)
+		return binary.BigEndian.AppendUint32(f, crc32.ChecksumIEEE(f))
+	}
+	if _, err := NewReassembler().Add(frame(0, MaxFrames, MaxFrameSize-Overhead)); err == nil {
+		t.Errorf("Add() accepted a frame of an oversized transfer")
+	}
+
+	// Frames that are each plausible are still bounded by the bytes
+	// received.
+	const total, n = 17, 65000
+	r := NewReassembler()
+	var err error
+	for i := uint16(0); err == nil && i < total; i++ {
+		_, err = r.Add(frame(i, total, n))
+	}
+	if err == nil {
+		t.Errorf("Add() buffered more than MaxPayloadSize bytes")
+	}
+}
+
+func TestCompression(t *testing.T) {
+	payload := bytes.Repeat([]byte("sphincs256 "), 100)
+	frames, err := Split(KindRaw, payload, 64)
+	if err != nil {
+		t.Fatalf("Split() failed: %v", err)
+	}
+	if n := (len(payload) + 63 - Overhead) / (64 - Overhead); len(frames) >= n {
+		t.Errorf("compressible payload not compressed: %d frames", len(frames))
+	}
+
+	other, _ := Split(KindRaw, []byte("another transfer"), 64)
+	r := NewReassembler()
+	for _, f := range frames {
+		if _, err := r.Add(f); err != nil {
+			t.Fatalf("Add() failed: %v", err)
+		}
+	}
+	if _, err := r.Add(other[0]); !errors.Is(err, ErrTransfer) {
+		t.Errorf("Add() accepted a frame of another transfer: %v", err)
+	}
+	_, out, err := r.Payload()
+	if err != nil || !bytes.Equal(out, payload) {
+		t.Fatalf("Payload() mismatch: %v", err)
+	}
+}
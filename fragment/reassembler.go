@@ -0,0 +1,150 @@
+// reassembler.go - Frame reassembly
+
+package fragment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Reassembler collects the frames of a single transfer, in any order and
+// with duplicates, and reconstructs the payload.  Its state can be saved
+// with MarshalBinary and restored with UnmarshalBinary, so that an
+// interrupted transfer can be resumed by requesting only the Missing frames.
+type Reassembler struct {
+	first    *Frame
+	frames   [][]byte
+	received int
+	size     int
+}
+
+// NewReassembler returns an empty Reassembler.
+func NewReassembler() *Reassembler {
+	return new(Reassembler)
+}
+
+// Add adds the encoded frame b, and returns true once every frame of the
+// transfer has been received.  The first frame added determines the
+// transfer, and frames of any other transfer are rejected with ErrTransfer.
+// Corrupt frames are rejected with ErrChecksum, and can simply be requested
+// again.  Frames of transfers that can not fit in MaxPayloadSize are
+// rejected before they are buffered.
+func (r *Reassembler) Add(b []byte) (bool, error) {
+	f, err := ParseFrame(b)
+	if err != nil {
+		return r.Done(), err
+	}
+	if n := minBodySize(f); n > MaxPayloadSize {
+		return r.Done(), fmt.Errorf("fragment: transfer of at least %d bytes is too large", n)
+	}
+
+	if r.first == nil {
+		r.first = f
+		r.frames = make([][]byte, f.Total)
+	} else if f.Transfer != r.first.Transfer || f.Kind != r.first.Kind || f.Compressed != r.first.Compressed || f.Total != r.first.Total {
+		return r.Done(), ErrTransfer
+	}
+
+	if r.frames[f.Sequence] == nil {
+		if r.size+len(f.Payload) > MaxPayloadSize {
+			return r.Done(), fmt.Errorf("fragment: transfer of more than %d bytes is too large", MaxPayloadSize)
+		}
+		r.frames[f.Sequence] = append([]byte{}, b...)
+		r.received++
+		r.size += len(f.Payload)
+	}
+	return r.Done(), nil
+}
+
+// minBodySize returns the smallest possible size of the body, compressed or
+// not, of the transfer that f belongs to.  Every frame but the last carries
+// the same amount of payload, and every frame carries some.  Split only
+// compresses payloads that shrink, so no valid body exceeds MaxPayloadSize.
+func minBodySize(f *Frame) int {
+	others := int(f.Total) - 1
+	if f.Sequence < f.Total-1 {
+		return others*len(f.Payload) + 1
+	}
+	return others + len(f.Payload)
+}
+
+// Done returns true iff every frame of the transfer has been received.
+func (r *Reassembler) Done() bool {
+	return r.first != nil && r.received == len(r.frames)
+}
+
+// Missing returns the sequence numbers of the frames not yet received, or
+// nil if no frame has been received, as the total is not yet known.
+func (r *Reassembler) Missing() []uint16 {
+	var m []uint16
+	for i, f := range r.frames {
+		if f == nil {
+			m = append(m, uint16(i))
+		}
+	}
+	return m
+}
+
+// Payload returns the kind and the reassembled payload of the transfer.
+// It returns ErrIncomplete if frames are missing.
+func (r *Reassembler) Payload() (Kind, []byte, error) {
+	if !r.Done() {
+		return 0, nil, ErrIncomplete
+	}
+
+	var body []byte
+	for _, b := range r.frames {
+		f, _ := ParseFrame(b)
+		body = append(body, f.Payload...)
+	}
+	if r.first.Compressed {
+		var err error
+		if body, err = decompress(body); err != nil {
+			return 0, nil, err
+		}
+	} else if len(body) > MaxPayloadSize {
+		return 0, nil, fmt.Errorf("fragment: payload of %d bytes is too large", len(body))
+	}
+
+	// The transfer ID covers the whole payload, which catches frames from
+	// different transfers that happen to share an ID.
+	if transferID(r.first.Kind, body) != r.first.Transfer {
+		return 0, nil, errors.New("fragment: reassembled payload does not match transfer")
+	}
+	return r.first.Kind, body, nil
+}
+
+// MarshalBinary encodes the frames received so far.
+func (r *Reassembler) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, f := range r.frames {
+		if f != nil {
+			binary.Write(&buf, binary.BigEndian, uint16(len(f)))
+			buf.Write(f)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the state of r with one previously encoded by
+// MarshalBinary.
+func (r *Reassembler) UnmarshalBinary(data []byte) error {
+	*r = Reassembler{}
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return fmt.Errorf("fragment: truncated reassembler state")
+		}
+		n := int(binary.BigEndian.Uint16(data))
+		data = data[2:]
+		if len(data) < n {
+			return fmt.Errorf("fragment: truncated reassembler state")
+		}
+		if _, err := r.Add(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
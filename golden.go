@@ -0,0 +1,118 @@
+// golden.go - Golden output self check
+
+package sphincs256
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// GoldenDiff is an output of GoldenCheck that differs from the one this
+// module is expected to produce.
+type GoldenDiff struct {
+	// Case is the name of the corpus entry.
+	Case string
+
+	// Output is the name of the output, such as "signature".
+	Output string
+
+	// Expected and Got are the hex encoded SHA-256 digests of the expected
+	// and actual output.
+	Expected string
+	Got      string
+}
+
+func (d *GoldenDiff) String() string {
+	return fmt.Sprintf("%s: %s: expected %s, got %s", d.Case, d.Output, d.Expected, d.Got)
+}
+
+type goldenCase struct {
+	name string
+
+	// offset is the first byte of the key generation entropy, which
+	// counts up from there.
+	offset byte
+
+	message   string
+	chunkSize int
+}
+
+var goldenCorpus = []goldenCase{
+	// The SUPERCOP known answer test.
+	{"kat", 0x00, "Cthulhu Fthagn --What a wonderful phrase!Cthulhu Fthagn --Say it and you're crazed!", 7},
+	{"empty", 0x5a, "", DefaultChunkSize},
+	{"binary", 0xa5, "\x00\x01\xfe\xff\x80\x7f\x00", 2},
+}
+
+// goldenDigests are the SHA-256 digests of the outputs of each corpus
+// entry, keyed by case and output name.
+var goldenDigests = map[string]string{
+	"kat/public key":           "7008d910fe7450054e0a7eb559ba175655f47561b0cc7c7cfb3cb8ed0444bb4f",
+	"kat/public key pem":       "fa2ab77dcedeca94f04a0badf145fa94eb07b9001d13be8bef16548e9b5252e1",
+	"kat/signature":            "d6e15fdc6156b8fc9a10514c82715d9afc8c36dc9fc1666b7e24e4b296ca8213",
+	"kat/chunked signature":    "0d7f8fa8504de777e564132c4c92fab6ffb23fcdf91a120b771749d4174c9112",
+	"empty/public key":         "8844a77d88e39b0d227848ec994fd1f01d5fe042c848265a2e9283959b6fabab",
+	"empty/public key pem":     "db3172bf3477eb477790e137bf56266bfe83e3317c065b9e56dc0afadbc09839",
+	"empty/signature":          "6f3e71ccdeb312c08cab374ae163bff45195e9b8f82dfd51014c7e043516125d",
+	"empty/chunked signature":  "c3b826e637f4645ccad9eb638e5e05110632c2e4551c201d0271e1106b722fb0",
+	"binary/public key":        "93034b4f98ac4bc2281461631ca69d7c20c6835ab7c19a821fdc37d2341b4661",
+	"binary/public key pem":    "7b27dc6be53624070de8a0dd3499e3beeca7cffee3cc52b3be0616c2e76d86e2",
+	"binary/signature":         "423244e7a02cbea221813aa601a59cefffe8b4cce42fed3948e49f3ae5f05a66",
+	"binary/chunked signature": "cc0bc4121a44bd12b3e850d2340d37e28e117d00661b677f4633befea1440590",
+}
+
+// GoldenCheck signs a fixed corpus with fixed keys, and compares the keys
+// and signatures to the outputs of this version of the module.  It returns
+// the outputs that differ, or nil if none do.
+//
+// Keys and signatures are deterministic, so any difference is a change to
+// the wire format.  Downstream test suites can call GoldenCheck to detect
+// such changes when upgrading.
+func GoldenCheck() []GoldenDiff {
+	var diffs []GoldenDiff
+	for _, c := range goldenCorpus {
+		for _, o := range c.outputs() {
+			key := c.name + "/" + o.name
+			got := sha256.Sum256(o.value)
+			if expected := goldenDigests[key]; expected != hex.EncodeToString(got[:]) {
+				diffs = append(diffs, GoldenDiff{
+					Case:     c.name,
+					Output:   o.name,
+					Expected: expected,
+					Got:      hex.EncodeToString(got[:]),
+				})
+			}
+		}
+	}
+	return diffs
+}
+
+type goldenOutput struct {
+	name  string
+	value []byte
+}
+
+func (c *goldenCase) outputs() []goldenOutput {
+	entropy := make([]byte, PrivateKeySize)
+	for i := range entropy {
+		entropy[i] = c.offset + byte(i)
+	}
+	pk, sk, err := GenerateKey(bytes.NewReader(entropy))
+	if err != nil {
+		panic("sphincs256: golden key generation failed: " + err.Error())
+	}
+
+	msg := []byte(c.message)
+	chunked, err := SignChunked(sk, msg, c.chunkSize)
+	if err != nil {
+		panic("sphincs256: golden chunked signing failed: " + err.Error())
+	}
+	return []goldenOutput{
+		{"public key", pk[:]},
+		{"public key pem", (*PublicKey)(pk).MarshalPEM()},
+		{"signature", Sign(sk, msg)[:]},
+		{"chunked signature", chunked[:]},
+	}
+}
@@ -0,0 +1,11 @@
+// golden_test.go - Golden output self check tests
+
+package sphincs256
+
+import "testing"
+
+func TestGoldenCheck(t *testing.T) {
+	for _, d := range GoldenCheck() {
+		t.Errorf("%v", &d)
+	}
+}
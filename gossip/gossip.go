@@ -0,0 +1,243 @@
+// gossip.go - Amortized SPHINCS-256 signing for gossip protocols
+
+// Package gossip implements amortized SPHINCS-256 signing for chatty
+// peer-to-peer protocols.  Outbound messages are accumulated for a short
+// window, and a single signature is made over the root of a Merkle tree of
+// the batch.  Each message then travels with the batch signature and a
+// compact proof of its inclusion in the batch, and verifiers only need to
+// check each batch signature once.
+//
+// The signed message is "sphincs256 gossip batch v1\x00" followed by the
+// number of messages in the batch as a 32 bit big endian integer and the
+// Merkle tree root.  The tree is built as in RFC 9162 with SHA-256.
+package gossip
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/internal/merkle"
+)
+
+// HashSize is the length of a Merkle tree hash in bytes.
+const HashSize = merkle.Size
+
+const (
+	// MaxBatchSize is the maximum number of messages in a batch.
+	MaxBatchSize = 1 << 20
+
+	signLabel = "sphincs256 gossip batch v1\x00"
+
+	maxCachedRoots = 4096
+)
+
+var (
+	// ErrInvalidProof is the error returned when an inclusion proof is
+	// malformed or does not match the message.
+	ErrInvalidProof = errors.New("gossip: invalid inclusion proof")
+
+	// ErrInvalidSignature is the error returned when a batch signature is
+	// invalid.
+	ErrInvalidSignature = errors.New("gossip: invalid batch signature")
+)
+
+// Proof is the proof that a message is included in a signed batch.
+type Proof struct {
+	Index uint32
+	Count uint32
+	Path  [][HashSize]byte
+}
+
+// MarshalBinary encodes the proof as the index and the count as 32 bit big
+// endian integers, followed by the audit path.
+func (p *Proof) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 8, 8+len(p.Path)*HashSize)
+	binary.BigEndian.PutUint32(b[0:], p.Index)
+	binary.BigEndian.PutUint32(b[4:], p.Count)
+	for i := range p.Path {
+		b = append(b, p.Path[i][:]...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a proof encoded by MarshalBinary.
+func (p *Proof) UnmarshalBinary(b []byte) error {
+	if len(b) < 8 || (len(b)-8)%HashSize != 0 || (len(b)-8)/HashSize > 32 {
+		return ErrInvalidProof
+	}
+	p.Index = binary.BigEndian.Uint32(b[0:])
+	p.Count = binary.BigEndian.Uint32(b[4:])
+	if p.Index >= p.Count || p.Count > MaxBatchSize {
+		return ErrInvalidProof
+	}
+	p.Path = make([][HashSize]byte, (len(b)-8)/HashSize)
+	for i := range p.Path {
+		copy(p.Path[i][:], b[8+i*HashSize:])
+	}
+	return nil
+}
+
+// Batch is a signed batch of messages.
+type Batch struct {
+	Root      [HashSize]byte
+	Signature *[sphincs256.SignatureSize]byte
+	Messages  [][]byte
+	Proofs    []Proof
+}
+
+// SignBatch signs a batch of messages with privateKey.
+func SignBatch(privateKey *[sphincs256.PrivateKeySize]byte, messages [][]byte) (*Batch, error) {
+	if len(messages) == 0 || len(messages) > MaxBatchSize {
+		return nil, errors.New("gossip: invalid batch size")
+	}
+
+	leaves := make([][HashSize]byte, len(messages))
+	for i, m := range messages {
+		leaves[i] = merkle.LeafHash(m)
+	}
+
+	paths := make([][][HashSize]byte, len(messages))
+	b := &Batch{
+		Root:     merkle.TreeHash(leaves, paths),
+		Messages: messages,
+		Proofs:   make([]Proof, len(messages)),
+	}
+	for i := range messages {
+		b.Proofs[i] = Proof{
+			Index: uint32(i),
+			Count: uint32(len(messages)),
+			Path:  paths[i],
+		}
+	}
+	b.Signature = sphincs256.Sign(privateKey, signedMessage(&b.Root, uint32(len(messages))))
+	return b, nil
+}
+
+func signedMessage(root *[HashSize]byte, count uint32) []byte {
+	m := make([]byte, 0, len(signLabel)+4+HashSize)
+	m = append(m, signLabel...)
+	m = binary.BigEndian.AppendUint32(m, count)
+	return append(m, root[:]...)
+}
+
+// RootOf recomputes the batch root that proof commits message to.
+func RootOf(message []byte, proof *Proof) ([HashSize]byte, error) {
+	if proof.Count > MaxBatchSize {
+		return [HashSize]byte{}, ErrInvalidProof
+	}
+	leaf := merkle.LeafHash(message)
+	root, ok := merkle.RootFromPath(&leaf, uint64(proof.Index), uint64(proof.Count), proof.Path)
+	if !ok {
+		return root, ErrInvalidProof
+	}
+	return root, nil
+}
+
+type rootKey struct {
+	root  [HashSize]byte
+	count uint32
+}
+
+// Verifier verifies messages from signed batches, checking each batch
+// signature only once.  It is safe for concurrent use.
+type Verifier struct {
+	publicKey [sphincs256.PublicKeySize]byte
+
+	mu       sync.Mutex
+	verified map[rootKey]bool
+}
+
+// NewVerifier returns a Verifier for batches signed by publicKey.  The key
+// is copied.
+func NewVerifier(publicKey *[sphincs256.PublicKeySize]byte) *Verifier {
+	v := &Verifier{verified: make(map[rootKey]bool)}
+	copy(v.publicKey[:], publicKey[:])
+	return v
+}
+
+// Verify returns nil iff message is included in a batch validly signed with
+// signature, as shown by proof.
+func (v *Verifier) Verify(message []byte, proof *Proof, signature *[sphincs256.SignatureSize]byte) error {
+	root, err := RootOf(message, proof)
+	if err != nil {
+		return err
+	}
+	k := rootKey{root, proof.Count}
+
+	v.mu.Lock()
+	ok := v.verified[k]
+	v.mu.Unlock()
+	if ok {
+		return nil
+	}
+
+	if !sphincs256.Verify(&v.publicKey, signedMessage(&root, proof.Count), signature) {
+		return ErrInvalidSignature
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.verified) >= maxCachedRoots {
+		v.verified = make(map[rootKey]bool)
+	}
+	v.verified[k] = true
+	return nil
+}
+
+// Batcher accumulates outbound messages, and signs them as one batch once
+// the window since the first pending message expires.  It is safe for
+// concurrent use.
+type Batcher struct {
+	privateKey [sphincs256.PrivateKeySize]byte
+	window     time.Duration
+	onBatch    func(*Batch, error)
+
+	mu      sync.Mutex
+	pending [][]byte
+	timer   *time.Timer
+}
+
+// NewBatcher returns a Batcher that signs with privateKey, and hands each
+// signed batch to onBatch.  onBatch is called from the Batcher's timer
+// goroutine, or from the goroutine calling Add or Flush.  The key is
+// copied.
+func NewBatcher(privateKey *[sphincs256.PrivateKeySize]byte, window time.Duration, onBatch func(*Batch, error)) *Batcher {
+	b := &Batcher{window: window, onBatch: onBatch}
+	copy(b.privateKey[:], privateKey[:])
+	return b
+}
+
+// Add queues a message for the next batch.  The batch is signed immediately
+// if it reaches MaxBatchSize messages.
+func (b *Batcher) Add(message []byte) {
+	b.mu.Lock()
+	b.pending = append(b.pending, message)
+	full := len(b.pending) >= MaxBatchSize
+	if !full && b.timer == nil {
+		b.timer = time.AfterFunc(b.window, b.Flush)
+	}
+	b.mu.Unlock()
+
+	if full {
+		b.Flush()
+	}
+}
+
+// Flush signs all pending messages immediately.
+func (b *Batcher) Flush() {
+	b.mu.Lock()
+	msgs := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+
+	if len(msgs) > 0 {
+		b.onBatch(SignBatch(&b.privateKey, msgs))
+	}
+}
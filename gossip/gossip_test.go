@@ -0,0 +1,84 @@
+// gossip_test.go - Amortized gossip signing tests
+
+package gossip
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yawning/sphincs256"
+)
+
+func TestBatch(t *testing.T) {
+	pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+
+	for _, n := range []int{1, 2, 5, 8, 13} {
+		var msgs [][]byte
+		for i := 0; i < n; i++ {
+			msgs = append(msgs, []byte(fmt.Sprintf("message %d of %d", i, n)))
+		}
+		b, err := SignBatch(sk, msgs)
+		if err != nil {
+			t.Fatalf("failed SignBatch(): %s", err)
+		}
+
+		v := NewVerifier(pk)
+		for i := range msgs {
+			enc, _ := b.Proofs[i].MarshalBinary()
+			var p Proof
+			if err = p.UnmarshalBinary(enc); err != nil {
+				t.Fatalf("failed UnmarshalBinary(): %s", err)
+			}
+			if err = v.Verify(msgs[i], &p, b.Signature); err != nil {
+				t.Errorf("n = %d: failed Verify(%d): %s", n, i, err)
+			}
+			if err = v.Verify([]byte("forged"), &p, b.Signature); err == nil {
+				t.Errorf("n = %d: Verify(%d) accepted a forged message", n, i)
+			}
+			if n > 1 {
+				p.Index = (p.Index + 1) % p.Count
+				if err = v.Verify(msgs[i], &p, b.Signature); err == nil {
+					t.Errorf("n = %d: Verify(%d) accepted a wrong index", n, i)
+				}
+			}
+		}
+	}
+}
+
+func TestBatcher(t *testing.T) {
+	pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+
+	// The Batcher and Verifier hold their own copies of the keys.
+	key, pub := *sk, *pk
+	ch := make(chan *Batch, 1)
+	b := NewBatcher(&key, 10*time.Millisecond, func(batch *Batch, err error) {
+		if err != nil {
+			t.Errorf("failed to sign batch: %s", err)
+		}
+		ch <- batch
+	})
+	v := NewVerifier(&pub)
+	key, pub = [sphincs256.PrivateKeySize]byte{}, [sphincs256.PublicKeySize]byte{}
+	b.Add([]byte("one"))
+	b.Add([]byte("two"))
+
+	select {
+	case batch := <-ch:
+		if len(batch.Messages) != 2 {
+			t.Fatalf("batch has %d messages, expected 2", len(batch.Messages))
+		}
+		if err = v.Verify(batch.Messages[0], &batch.Proofs[0], batch.Signature); err != nil {
+			t.Errorf("failed Verify(): %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("batch window never expired")
+	}
+}
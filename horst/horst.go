@@ -3,6 +3,8 @@
 package horst
 
 import (
+	"crypto/subtle"
+
 	"github.com/yawning/sphincs256/chacha"
 	"github.com/yawning/sphincs256/hash"
 	"github.com/yawning/sphincs256/utils"
@@ -18,37 +20,68 @@ const (
 	K        = 32
 	SkBytes  = 32
 	SigBytes = 64*hash.Size + (((LogT-6)*hash.Size)+SkBytes)*K
+
+	// ArenaSize is the size of an Arena in bytes.
+	ArenaSize = T*SkBytes + (2*T-1)*hash.Size
+
+	// minParallelNodes is the smallest tree level that SignParallel spreads
+	// over multiple goroutines.
+	minParallelNodes = 256
 )
 
+// Arena is the scratch space used to build a HORST tree: the expanded
+// secret key and every node of the tree.  It is ArenaSize bytes, by far the
+// largest allocation made when signing, and can be reused across calls.  An
+// Arena must not be used by more than one call at a time.
+type Arena struct {
+	sk   [T * SkBytes]byte
+	tree [(2*T - 1) * hash.Size]byte
+}
+
 func expandSeed(outseeds []byte, inseed *[SeedBytes]byte) {
 //	outseeds = outseeds[:T*SkBytes]
 	chacha.Prg(outseeds[0:T*SkBytes], inseed[:])
 }
 
 func Sign(sig []byte, pk *[hash.Size]byte, m []byte, seed *[SeedBytes]byte, masks []byte, mHash []byte) {
+	new(Arena).Sign(sig, pk, m, seed, masks, mHash, 1)
+}
+
+// SignParallel is Sign, with the leaf and tree hashing spread over up to
+// workers goroutines.  The output is identical to that of Sign.
+func SignParallel(sig []byte, pk *[hash.Size]byte, m []byte, seed *[SeedBytes]byte, masks []byte, mHash []byte, workers int) {
+	new(Arena).Sign(sig, pk, m, seed, masks, mHash, workers)
+}
+
+// Sign is SignParallel, using the arena a as scratch space instead of
+// allocating it.  The secret key material in a is zeroed before returning.
+func (a *Arena) Sign(sig []byte, pk *[hash.Size]byte, m []byte, seed *[SeedBytes]byte, masks []byte, mHash []byte, workers int) {
 //	masks = masks[:2*LogT*hash.Size]
 //	mHash = mHash[:hash.MsgSize]
 
-	var sk [T * SkBytes]byte
+	sk, tree := &a.sk, &a.tree
 	sigpos := 0
 
 	expandSeed(sk[:], seed)
+	defer utils.Zerobytes(sk[:])
 
 	// Build the whole tree and save it.
-	var tree [(2*T - 1) * hash.Size]byte // replace by something more memory-efficient?
 
 	// Generate pk leaves.
-	for i := 0; i < T; i++ {
+	utils.ParallelFor(workers, T, func(i int) {
 		hash.Hash_n_n(tree[(T-1+i)*hash.Size:], sk[i*SkBytes:])
-	}
+	})
 
-	var offsetIn, offsetOut uint64
 	for i := uint(0); i < LogT; i++ {
-		offsetIn = (1 << (LogT - i)) - 1
-		offsetOut = (1 << (LogT - i - 1)) - 1
-		for j := uint64(0); j < 1<<(LogT-i-1); j++ {
-			hash.Hash_2n_n_mask(tree[(offsetOut+j)*hash.Size:], tree[(offsetIn+2*j)*hash.Size:], masks[2*i*hash.Size:])
+		offsetIn := (1 << (LogT - i)) - 1
+		offsetOut := (1 << (LogT - i - 1)) - 1
+		w := workers
+		if 1<<(LogT-i-1) < minParallelNodes {
+			w = 1
 		}
+		utils.ParallelFor(w, 1<<(LogT-i-1), func(j int) {
+			hash.Hash_2n_n_mask(tree[(offsetOut+j)*hash.Size:], tree[(offsetIn+2*j)*hash.Size:], masks[2*i*hash.Size:])
+		})
 	}
 
 	// First write 64 hashes from level 10 to the signature.
@@ -80,13 +113,27 @@ func Sign(sig []byte, pk *[hash.Size]byte, m []byte, seed *[SeedBytes]byte, mask
 	copy(pk[0:hash.Size], tree[0:hash.Size])
 }
 
+// Verify computes the HORST public key pk from the signature sig of mHash.
+// It returns 0 if the signature is valid, and otherwise zeroes pk and
+// returns -1.
 func Verify(pk, sig, m, masks, mHash []byte) int {
+	if VerifyIndex(pk, sig, m, masks, mHash) >= 0 {
+		return -1
+	}
+	return 0
+}
+
+// VerifyIndex is Verify, but returns -1 if the signature is valid, and
+// otherwise the index of the first of the K signature parts that is
+// invalid.
+func VerifyIndex(pk, sig, m, masks, mHash []byte) int {
 //	masks = masks[:2*LogT*hash.Size]
 //	mHash = mHash[:hash.MsgSize]
 
-	// XXX/Yawning: I have no idea why this has a clear cutfail case and a
-	// return value if the calling code doesn't ever actually check it.
+	// Note: Unlike the original code, this always runs to completion so that
+	// the time taken does not depend on where verification failed.
 	var buffer [32 * hash.Size]byte
+	bad := -1
 	level10 := sig
 	sig = sig[64*hash.Size:]
 
@@ -118,10 +165,8 @@ func Verify(pk, sig, m, masks, mHash []byte) int {
 		idx = idx >> 1 // parent node
 		hash.Hash_2n_n_mask(buffer[:], buffer[:], masks[2*(LogT-7)*hash.Size:])
 
-		for k := uint(0); k < hash.Size; k++ {
-			if level10[idx*hash.Size+k] != buffer[k] {
-				goto fail // XXX/Yawning: Gratuitious goto...
-			}
+		if subtle.ConstantTimeCompare(level10[idx*hash.Size:(idx+1)*hash.Size], buffer[:hash.Size]) != 1 && bad < 0 {
+			bad = i
 		}
 	}
 
@@ -148,11 +193,10 @@ func Verify(pk, sig, m, masks, mHash []byte) int {
 	// Hash from level 15 to 16
 	hash.Hash_2n_n_mask(pk, buffer[:], masks[2*(LogT-1)*hash.Size:])
 
-	return 0
-
-fail:
-	utils.Zerobytes(pk[0:hash.Size])
-	return -1
+	if bad >= 0 {
+		utils.Zerobytes(pk[0:hash.Size])
+	}
+	return bad
 }
 
 func init() {
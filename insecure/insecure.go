@@ -0,0 +1,94 @@
+// insecure.go - Insecure SPHINCS-256 stand-in for tests
+
+// Package insecure implements a trivially fast, COMPLETELY INSECURE stand-in
+// for the sphincs256 package, with identical function signatures and key and
+// signature sizes.
+//
+// It exists so that integration and CI suites that create thousands of keys
+// do not spend minutes in real key generation.  Anyone can forge signatures
+// given only the public key.  It must never be used outside of tests.
+package insecure
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/yawning/sphincs256"
+)
+
+const (
+	// PublicKeySize is the length of a public key in bytes.
+	PublicKeySize = sphincs256.PublicKeySize
+
+	// PrivateKeySize is the length of a private key in bytes.
+	PrivateKeySize = sphincs256.PrivateKeySize
+
+	// SignatureSize is the length of a signature in bytes.
+	SignatureSize = sphincs256.SignatureSize
+
+	pkLabel  = "sphincs256 insecure public key"
+	sigLabel = "sphincs256 insecure signature"
+)
+
+// expand fills out with SHA-256 in counter mode over label and in.
+func expand(out []byte, label string, in ...[]byte) {
+	var ctr [8]byte
+	for i := uint64(0); len(out) > 0; i++ {
+		binary.BigEndian.PutUint64(ctr[:], i)
+		h := sha256.New()
+		h.Write([]byte(label))
+		h.Write(ctr[:])
+		for _, b := range in {
+			h.Write(b)
+		}
+		out = out[copy(out, h.Sum(nil)):]
+	}
+}
+
+// GenerateKey generates a public/private key pair using randomness from rand.
+func GenerateKey(rand io.Reader) (publicKey *[PublicKeySize]byte, privateKey *[PrivateKeySize]byte, err error) {
+	privateKey = new([PrivateKeySize]byte)
+	publicKey = new([PublicKeySize]byte)
+	_, err = io.ReadFull(rand, privateKey[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	expand(publicKey[:], pkLabel, privateKey[:])
+	return
+}
+
+// Sign signs the message with privateKey and returns the signature.
+func Sign(privateKey *[PrivateKeySize]byte, message []byte) *[SignatureSize]byte {
+	var pk [PublicKeySize]byte
+	var sig [SignatureSize]byte
+	expand(pk[:], pkLabel, privateKey[:])
+	expand(sig[:], sigLabel, pk[:], message)
+	return &sig
+}
+
+// Verify takes a public key, message and signature and returns true if the
+// signature is valid.
+func Verify(publicKey *[PublicKeySize]byte, message []byte, signature *[SignatureSize]byte) bool {
+	var sig [SignatureSize]byte
+	expand(sig[:], sigLabel, publicKey[:], message)
+	return subtle.ConstantTimeCompare(sig[:], signature[:]) == 1
+}
+
+// Open takes a signed message and public key and returns the message if the
+// signature is valid.
+func Open(publicKey *[PublicKeySize]byte, message []byte) (body []byte, err error) {
+	if len(message) < SignatureSize {
+		return nil, fmt.Errorf("insecure: message length is too short to be valid")
+	}
+
+	var sig [SignatureSize]byte
+	copy(sig[:], message[:SignatureSize])
+	body = message[SignatureSize:]
+	if !Verify(publicKey, body, &sig) {
+		return nil, fmt.Errorf("insecure: signature verification failed")
+	}
+	return body, nil
+}
@@ -0,0 +1,34 @@
+// insecure_test.go - Insecure stand-in tests
+
+package insecure
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestSignVerifyOpen(t *testing.T) {
+	const msg = "The most merciful thing in the world is the inability of the human mind to correlate all its contents."
+
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	sig := Sign(sk, []byte(msg))
+	if !Verify(pk, []byte(msg), sig) {
+		t.Errorf("failed Verify()")
+	}
+	if Verify(pk, []byte(msg[1:]), sig) {
+		t.Errorf("Verify() accepted a different message")
+	}
+
+	sm := append(append([]byte{}, sig[:]...), msg...)
+	opened, err := Open(pk, sm)
+	if err != nil {
+		t.Fatalf("failed Open(): %s", err)
+	}
+	if !bytes.Equal(opened, []byte(msg)) {
+		t.Fatalf("opened message does not match test message")
+	}
+}
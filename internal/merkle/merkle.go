@@ -0,0 +1,110 @@
+// merkle.go - RFC 9162 style Merkle trees
+
+// Package merkle implements the RFC 9162 Merkle tree hashing and inclusion
+// proofs shared by the gossip and transparency packages.
+package merkle
+
+import "crypto/sha256"
+
+// Size is the length of a Merkle tree hash in bytes.
+const Size = sha256.Size
+
+// LeafHash returns the hash of the leaf with data b.
+func LeafHash(b []byte) (out [Size]byte) {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(b)
+	h.Sum(out[:0])
+	return
+}
+
+// NodeHash returns the hash of the interior node with children l and r.
+func NodeHash(l, r *[Size]byte) (out [Size]byte) {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(l[:])
+	h.Write(r[:])
+	h.Sum(out[:0])
+	return
+}
+
+// split returns the largest power of two smaller than n, for n > 1.
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// TreeHash returns the root of the tree with leaves, and appends the audit
+// path of each leaf to the corresponding entry of paths, leaf to root.
+// paths may be nil if the audit paths are not needed.
+func TreeHash(leaves [][Size]byte, paths [][][Size]byte) [Size]byte {
+	n := len(leaves)
+	if n == 1 {
+		return leaves[0]
+	}
+
+	k := split(n)
+	var lp, rp [][][Size]byte
+	if paths != nil {
+		lp, rp = paths[:k], paths[k:]
+	}
+	l := TreeHash(leaves[:k], lp)
+	r := TreeHash(leaves[k:], rp)
+	for i := range lp {
+		lp[i] = append(lp[i], r)
+	}
+	for i := range rp {
+		rp[i] = append(rp[i], l)
+	}
+	return NodeHash(&l, &r)
+}
+
+// AuditPath returns the root of the tree with leaves, and the audit path of
+// the leaf at index, leaf to root.
+func AuditPath(leaves [][Size]byte, index int) ([Size]byte, [][Size]byte) {
+	n := len(leaves)
+	if n == 1 {
+		return leaves[0], nil
+	}
+
+	k := split(n)
+	if index < k {
+		l, path := AuditPath(leaves[:k], index)
+		r := TreeHash(leaves[k:], nil)
+		return NodeHash(&l, &r), append(path, r)
+	}
+	l := TreeHash(leaves[:k], nil)
+	r, path := AuditPath(leaves[k:], index-k)
+	return NodeHash(&l, &r), append(path, l)
+}
+
+// RootFromPath returns the root of the tree of size count implied by path
+// being the audit path of leaf at index, and false if path is malformed.
+func RootFromPath(leaf *[Size]byte, index, count uint64, path [][Size]byte) ([Size]byte, bool) {
+	r := *leaf
+	if index >= count {
+		return r, false
+	}
+
+	fn, sn := index, count-1
+	for i := range path {
+		if sn == 0 {
+			return r, false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = NodeHash(&path[i], &r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = NodeHash(&r, &path[i])
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return r, sn == 0
+}
@@ -0,0 +1,31 @@
+// merkle_test.go - RFC 9162 style Merkle tree tests
+
+package merkle
+
+import "testing"
+
+func TestRootFromPath(t *testing.T) {
+	leaves := make([][Size]byte, 13)
+	for i := range leaves {
+		leaves[i] = LeafHash([]byte{byte(i)})
+	}
+	for n := 1; n <= len(leaves); n++ {
+		paths := make([][][Size]byte, n)
+		treeRoot := TreeHash(leaves[:n], paths)
+		for i := 0; i < n; i++ {
+			root, path := AuditPath(leaves[:n], i)
+			if root != treeRoot || len(path) != len(paths[i]) {
+				t.Fatalf("AuditPath() and TreeHash() disagree for leaf %d of %d", i, n)
+			}
+			if r, ok := RootFromPath(&leaves[i], uint64(i), uint64(n), path); !ok || r != root {
+				t.Fatalf("RootFromPath() mismatch for leaf %d of %d", i, n)
+			}
+			if r, ok := RootFromPath(&leaves[i], uint64(i), uint64(n), append(path, root)); ok && r == root {
+				t.Fatalf("RootFromPath() accepted an overlong path for leaf %d of %d", i, n)
+			}
+			if _, ok := RootFromPath(&leaves[i], uint64(n), uint64(n), path); ok {
+				t.Fatalf("RootFromPath() accepted an out of range index for leaf %d of %d", i, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// key.go - crypto.Signer compatible key types
+
+package sphincs256
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/subtle"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/yawning/sphincs256/ctencoding"
+	"github.com/yawning/sphincs256/utils"
+)
+
+const (
+	// PublicKeyPEMType is the PEM block type of encoded public keys.
+	PublicKeyPEMType = "SPHINCS-256 PUBLIC KEY"
+
+	// PrivateKeyPEMType is the PEM block type of encoded private keys.
+	PrivateKeyPEMType = "SPHINCS-256 PRIVATE KEY"
+)
+
+// PublicKey is a SPHINCS-256 public key.  A *[PublicKeySize]byte can be
+// converted to a *PublicKey and back without copying.
+//
+// There is no registered algorithm identifier for SPHINCS-256, so keys are
+// serialized as the raw key bytes, optionally PEM encoded.
+type PublicKey [PublicKeySize]byte
+
+// PrivateKey is a SPHINCS-256 private key.  It implements crypto.Signer.  A
+// *[PrivateKeySize]byte can be converted to a *PrivateKey and back without
+// copying.
+type PrivateKey [PrivateKeySize]byte
+
+// Bytes returns a copy of the encoded public key.
+func (pub *PublicKey) Bytes() []byte {
+	return append([]byte{}, pub[:]...)
+}
+
+// Equal returns true iff x is a *PublicKey with the same value as pub.
+func (pub *PublicKey) Equal(x crypto.PublicKey) bool {
+	xx, ok := x.(*PublicKey)
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare(pub[:], xx[:]) == 1
+}
+
+// MarshalPEM returns the PEM encoded public key.
+func (pub *PublicKey) MarshalPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: PublicKeyPEMType, Bytes: pub[:]})
+}
+
+// Bytes returns a copy of the encoded private key.
+func (priv *PrivateKey) Bytes() []byte {
+	return append([]byte{}, priv[:]...)
+}
+
+// Equal returns true iff x is a *PrivateKey with the same value as priv.
+func (priv *PrivateKey) Equal(x crypto.PrivateKey) bool {
+	xx, ok := x.(*PrivateKey)
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare(priv[:], xx[:]) == 1
+}
+
+// Public returns the *PublicKey corresponding to priv.  The public key is
+// recomputed on each call, which costs about as much as key generation.
+func (priv *PrivateKey) Public() crypto.PublicKey {
+	pub := new(PublicKey)
+	derivePublicKey(pub[:], priv[:])
+	return pub
+}
+
+// Sign signs message with priv, and returns the signature.  SPHINCS-256
+// signs the message itself rather than a digest, so opts.HashFunc() must
+// return 0.  rand is ignored, as signing is deterministic.
+//
+// This method implements crypto.Signer.
+func (priv *PrivateKey) Sign(rand io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.Hash(0) {
+		return nil, errors.New("sphincs256: cannot sign hashed message")
+	}
+	if err := checkSign((*[PrivateKeySize]byte)(priv), nil, message); err != nil {
+		return nil, err
+	}
+	sig := Sign((*[PrivateKeySize]byte)(priv), message)
+	return sig[:], nil
+}
+
+// MarshalPEM returns the PEM encoded private key.  The key is encoded in
+// constant time.
+func (priv *PrivateKey) MarshalPEM() []byte {
+	b := []byte("-----BEGIN " + PrivateKeyPEMType + "-----\n")
+	b = append(b, ctencoding.EncodeBase64(priv[:], 64)...)
+	return append(b, "-----END "+PrivateKeyPEMType+"-----\n"...)
+}
+
+// ParsePublicKey parses an encoded public key.
+func ParsePublicKey(b []byte) (*PublicKey, error) {
+	if len(b) != PublicKeySize {
+		return nil, fmt.Errorf("sphincs256: invalid public key length: %d", len(b))
+	}
+	pub := new(PublicKey)
+	copy(pub[:], b)
+	return pub, nil
+}
+
+// ParsePrivateKey parses an encoded private key.
+func ParsePrivateKey(b []byte) (*PrivateKey, error) {
+	if len(b) != PrivateKeySize {
+		return nil, fmt.Errorf("sphincs256: invalid private key length: %d", len(b))
+	}
+	priv := new(PrivateKey)
+	copy(priv[:], b)
+	return priv, nil
+}
+
+// ParsePublicKeyPEM parses the first PEM encoded public key in data.
+func ParsePublicKeyPEM(data []byte) (*PublicKey, error) {
+	b, err := decodePEM(data, PublicKeyPEMType)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(b)
+}
+
+// ParsePrivateKeyPEM parses the first PEM encoded private key in data.  The
+// key is decoded in constant time, so unlike ParsePublicKeyPEM, PEM headers
+// are not supported.
+func ParsePrivateKeyPEM(data []byte) (*PrivateKey, error) {
+	begin, end := []byte("-----BEGIN "), []byte("-----END "+PrivateKeyPEMType+"-----")
+	i := bytes.Index(data, begin)
+	if i < 0 {
+		return nil, errors.New("sphincs256: no PEM data found")
+	}
+	data = data[i+len(begin):]
+	if !bytes.HasPrefix(data, []byte(PrivateKeyPEMType+"-----")) {
+		typ, _, _ := bytes.Cut(data, []byte("-----"))
+		return nil, fmt.Errorf("sphincs256: unexpected PEM block type: %s", typ)
+	}
+	data = bytes.TrimLeft(data[len(PrivateKeyPEMType)+5:], "\r\n")
+	body, _, ok := bytes.Cut(data, end)
+	if !ok {
+		return nil, errors.New("sphincs256: no PEM data found")
+	}
+
+	b, err := ctencoding.DecodeBase64(body)
+	if err != nil {
+		return nil, fmt.Errorf("sphincs256: invalid PEM data: %w", err)
+	}
+	defer utils.Zerobytes(b)
+	return ParsePrivateKey(b)
+}
+
+func decodePEM(data []byte, blockType string) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("sphincs256: no PEM data found")
+	}
+	if block.Type != blockType {
+		return nil, fmt.Errorf("sphincs256: unexpected PEM block type: %s", block.Type)
+	}
+	return block.Bytes, nil
+}
+
+var _ crypto.Signer = (*PrivateKey)(nil)
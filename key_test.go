@@ -0,0 +1,125 @@
+// key_test.go - crypto.Signer compatible key type tests
+
+package sphincs256
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestKeyTypes(t *testing.T) {
+	const msg = "I am providence."
+
+	pkArr, skArr, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	pub, priv := (*PublicKey)(pkArr), (*PrivateKey)(skArr)
+
+	if !pub.Equal(priv.Public()) {
+		t.Errorf("Public() does not match the generated public key")
+	}
+
+	var signer crypto.Signer = priv
+	sig, err := signer.Sign(rand.Reader, []byte(msg), crypto.Hash(0))
+	if err != nil {
+		t.Fatalf("failed Sign(): %s", err)
+	}
+	var sigArr [SignatureSize]byte
+	copy(sigArr[:], sig)
+	if !Verify(pkArr, []byte(msg), &sigArr) {
+		t.Errorf("failed Verify()")
+	}
+	if _, err = signer.Sign(rand.Reader, []byte(msg), crypto.SHA256); err == nil {
+		t.Errorf("Sign() accepted a prehashed message")
+	}
+
+	pub2, err := ParsePublicKeyPEM(pub.MarshalPEM())
+	if err != nil || !pub.Equal(pub2) {
+		t.Errorf("public key PEM round trip failed: %v", err)
+	}
+	priv2, err := ParsePrivateKeyPEM(priv.MarshalPEM())
+	if err != nil || !priv.Equal(priv2) {
+		t.Errorf("private key PEM round trip failed: %v", err)
+	}
+	if !bytes.Equal(priv.MarshalPEM(), pem.EncodeToMemory(&pem.Block{Type: PrivateKeyPEMType, Bytes: priv[:]})) {
+		t.Errorf("private key PEM does not match encoding/pem")
+	}
+	if _, err = ParsePrivateKeyPEM(pub.MarshalPEM()); err == nil {
+		t.Errorf("ParsePrivateKeyPEM() accepted a public key")
+	}
+	if _, err = ParsePublicKey(pub.Bytes()[1:]); err == nil {
+		t.Errorf("ParsePublicKey() accepted a truncated key")
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	msg := bytes.Repeat([]byte("The Thing on the Doorstep. "), 4096)
+
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+
+	r := bytes.NewReader(append([]byte("skipped"), msg...))
+	r.Seek(int64(len("skipped")), 0)
+	sig, err := SignReader(sk, r)
+	if err != nil {
+		t.Fatalf("failed SignReader(): %s", err)
+	}
+	if !bytes.Equal(sig[:], Sign(sk, msg)[:]) {
+		t.Errorf("SignReader() does not match Sign()")
+	}
+
+	if err = VerifyReader(pk, bytes.NewReader(msg), sig); err != nil {
+		t.Errorf("failed VerifyReader(): %s", err)
+	}
+	v := NewVerifier(pk, sig)
+	v.Write(msg[:100])
+	if err = v.Verify(); err == nil {
+		t.Errorf("Verify() accepted a partial message")
+	}
+	v.Write(msg[100:])
+	sig[SignatureSize-1] ^= 1 // The Verifier holds its own copy.
+	if err = v.Verify(); err != nil {
+		t.Errorf("failed Verify(): %s", err)
+	}
+	sig[SignatureSize-1] ^= 1
+
+	// A message that changes or grows between the passes is not signed.
+	for _, second := range [][]byte{append([]byte{'t'}, msg[1:]...), append(msg, '!')} {
+		r := &changingReader{first: msg, second: second}
+		if _, err = SignReader(sk, r); !errors.Is(err, ErrMessageChanged) {
+			t.Errorf("SignReader() of a changing message: got %v", err)
+		}
+	}
+}
+
+// changingReader reads first, and second after seeking back to the start.
+type changingReader struct {
+	*bytes.Reader
+	first, second []byte
+}
+
+func (r *changingReader) Read(p []byte) (int, error) {
+	if r.Reader == nil {
+		r.Reader = bytes.NewReader(r.first)
+	}
+	return r.Reader.Read(p)
+}
+
+func (r *changingReader) Seek(offset int64, whence int) (int64, error) {
+	if r.Reader == nil {
+		r.Reader = bytes.NewReader(r.first)
+		return r.Reader.Seek(offset, whence)
+	}
+	pos, err := r.Reader.Seek(offset, whence)
+	if pos == 0 {
+		r.Reader = bytes.NewReader(r.second)
+	}
+	return pos, err
+}
@@ -0,0 +1,128 @@
+// limits.go - Resource limits
+
+package sphincs256
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/yawning/sphincs256/hash"
+	"github.com/yawning/sphincs256/horst"
+	"github.com/yawning/sphincs256/wots"
+)
+
+const (
+	// SignMemory is the approximate scratch memory used to sign a message
+	// in bytes, most of it the HORST tree (see horst.ArenaSize).
+	SignMemory = horst.ArenaSize + nLevels*2*(1<<subtreeHeight)*hash.Size + SignatureSize + PrivateKeySize + PublicKeySize
+
+	// VerifyMemory is the approximate scratch memory used to verify a
+	// signature in bytes.
+	VerifyMemory = PublicKeySize + wots.L*hash.Size + 3*hash.Size
+)
+
+// ErrLimitExceeded is matched by the LimitError returned when an input or
+// an operation exceeds a Limits.
+var ErrLimitExceeded = errors.New("sphincs256: resource limit exceeded")
+
+// Limits are resource limits for operations on untrusted input, so that
+// internet facing services can bound the work an attacker can cause.  A
+// zero field means no limit.
+type Limits struct {
+	// MaxMessageSize is the largest message accepted in bytes.
+	MaxMessageSize int64
+
+	// MaxEnvelopeSize is the largest signed message, the signature and the
+	// message together, accepted in bytes.
+	MaxEnvelopeSize int64
+
+	// MaxMemory is the largest amount of scratch memory an operation may
+	// use in bytes.  Operations that need more (see SignMemory and
+	// VerifyMemory) are refused before doing any work.
+	MaxMemory int64
+}
+
+// LimitError is the error returned when a Limits is exceeded.  It matches
+// ErrLimitExceeded.
+type LimitError struct {
+	// Resource is "message", "envelope" or "memory".
+	Resource string
+
+	// Size is the size that exceeded the limit, which for streamed input
+	// is the size read so far.
+	Size int64
+
+	// Limit is the limit that was exceeded.
+	Limit int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("sphincs256: %s of %d bytes exceeds the limit of %d bytes", e.Resource, e.Size, e.Limit)
+}
+
+// Is returns true iff target is ErrLimitExceeded.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+func checkLimit(resource string, size, limit int64) error {
+	if limit > 0 && size > limit {
+		return &LimitError{Resource: resource, Size: size, Limit: limit}
+	}
+	return nil
+}
+
+// check returns a LimitError if a message of messageSize bytes, or an
+// operation using memory bytes, exceeds l.  A nil l has no limits.
+func (l *Limits) check(messageSize, memory int64) error {
+	if l == nil {
+		return nil
+	}
+	if err := checkLimit("memory", memory, l.MaxMemory); err != nil {
+		return err
+	}
+	return checkLimit("message", messageSize, l.MaxMessageSize)
+}
+
+// limitedReader reads from r, failing with a LimitError once more than
+// limit bytes have been read.
+type limitedReader struct {
+	r        io.Reader
+	resource string
+	n, limit int64
+}
+
+// limitReader returns r limited to l's limit for resource, or r itself if
+// there is no such limit.
+func limitReader(r io.Reader, l *Limits, resource string) io.Reader {
+	if l == nil {
+		return r
+	}
+	limit := l.MaxMessageSize
+	if resource == "envelope" {
+		limit = l.MaxEnvelopeSize
+	}
+	if limit <= 0 {
+		return r
+	}
+	return &limitedReader{r: r, resource: resource, limit: limit}
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if lr.n > lr.limit {
+		return 0, &LimitError{Resource: lr.resource, Size: lr.n, Limit: lr.limit}
+	}
+
+	// Read one byte past the limit, so that a stream of exactly the limit
+	// is accepted.
+	if max := lr.limit + 1 - lr.n; int64(len(p)) > max {
+		p = p[:max]
+	}
+	n, err := lr.r.Read(p)
+	lr.n += int64(n)
+	if lr.n > lr.limit {
+		return 0, &LimitError{Resource: lr.resource, Size: lr.n, Limit: lr.limit}
+	}
+	return n, err
+}
@@ -0,0 +1,85 @@
+// limits_test.go - Resource limit tests
+
+package sphincs256
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	msg := bytes.Repeat([]byte("x"), 100)
+	sig := Sign(sk, msg)
+	sm := append(append([]byte{}, sig[:]...), msg...)
+
+	isLimit := func(what string, err error, resource string) {
+		t.Helper()
+		var le *LimitError
+		if !errors.Is(err, ErrLimitExceeded) || !errors.As(err, &le) || le.Resource != resource {
+			t.Errorf("%s: got %v, expected a %s limit error", what, err, resource)
+		}
+	}
+
+	// Limits that are exactly met are accepted.
+	exact := &VerifyOptions{Limits: &Limits{MaxMessageSize: 100, MaxEnvelopeSize: int64(len(sm)), MaxMemory: VerifyMemory}}
+	if err = VerifyWithOptions(pk, msg, sig, exact); err != nil {
+		t.Errorf("VerifyWithOptions() at the limits failed: %v", err)
+	}
+	if _, err = OpenWithOptions(pk, sm, exact); err != nil {
+		t.Errorf("OpenWithOptions() at the limits failed: %v", err)
+	}
+
+	err = VerifyWithOptions(pk, msg, sig, &VerifyOptions{Limits: &Limits{MaxMessageSize: 99}})
+	isLimit("VerifyWithOptions()", err, "message")
+	_, err = OpenWithOptions(pk, sm, &VerifyOptions{Limits: &Limits{MaxEnvelopeSize: int64(len(sm) - 1)}})
+	isLimit("OpenWithOptions()", err, "envelope")
+	err = VerifyWithOptions(pk, msg, sig, &VerifyOptions{Limits: &Limits{MaxMemory: 1024}})
+	isLimit("VerifyWithOptions()", err, "memory")
+
+	pp, err := NewPreparedPublicKey(pk)
+	if err != nil {
+		t.Fatalf("failed NewPreparedPublicKey(): %s", err)
+	}
+	if err = pp.VerifyWithOptions(msg, sig, exact); err != nil {
+		t.Errorf("PreparedPublicKey.VerifyWithOptions() at the limits failed: %v", err)
+	}
+	err = pp.VerifyWithOptions(msg, sig, &VerifyOptions{Limits: &Limits{MaxMessageSize: 99}})
+	isLimit("PreparedPublicKey.VerifyWithOptions()", err, "message")
+
+	v := NewVerifierWithOptions(pk, sig, &VerifyOptions{Limits: &Limits{MaxMessageSize: 99}})
+	_, err = io.Copy(v, bytes.NewReader(msg))
+	isLimit("Verifier.Write()", err, "message")
+
+	or, err := OpenReader(pk, bytes.NewReader(sm), &OpenReaderOptions{Window: 16, Limits: &Limits{MaxEnvelopeSize: int64(len(sm) - 1)}})
+	if err != nil {
+		t.Fatalf("OpenReader() failed: %v", err)
+	}
+	_, err = io.Copy(io.Discard, or)
+	isLimit("OpenReader()", err, "envelope")
+	_, err = OpenReader(pk, bytes.NewReader(sm), &OpenReaderOptions{Limits: &Limits{MaxMemory: SignatureSize}})
+	isLimit("OpenReader()", err, "memory")
+
+	s := NewSigner(sk, &SignerOptions{Limits: &Limits{MaxMessageSize: 99}})
+	_, err = s.Sign(nil, msg, crypto.Hash(0))
+	isLimit("Signer.Sign()", err, "message")
+	_, err = s.SignMessage(msg)
+	isLimit("Signer.SignMessage()", err, "message")
+	_, err = s.SignReader(bytes.NewReader(msg))
+	isLimit("Signer.SignReader()", err, "message")
+	if st := s.Stats(); st.Failures != 3 || st.Signatures != 0 {
+		t.Errorf("Signer stats after rejections: %+v", st)
+	}
+	s = NewSigner(sk, &SignerOptions{Limits: &Limits{MaxMemory: SignMemory - 1}})
+	_, err = s.Sign(nil, msg, crypto.Hash(0))
+	isLimit("Signer.Sign()", err, "memory")
+	_, err = s.SignMessage(msg)
+	isLimit("Signer.SignMessage()", err, "memory")
+}
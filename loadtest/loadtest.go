@@ -0,0 +1,170 @@
+// loadtest.go - Verification throughput load test
+
+// Package loadtest measures sustained SPHINCS-256 verification throughput
+// and latency on the local machine, so that operators can size
+// verification services.  The cmd/sphincs256-loadtest command runs it from
+// the command line.
+//
+// A pool of signatures is created up front, as signing is far slower than
+// verification, and then verified against prepared public keys by a number
+// of concurrent workers for the configured duration.
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yawning/sphincs256"
+)
+
+// Config is the load test configuration.  Zero fields take their defaults.
+type Config struct {
+	// Concurrency is the number of verification workers, GOMAXPROCS by
+	// default.
+	Concurrency int
+
+	// Duration is how long to verify for, 10 seconds by default.
+	Duration time.Duration
+
+	// Signatures is the number of distinct signatures verified, 16 by
+	// default.
+	Signatures int
+
+	// MessageSize is the length of the signed messages in bytes, 256 by
+	// default.
+	MessageSize int
+
+	// Rand is the source of keys and messages, sphincs256.DefaultSource() by default.
+	Rand io.Reader
+}
+
+// Report is the result of a load test.
+type Report struct {
+	Concurrency   int
+	Verifications uint64
+	Failures      uint64
+	Elapsed       time.Duration
+
+	// PerSecond is the sustained number of verifications per second.
+	PerSecond float64
+
+	// P50, P90, P99 and P999 are latency percentiles, and Max the largest
+	// latency of a single verification.
+	P50, P90, P99, P999, Max time.Duration
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("%d verifications (%d failed) by %d workers in %v: %.1f/s, latency p50 %v p90 %v p99 %v p99.9 %v max %v",
+		r.Verifications, r.Failures, r.Concurrency, r.Elapsed.Round(time.Millisecond), r.PerSecond,
+		r.P50, r.P90, r.P99, r.P999, r.Max)
+}
+
+type item struct {
+	key *sphincs256.PreparedPublicKey
+	msg []byte
+	sig *[sphincs256.SignatureSize]byte
+}
+
+// Run runs a load test.  It stops early, with a partial report, if ctx is
+// done.
+func Run(ctx context.Context, cfg *Config) (*Report, error) {
+	c := Config{}
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if c.Duration <= 0 {
+		c.Duration = 10 * time.Second
+	}
+	if c.Signatures <= 0 {
+		c.Signatures = 16
+	}
+	if c.MessageSize <= 0 {
+		c.MessageSize = 256
+	}
+	if c.Rand == nil {
+		c.Rand = sphincs256.DefaultSource()
+	}
+
+	pool, err := newPool(&c)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	latencies := make([][]time.Duration, c.Concurrency)
+	failures := make([]uint64, c.Concurrency)
+	start := time.Now()
+	for w := 0; w < c.Concurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; ctx.Err() == nil; i++ {
+				it := &pool[i%len(pool)]
+				t := time.Now()
+				ok := it.key.Verify(it.msg, it.sig)
+				latencies[w] = append(latencies[w], time.Since(t))
+				if !ok {
+					failures[w]++
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	r := &Report{Concurrency: c.Concurrency, Elapsed: time.Since(start)}
+	var all []time.Duration
+	for w := range latencies {
+		all = append(all, latencies[w]...)
+		r.Failures += failures[w]
+	}
+	r.Verifications = uint64(len(all))
+	r.PerSecond = float64(len(all)) / r.Elapsed.Seconds()
+	if len(all) > 0 {
+		sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+		pct := func(p float64) time.Duration {
+			return all[int(p*float64(len(all)-1))]
+		}
+		r.P50, r.P90, r.P99, r.P999, r.Max = pct(0.5), pct(0.9), pct(0.99), pct(0.999), all[len(all)-1]
+	}
+	return r, nil
+}
+
+// newPool creates the signatures to verify, under a few keys.
+func newPool(c *Config) ([]item, error) {
+	const maxKeys = 4
+
+	var keys []*sphincs256.PreparedPublicKey
+	var sks []*[sphincs256.PrivateKeySize]byte
+	for i := 0; i < maxKeys && i < c.Signatures; i++ {
+		pk, sk, err := sphincs256.GenerateKey(c.Rand)
+		if err != nil {
+			return nil, err
+		}
+		k, err := sphincs256.NewPreparedPublicKey(pk)
+		if err != nil {
+			return nil, err
+		}
+		keys, sks = append(keys, k), append(sks, sk)
+	}
+
+	pool := make([]item, c.Signatures)
+	for i := range pool {
+		msg := make([]byte, c.MessageSize)
+		if _, err := io.ReadFull(c.Rand, msg); err != nil {
+			return nil, err
+		}
+		pool[i] = item{key: keys[i%len(keys)], msg: msg, sig: sphincs256.Sign(sks[i%len(sks)], msg)}
+	}
+	return pool, nil
+}
@@ -0,0 +1,26 @@
+// loadtest_test.go - Verification throughput load test tests
+
+package loadtest
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	r, err := Run(context.Background(), &Config{
+		Concurrency: 2,
+		Duration:    200 * time.Millisecond,
+		Signatures:  1,
+	})
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if r.Verifications == 0 || r.Failures != 0 {
+		t.Fatalf("Run() reported %s", r)
+	}
+	if r.P50 <= 0 || r.P50 > r.P99 || r.P99 > r.Max {
+		t.Errorf("Run() reported inconsistent latencies: %s", r)
+	}
+}
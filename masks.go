@@ -0,0 +1,158 @@
+// masks.go - Bitmask sources
+
+package sphincs256
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/yawning/sphincs256/chacha"
+	"github.com/yawning/sphincs256/hash"
+	"github.com/yawning/sphincs256/utils"
+)
+
+// MasksSize is the length of the bitmasks of a key in bytes.  The masks
+// follow the secret seed in a private key, and start a public key.
+const MasksSize = nMasks * hash.Size
+
+// MaskSource provides the bitmasks of a key.
+type MaskSource interface {
+	// Masks writes the masks to masks.
+	Masks(masks *[MasksSize]byte) error
+}
+
+// StoredMasks are masks stored in full, as in the standard key format.
+type StoredMasks [MasksSize]byte
+
+// Masks implements MaskSource.
+func (m *StoredMasks) Masks(masks *[MasksSize]byte) error {
+	copy(masks[:], m[:])
+	return nil
+}
+
+// SeedMasks are masks expanded from a seed with the ChaCha12 based PRG, so
+// that a key can be stored as its three seeds rather than in full.
+type SeedMasks [SeedSize]byte
+
+// Masks implements MaskSource.
+func (s *SeedMasks) Masks(masks *[MasksSize]byte) error {
+	chacha.Prg(masks[:], s[:])
+	return nil
+}
+
+// MaskFunc adapts a function, such as one that fetches masks provisioned to
+// a hardware module, to a MaskSource.
+type MaskFunc func(masks *[MasksSize]byte) error
+
+// Masks implements MaskSource.
+func (f MaskFunc) Masks(masks *[MasksSize]byte) error {
+	return f(masks)
+}
+
+// NewPrivateKey assembles a private key in the standard format from the
+// secret seed, the masks from src and the randomization seed.
+func NewPrivateKey(seed *[SeedSize]byte, src MaskSource, randSeed *[SeedSize]byte) (*[PrivateKeySize]byte, error) {
+	var masks [MasksSize]byte
+	if err := src.Masks(&masks); err != nil {
+		return nil, err
+	}
+
+	sk := new([PrivateKeySize]byte)
+	copy(sk[:SeedSize], seed[:])
+	copy(sk[SeedSize:], masks[:])
+	copy(sk[SeedSize+MasksSize:], randSeed[:])
+	return sk, nil
+}
+
+// MaskedKeySize is the length of an encoded MaskedKey with SeedMasks in
+// bytes: the secret seed, the mask seed and the randomization seed.
+const MaskedKeySize = 3 * SeedSize
+
+// MaskedKey is a private key that holds only its two seeds, and obtains its
+// masks from a MaskSource each time they are needed.  The full private key
+// exists only for the duration of an operation, and is wiped afterwards.
+//
+// With SeedMasks, a key is stored in MaskedKeySize bytes rather than
+// PrivateKeySize, and with a MaskFunc, the masks can stay in the hardware
+// that provisions them.
+type MaskedKey struct {
+	Seed     [SeedSize]byte
+	Masks    MaskSource
+	RandSeed [SeedSize]byte
+}
+
+// expand calls fn with the full private key, and wipes it afterwards.
+func (k *MaskedKey) expand(fn func(sk *[PrivateKeySize]byte)) error {
+	if k.Masks == nil {
+		return errors.New("sphincs256: masked key has no mask source")
+	}
+	sk, err := NewPrivateKey(&k.Seed, k.Masks, &k.RandSeed)
+	if err != nil {
+		return err
+	}
+	defer utils.Zerobytes(sk[:])
+	fn(sk)
+	return nil
+}
+
+// PublicKey returns the public key corresponding to the key.
+func (k *MaskedKey) PublicKey() (*[PublicKeySize]byte, error) {
+	pk := new([PublicKeySize]byte)
+	if err := k.expand(func(sk *[PrivateKeySize]byte) { derivePublicKey(pk[:], sk[:]) }); err != nil {
+		return nil, err
+	}
+	return pk, nil
+}
+
+// Sign signs the message and returns the signature, which is identical to
+// that of Sign with the equivalent standard private key.
+func (k *MaskedKey) Sign(message []byte) (*[SignatureSize]byte, error) {
+	var sig *[SignatureSize]byte
+	if err := k.expand(func(sk *[PrivateKeySize]byte) { sig = Sign(sk, message) }); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// MarshalBinary encodes the key as its secret seed, mask seed and
+// randomization seed.  Only keys with SeedMasks can be encoded.
+func (k *MaskedKey) MarshalBinary() ([]byte, error) {
+	ms, ok := k.Masks.(*SeedMasks)
+	if !ok {
+		return nil, errors.New("sphincs256: only keys with seed derived masks can be encoded")
+	}
+	b := make([]byte, 0, MaskedKeySize)
+	b = append(b, k.Seed[:]...)
+	b = append(b, ms[:]...)
+	return append(b, k.RandSeed[:]...), nil
+}
+
+// UnmarshalBinary decodes a key encoded by MarshalBinary.
+func (k *MaskedKey) UnmarshalBinary(data []byte) error {
+	if len(data) != MaskedKeySize {
+		return fmt.Errorf("sphincs256: invalid masked key length: %d", len(data))
+	}
+	ms := new(SeedMasks)
+	copy(k.Seed[:], data[:SeedSize])
+	copy(ms[:], data[SeedSize:2*SeedSize])
+	copy(k.RandSeed[:], data[2*SeedSize:])
+	k.Masks = ms
+	return nil
+}
+
+// GenerateKeyWithMasks generates a public key and a MaskedKey with the
+// masks from src, and the seeds read from rand (the default Source if nil).
+func GenerateKeyWithMasks(rand io.Reader, src MaskSource) (publicKey *[PublicKeySize]byte, privateKey *MaskedKey, err error) {
+	privateKey = &MaskedKey{Masks: src}
+	if _, err = io.ReadFull(randReader(rand), privateKey.Seed[:]); err != nil {
+		return nil, nil, err
+	}
+	if _, err = io.ReadFull(randReader(rand), privateKey.RandSeed[:]); err != nil {
+		return nil, nil, err
+	}
+	if publicKey, err = privateKey.PublicKey(); err != nil {
+		return nil, nil, err
+	}
+	return
+}
@@ -0,0 +1,65 @@
+// masks_test.go - Bitmask source tests
+
+package sphincs256
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestMaskSources(t *testing.T) {
+	ms := new(SeedMasks)
+	rand.Read(ms[:])
+	pk, mk, err := GenerateKeyWithMasks(rand.Reader, ms)
+	if err != nil {
+		t.Fatalf("GenerateKeyWithMasks() failed: %v", err)
+	}
+
+	// The masks in the public key are the expanded seed, and the standard
+	// key can be assembled from the three seeds and from the stored masks.
+	var masks [MasksSize]byte
+	ms.Masks(&masks)
+	if [MasksSize]byte(pk[:MasksSize]) != masks {
+		t.Fatalf("GenerateKeyWithMasks() did not use the mask source")
+	}
+	sk, err := NewPrivateKey(&mk.Seed, ms, &mk.RandSeed)
+	if err != nil {
+		t.Fatalf("NewPrivateKey() failed: %v", err)
+	}
+	if sk2, err := NewPrivateKey(&mk.Seed, (*StoredMasks)(&masks), &mk.RandSeed); err != nil || *sk2 != *sk {
+		t.Fatalf("NewPrivateKey() mismatch: %v", err)
+	}
+
+	// The masked key signs like the standard key, and is stored compactly.
+	msg := []byte("seed derived masks")
+	sig, err := mk.Sign(msg)
+	if err != nil {
+		t.Fatalf("MaskedKey.Sign() failed: %v", err)
+	}
+	if *sig != *Sign(sk, msg) || !Verify(pk, msg, sig) {
+		t.Errorf("MaskedKey.Sign() does not match Sign()")
+	}
+	b, err := mk.MarshalBinary()
+	if err != nil || len(b) != MaskedKeySize {
+		t.Fatalf("MaskedKey.MarshalBinary() failed: %v", err)
+	}
+	var mk2 MaskedKey
+	if err = mk2.UnmarshalBinary(b); err != nil {
+		t.Fatalf("MaskedKey.UnmarshalBinary() failed: %v", err)
+	}
+	if pk2, err := mk2.PublicKey(); err != nil || *pk2 != *pk {
+		t.Errorf("decoded MaskedKey has a different public key: %v", err)
+	}
+	if _, err = (&MaskedKey{Masks: (*StoredMasks)(&masks)}).MarshalBinary(); err == nil {
+		t.Errorf("MaskedKey.MarshalBinary() encoded stored masks")
+	}
+
+	errProvision := errors.New("not provisioned")
+	if _, _, err = GenerateKeyWithMasks(rand.Reader, MaskFunc(func(*[MasksSize]byte) error { return errProvision })); err != errProvision {
+		t.Errorf("GenerateKeyWithMasks() did not return the mask source error: %v", err)
+	}
+	if _, err = new(MaskedKey).Sign(msg); err == nil {
+		t.Errorf("MaskedKey.Sign() succeeded without a mask source")
+	}
+}
@@ -0,0 +1,159 @@
+// migration.go - Algorithm migration verification
+
+// Package migration implements verification of signatures for identities
+// that are migrating from SPHINCS-256 to a successor algorithm such as
+// SLH-DSA.  The identity is represented by two pinned public keys, and a
+// policy (optionally scheduled over a transition window) determines which
+// signatures are required.
+//
+// This package does not implement the successor algorithm.  Its pinned key
+// and verification are supplied by the caller as a SignatureVerifier.
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yawning/sphincs256"
+)
+
+var (
+	// ErrMissingSignature is the error returned when a signature required
+	// by the policy is absent.
+	ErrMissingSignature = errors.New("migration: required signature missing")
+
+	// ErrInvalidPolicy is the error returned for unknown policies.
+	ErrInvalidPolicy = errors.New("migration: invalid policy")
+
+	// ErrMissingKey is the error returned when a pinned key needed to
+	// verify a signature is absent.
+	ErrMissingKey = errors.New("migration: pinned key missing")
+)
+
+// SignatureVerifier verifies signatures made with a pinned successor
+// algorithm public key.
+type SignatureVerifier interface {
+	Verify(message, signature []byte) error
+}
+
+// Policy determines which signatures are required.
+type Policy int
+
+const (
+	// AcceptEither accepts a valid signature from either key.  Signatures
+	// that are present must be valid.
+	AcceptEither Policy = iota
+
+	// RequireBoth requires valid signatures from both keys.
+	RequireBoth
+
+	// RequireSuccessor requires a valid successor signature, and ignores the
+	// SPHINCS-256 signature.
+	RequireSuccessor
+)
+
+// Schedule is a transition window.  Before Start AcceptEither applies,
+// between Start and End RequireBoth applies, and from End on
+// RequireSuccessor applies.
+type Schedule struct {
+	Start time.Time
+	End   time.Time
+}
+
+// PolicyAt returns the policy in force at t.
+func (s *Schedule) PolicyAt(t time.Time) Policy {
+	switch {
+	case t.Before(s.Start):
+		return AcceptEither
+	case t.Before(s.End):
+		return RequireBoth
+	default:
+		return RequireSuccessor
+	}
+}
+
+// Signatures are the signatures of a message.  Either may be nil.
+type Signatures struct {
+	SPHINCS256 *[sphincs256.SignatureSize]byte
+	Successor  []byte
+}
+
+// Verifier verifies signatures for an identity that is migrating away from
+// SPHINCS-256.
+type Verifier struct {
+	// PublicKey is the pinned SPHINCS-256 public key.
+	PublicKey *[sphincs256.PublicKeySize]byte
+
+	// Successor verifies signatures with the pinned successor key.
+	Successor SignatureVerifier
+
+	// Policy is the policy, used if Schedule is nil.
+	Policy Policy
+
+	// Schedule, if set, determines the policy from the current time.
+	Schedule *Schedule
+
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+func (v *Verifier) policy() Policy {
+	if v.Schedule == nil {
+		return v.Policy
+	}
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	return v.Schedule.PolicyAt(now())
+}
+
+// Verify returns nil iff sigs satisfy the policy for message.  A nil sigs
+// is treated as carrying no signatures.
+func (v *Verifier) Verify(message []byte, sigs *Signatures) error {
+	if v == nil {
+		return ErrMissingKey
+	}
+	if sigs == nil {
+		sigs = &Signatures{}
+	}
+	p := v.policy()
+
+	needLegacy, needSuccessor := false, false
+	switch p {
+	case AcceptEither:
+		if sigs.SPHINCS256 == nil && sigs.Successor == nil {
+			return ErrMissingSignature
+		}
+	case RequireBoth:
+		needLegacy, needSuccessor = true, true
+	case RequireSuccessor:
+		needSuccessor = true
+	default:
+		return ErrInvalidPolicy
+	}
+
+	if sigs.SPHINCS256 != nil && p != RequireSuccessor {
+		if v.PublicKey == nil {
+			return fmt.Errorf("%w: SPHINCS-256", ErrMissingKey)
+		}
+		if err := sphincs256.VerifyWithOptions(v.PublicKey, message, sigs.SPHINCS256, nil); err != nil {
+			return err
+		}
+	} else if needLegacy {
+		return fmt.Errorf("%w: SPHINCS-256", ErrMissingSignature)
+	}
+
+	if sigs.Successor != nil {
+		if v.Successor == nil {
+			return fmt.Errorf("%w: successor", ErrMissingKey)
+		}
+		if err := v.Successor.Verify(message, sigs.Successor); err != nil {
+			return fmt.Errorf("migration: successor signature verification failed: %w", err)
+		}
+	} else if needSuccessor {
+		return fmt.Errorf("%w: successor", ErrMissingSignature)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// migration_test.go - Algorithm migration verification tests
+
+package migration
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yawning/sphincs256"
+)
+
+// stubVerifier accepts signatures that equal the message reversed.
+type stubVerifier struct{}
+
+func (stubVerifier) Verify(message, signature []byte) error {
+	for i := range message {
+		if i >= len(signature) || signature[i] != message[len(message)-1-i] {
+			return errors.New("bad signature")
+		}
+	}
+	return nil
+}
+
+func TestVerifier(t *testing.T) {
+	pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	msg := []byte("The Colour Out of Space")
+	legacy := sphincs256.Sign(sk, msg)
+	successor := bytes.Clone(msg)
+	for i, j := 0, len(successor)-1; i < j; i, j = i+1, j-1 {
+		successor[i], successor[j] = successor[j], successor[i]
+	}
+
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(-time.Hour)
+	v := &Verifier{
+		PublicKey: pk,
+		Successor: stubVerifier{},
+		Schedule:  &Schedule{Start: start, End: start.Add(24 * time.Hour)},
+		Now:       func() time.Time { return now },
+	}
+
+	cases := []struct {
+		sigs    Signatures
+		accepts [3]bool // before, during and after the window
+	}{
+		{Signatures{SPHINCS256: legacy}, [3]bool{true, false, false}},
+		{Signatures{Successor: successor}, [3]bool{true, false, true}},
+		{Signatures{SPHINCS256: legacy, Successor: successor}, [3]bool{true, true, true}},
+		{Signatures{SPHINCS256: legacy, Successor: msg}, [3]bool{false, false, false}},
+		{Signatures{}, [3]bool{false, false, false}},
+	}
+	for phase, at := range []time.Time{start.Add(-time.Hour), start.Add(time.Hour), start.Add(48 * time.Hour)} {
+		now = at
+		for i, c := range cases {
+			if err := v.Verify(msg, &c.sigs); (err == nil) != c.accepts[phase] {
+				t.Errorf("phase %d, case %d: Verify() returned %v", phase, i, err)
+			}
+		}
+	}
+}
+
+func TestVerifierNil(t *testing.T) {
+	pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	msg := []byte("The Dunwich Horror")
+	sigs := &Signatures{SPHINCS256: sphincs256.Sign(sk, msg), Successor: []byte("x")}
+
+	var nilVerifier *Verifier
+	if err := nilVerifier.Verify(msg, sigs); !errors.Is(err, ErrMissingKey) {
+		t.Errorf("nil Verifier: Verify() returned %v", err)
+	}
+	if err := (&Verifier{PublicKey: pk}).Verify(msg, nil); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("nil Signatures: Verify() returned %v", err)
+	}
+	if err := (&Verifier{Successor: stubVerifier{}}).Verify(msg, sigs); !errors.Is(err, ErrMissingKey) {
+		t.Errorf("nil PublicKey: Verify() returned %v", err)
+	}
+	if err := (&Verifier{PublicKey: pk}).Verify(msg, sigs); !errors.Is(err, ErrMissingKey) {
+		t.Errorf("nil Successor: Verify() returned %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+// misuse.go - Runtime API misuse checks
+
+package sphincs256
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/yawning/sphincs256/hash"
+	"github.com/yawning/sphincs256/utils"
+)
+
+var (
+	// ErrZeroizedKey is the error returned when a key, or part of one, is
+	// all zero, which almost always means it was wiped and then reused.
+	ErrZeroizedKey = errors.New("sphincs256: key is zeroized")
+
+	// ErrKeyMismatch is the error returned when a public key does not
+	// correspond to the private key it is used with.
+	ErrKeyMismatch = errors.New("sphincs256: public key does not match private key")
+
+	// ErrPrehashed is the error returned when a message has the length of a
+	// common message digest.  SPHINCS-256 hashes the message itself, and
+	// signing a caller computed digest instead loses collision resistance
+	// and interoperability.
+	ErrPrehashed = errors.New("sphincs256: message looks like a prehashed digest")
+
+	misuseChecks atomic.Bool
+)
+
+// digestSizes are the output lengths of the common hash functions, that a
+// prehashed message is likely to have.
+var digestSizes = []int{20, 28, 32, 48, 64}
+
+// SetMisuseChecks enables or disables the runtime misuse checks.
+//
+// When enabled, PrivateKey.Sign and Signer.Sign apply CheckMessage to the
+// message, Signer.Sign applies CheckKeyPair if the Signer was given the
+// expected public key, and VerifyWithOptions (and so Verify and Open)
+// rejects all zero keys with ErrZeroizedKey.  The prehash check is a
+// heuristic that rejects every message of a common digest length, so it is
+// only applied when signing, where the caller controls the message, and the
+// checks are disabled by default and are intended for development and
+// testing.
+func SetMisuseChecks(enabled bool) {
+	misuseChecks.Store(enabled)
+}
+
+// MisuseChecks returns true iff the runtime misuse checks are enabled.
+func MisuseChecks() bool {
+	return misuseChecks.Load()
+}
+
+// CheckPrivateKey returns ErrZeroizedKey if any of the seed, the masks or
+// the randomization seed of privateKey is all zero.
+func CheckPrivateKey(privateKey *[PrivateKeySize]byte) error {
+	switch {
+	case utils.ConstantTimeIsZero(privateKey[:seedBytes]):
+		return fmt.Errorf("%w: seed is all zero", ErrZeroizedKey)
+	case utils.ConstantTimeIsZero(privateKey[seedBytes : PrivateKeySize-skRandSeedBytes]):
+		return fmt.Errorf("%w: masks are all zero", ErrZeroizedKey)
+	case utils.ConstantTimeIsZero(privateKey[PrivateKeySize-skRandSeedBytes:]):
+		return fmt.Errorf("%w: randomization seed is all zero", ErrZeroizedKey)
+	}
+	return nil
+}
+
+// CheckPublicKey returns ErrZeroizedKey if either the masks or the root of
+// publicKey is all zero.
+func CheckPublicKey(publicKey *[PublicKeySize]byte) error {
+	switch {
+	case utils.ConstantTimeIsZero(publicKey[:nMasks*hash.Size]):
+		return fmt.Errorf("%w: masks are all zero", ErrZeroizedKey)
+	case utils.ConstantTimeIsZero(publicKey[nMasks*hash.Size:]):
+		return fmt.Errorf("%w: root is all zero", ErrZeroizedKey)
+	}
+	return nil
+}
+
+// CheckKeyPair returns an error if either key is zeroized, or if publicKey
+// is not the public key corresponding to privateKey.  The check costs about
+// as much as key generation.
+func CheckKeyPair(publicKey *[PublicKeySize]byte, privateKey *[PrivateKeySize]byte) error {
+	var pk [PublicKeySize]byte
+
+	if err := CheckPrivateKey(privateKey); err != nil {
+		return err
+	}
+	if err := CheckPublicKey(publicKey); err != nil {
+		return err
+	}
+	derivePublicKey(pk[:], privateKey[:])
+	if subtle.ConstantTimeCompare(pk[:], publicKey[:]) != 1 {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+// CheckMessage returns ErrPrehashed if message has the length of a common
+// message digest.  Legitimate messages of those lengths are rejected too.
+func CheckMessage(message []byte) error {
+	for _, n := range digestSizes {
+		if len(message) == n {
+			return fmt.Errorf("%w (%d bytes)", ErrPrehashed, n)
+		}
+	}
+	return nil
+}
+
+// checkSign applies the enabled misuse checks to a signing operation.  The
+// key pair is checked if publicKey is non-nil.
+func checkSign(privateKey *[PrivateKeySize]byte, publicKey *[PublicKeySize]byte, message []byte) error {
+	if !misuseChecks.Load() {
+		return nil
+	}
+	if publicKey != nil {
+		if err := CheckKeyPair(publicKey, privateKey); err != nil {
+			return err
+		}
+	} else if err := CheckPrivateKey(privateKey); err != nil {
+		return err
+	}
+	return CheckMessage(message)
+}
+
+// checkVerify applies the enabled misuse checks to a verification.  The
+// message is not checked, as signatures over digest sized messages may have
+// been made legitimately, such as by SignChunked.
+func checkVerify(publicKey *[PublicKeySize]byte) error {
+	if !misuseChecks.Load() {
+		return nil
+	}
+	return CheckPublicKey(publicKey)
+}
@@ -0,0 +1,91 @@
+// misuse_test.go - Runtime API misuse check tests
+
+package sphincs256
+
+import (
+	"crypto"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestMisuseChecks(t *testing.T) {
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %v", err)
+	}
+	pk2, _, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %v", err)
+	}
+
+	if err := CheckKeyPair(pk, sk); err != nil {
+		t.Errorf("CheckKeyPair() rejected a matching pair: %v", err)
+	}
+	if err := CheckKeyPair(pk2, sk); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("CheckKeyPair() accepted a mismatched pair: %v", err)
+	}
+	var zsk [PrivateKeySize]byte
+	if err := CheckKeyPair(pk, &zsk); !errors.Is(err, ErrZeroizedKey) {
+		t.Errorf("CheckKeyPair() accepted a zeroized key: %v", err)
+	}
+
+	digest := make([]byte, 32)
+	msg := []byte("a message, not a digest of one")
+	if err := CheckMessage(digest); !errors.Is(err, ErrPrehashed) {
+		t.Errorf("CheckMessage() accepted a digest sized message: %v", err)
+	}
+
+	// Disabled by default.
+	priv := (*PrivateKey)(sk)
+	digestSig, err := priv.Sign(nil, digest, crypto.Hash(0))
+	if err != nil {
+		t.Fatalf("failed Sign() with checks disabled: %v", err)
+	}
+
+	SetMisuseChecks(true)
+	defer SetMisuseChecks(false)
+
+	if _, err := priv.Sign(nil, digest, crypto.Hash(0)); !errors.Is(err, ErrPrehashed) {
+		t.Errorf("Sign() accepted a prehashed message: %v", err)
+	}
+	if _, err := (*PrivateKey)(&zsk).Sign(nil, msg, crypto.Hash(0)); !errors.Is(err, ErrZeroizedKey) {
+		t.Errorf("Sign() accepted a zeroized key: %v", err)
+	}
+	s := NewSigner(sk, nil)
+	if _, err := s.Sign(nil, digest, crypto.Hash(0)); !errors.Is(err, ErrPrehashed) {
+		t.Errorf("Signer.Sign() accepted a prehashed message: %v", err)
+	}
+	if _, err := s.SignMessage(digest); !errors.Is(err, ErrPrehashed) {
+		t.Errorf("Signer.SignMessage() accepted a prehashed message: %v", err)
+	}
+	if s.Stats().Failures != 2 {
+		t.Errorf("Signer misuse not recorded as a failure")
+	}
+	if _, err := NewSigner(sk, &SignerOptions{PublicKey: pk}).Sign(nil, msg, crypto.Hash(0)); err != nil {
+		t.Errorf("failed Signer.Sign() with the matching public key: %v", err)
+	}
+	if _, err := NewSigner(sk, &SignerOptions{PublicKey: pk2}).Sign(nil, msg, crypto.Hash(0)); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("Signer.Sign() accepted a mismatched public key: %v", err)
+	}
+
+	sig, err := priv.Sign(nil, msg, crypto.Hash(0))
+	if err != nil {
+		t.Fatalf("failed Sign(): %v", err)
+	}
+	var zpk [PublicKeySize]byte
+	if err := VerifyWithOptions(&zpk, msg, (*[SignatureSize]byte)(sig), nil); !errors.Is(err, ErrZeroizedKey) {
+		t.Errorf("VerifyWithOptions() accepted a zeroized key: %v", err)
+	}
+	if err := NewVerifier(&zpk, (*[SignatureSize]byte)(sig)).Verify(); !errors.Is(err, ErrZeroizedKey) {
+		t.Errorf("Verifier.Verify() accepted a zeroized key: %v", err)
+	}
+	if err := VerifyWithOptions(pk, msg, (*[SignatureSize]byte)(sig), nil); err != nil {
+		t.Errorf("failed VerifyWithOptions(): %v", err)
+	}
+
+	// Verification does not second guess digest sized messages.
+	if err := VerifyWithOptions(pk, digest, (*[SignatureSize]byte)(digestSig), nil); err != nil {
+		t.Errorf("failed VerifyWithOptions() of a digest sized message: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+// parallel.go - Concurrency helpers
+
+package sphincs256
+
+import (
+	"runtime"
+	"sync/atomic"
+
+	"github.com/yawning/sphincs256/utils"
+)
+
+var (
+	deterministic atomic.Bool
+	maxWorkers    atomic.Int64
+)
+
+// SetDeterministic enables or disables the deterministic execution mode.
+//
+// When enabled, no operation spawns goroutines: all work is done on the
+// calling goroutine in a fixed order, with a fixed memory profile.  This is
+// intended for real-time and safety-certified environments.  The output of
+// every operation is identical in both modes.
+func SetDeterministic(enabled bool) {
+	deterministic.Store(enabled)
+}
+
+// IsDeterministic returns true iff the deterministic execution mode is
+// enabled.
+func IsDeterministic() bool {
+	return deterministic.Load()
+}
+
+// SetWorkers sets the maximum number of goroutines used by a single key
+// generation, signing or verification operation.  If n <= 0, the limit is
+// runtime.GOMAXPROCS(0), which is the default.  The deterministic execution
+// mode takes precedence over this setting.
+func SetWorkers(n int) {
+	if n < 0 {
+		n = 0
+	}
+	maxWorkers.Store(int64(n))
+}
+
+// workers returns the number of goroutines to use for parallelizable work.
+func workers() int {
+	if deterministic.Load() {
+		return 1
+	}
+	if n := maxWorkers.Load(); n > 0 {
+		return int(n)
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// parallelFor calls fn(i) for each 0 <= i < n, spread over up to workers()
+// goroutines, and returns once all calls have completed.  If only one worker
+// is available, the calls are made in order on the calling goroutine.
+func parallelFor(n int, fn func(i int)) {
+	utils.ParallelFor(workers(), n, fn)
+}
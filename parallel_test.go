@@ -0,0 +1,67 @@
+// parallel_test.go - Concurrency helper tests
+
+package sphincs256
+
+import (
+	"bytes"
+	"crypto/rand"
+	"runtime"
+	"testing"
+)
+
+func TestDeterministic(t *testing.T) {
+	SetDeterministic(true)
+	defer SetDeterministic(false)
+
+	if !IsDeterministic() || workers() != 1 {
+		t.Fatalf("deterministic mode not enabled")
+	}
+
+	// Every call must happen in order, on this goroutine.
+	before := runtime.NumGoroutine()
+	var order []int
+	parallelFor(16, func(i int) {
+		if runtime.NumGoroutine() != before {
+			t.Errorf("goroutine spawned in deterministic mode")
+		}
+		order = append(order, i)
+	})
+	for i, v := range order {
+		if i != v {
+			t.Fatalf("out of order execution: %v", order)
+		}
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	msg := []byte("parallel signing must not change the output")
+
+	SetWorkers(8)
+	defer SetWorkers(0)
+	if workers() != 8 {
+		t.Fatalf("SetWorkers(8) not honored: %d", workers())
+	}
+	var pk2 [PublicKeySize]byte
+	derivePublicKey(pk2[:], sk[:])
+	if pk2 != *pk {
+		t.Errorf("parallel public key derivation mismatch")
+	}
+	sig := Sign(sk, msg)
+
+	SetDeterministic(true)
+	defer SetDeterministic(false)
+	derivePublicKey(pk2[:], sk[:])
+	if pk2 != *pk {
+		t.Errorf("serial public key derivation mismatch")
+	}
+	if !bytes.Equal(Sign(sk, msg)[:], sig[:]) {
+		t.Errorf("parallel and serial signatures differ")
+	}
+	if !Verify(pk, msg, sig) {
+		t.Errorf("Verify() failed")
+	}
+}
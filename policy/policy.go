@@ -0,0 +1,233 @@
+// policy.go - Verification policy engine
+
+// Package policy decides whether a set of SPHINCS-256 signatures over a
+// message is acceptable, given a single Policy that covers the allowed
+// signature schemes, the trusted and required keys, signature age,
+// revocation and quorum.  VerifyWithPolicy is the one decision function, and
+// records why each signature did or did not count, for auditing.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/bundle"
+)
+
+// ErrRejected is wrapped by the error returned when the signatures do not
+// satisfy a policy.
+var ErrRejected = errors.New("policy: signatures rejected")
+
+// Fingerprint is a public key fingerprint (see bundle.Fingerprint).
+type Fingerprint = [bundle.FingerprintSize]byte
+
+// Scheme is a signature scheme.
+type Scheme string
+
+const (
+	// SchemeStandard is sphincs256.Sign.
+	SchemeStandard Scheme = "sphincs256"
+
+	// SchemeChunked is sphincs256.SignChunked.
+	SchemeChunked Scheme = "sphincs256-chunked"
+)
+
+// Policy is a verification policy.  Each Signature carries its own public
+// key, so a signature only counts if its key is pinned by Trusted or
+// Required, or if AnyKey is set.  The zero value rejects every signature.
+type Policy struct {
+	// AllowedSchemes are the accepted schemes, SchemeStandard if empty.
+	AllowedSchemes []Scheme
+
+	// Trusted are the fingerprints of the keys whose signatures count.
+	Trusted []Fingerprint
+
+	// Required are the fingerprints of the keys that must all have signed.
+	// Their signatures count even if they are not in Trusted.
+	Required []Fingerprint
+
+	// AnyKey makes the signatures of every key count, including keys the
+	// signer generated just now.  It is only meaningful together with
+	// Required, or when the caller checks Decision.Signers itself.
+	AnyKey bool
+
+	// Quorum is the number of distinct keys that must have signed, at
+	// least 1.
+	Quorum int
+
+	// MaxSignatureAge, if non-zero, rejects signatures made longer than
+	// this ago, or with an unknown signing time.
+	MaxSignatureAge time.Duration
+
+	// CheckRevocation rejects signatures by keys revoked in Revocation,
+	// which must be present and signed by RevocationAuthority, and requires
+	// MaxRevocationAge.
+	CheckRevocation     bool
+	Revocation          *bundle.Revocation
+	RevocationAuthority *[sphincs256.PublicKeySize]byte
+
+	// MaxRevocationAge rejects revocation snapshots issued longer than this
+	// ago.  It bounds how long a snapshot from before a revocation can be
+	// replayed, and is required if CheckRevocation is set.
+	MaxRevocationAge time.Duration
+
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// Signature is a signature to be evaluated.
+type Signature struct {
+	Scheme    Scheme
+	PublicKey *[sphincs256.PublicKeySize]byte
+	Signature *[sphincs256.SignatureSize]byte
+
+	// ChunkSize is the chunk size of SchemeChunked signatures.
+	ChunkSize int
+
+	// SignedAt is the signing time, or zero if unknown.  It must come from
+	// a source the caller trusts, such as a verified time-stamp token, as
+	// the signer can claim any time.
+	SignedAt time.Time
+}
+
+// Decision is the outcome of VerifyWithPolicy.
+type Decision struct {
+	// Accepted is true iff the policy is satisfied.
+	Accepted bool
+
+	// Signers are the fingerprints of the keys whose signatures counted,
+	// in order and without duplicates.
+	Signers []Fingerprint
+
+	// Reasons holds, for each signature, why it did not count, or "" if it
+	// did.
+	Reasons []string
+}
+
+// VerifyWithPolicy evaluates sigs over message against p, and returns the
+// decision.  The error is nil iff the decision is to accept, and otherwise
+// wraps ErrRejected (or is a problem with the policy itself).  A nil p is
+// equivalent to the zero value, and so rejects every signature.
+func VerifyWithPolicy(message []byte, sigs []Signature, p *Policy) (*Decision, error) {
+	if p == nil {
+		p = new(Policy)
+	}
+	now := time.Now
+	if p.Now != nil {
+		now = p.Now
+	}
+	t := now()
+
+	if p.CheckRevocation {
+		if err := p.checkRevocation(t); err != nil {
+			return &Decision{}, err
+		}
+	}
+
+	d := &Decision{Reasons: make([]string, len(sigs))}
+	seen := make(map[Fingerprint]bool)
+	for i := range sigs {
+		fp, err := p.evaluate(message, &sigs[i], t)
+		if err != nil {
+			d.Reasons[i] = err.Error()
+			continue
+		}
+		if seen[fp] {
+			d.Reasons[i] = "duplicate signer"
+			continue
+		}
+		seen[fp] = true
+		d.Signers = append(d.Signers, fp)
+	}
+
+	for _, fp := range p.Required {
+		if !seen[fp] {
+			return d, fmt.Errorf("%w: missing signature by required key %x", ErrRejected, fp[:8])
+		}
+	}
+	quorum := p.Quorum
+	if quorum < 1 {
+		quorum = 1
+	}
+	if len(d.Signers) < quorum {
+		return d, fmt.Errorf("%w: %d of %d required signers", ErrRejected, len(d.Signers), quorum)
+	}
+	d.Accepted = true
+	return d, nil
+}
+
+// evaluate returns the fingerprint of the signer if sig counts towards p.
+func (p *Policy) evaluate(message []byte, sig *Signature, now time.Time) (Fingerprint, error) {
+	if sig.PublicKey == nil || sig.Signature == nil {
+		return Fingerprint{}, errors.New("incomplete signature")
+	}
+	fp := bundle.Fingerprint(sig.PublicKey)
+
+	if !p.schemeAllowed(sig.Scheme) {
+		return fp, fmt.Errorf("scheme %q not allowed", sig.Scheme)
+	}
+	if !p.AnyKey && !contains(p.Trusted, &fp) && !contains(p.Required, &fp) {
+		return fp, errors.New("untrusted key")
+	}
+	if p.CheckRevocation && p.Revocation.IsRevoked(&fp) {
+		return fp, bundle.ErrRevoked
+	}
+	if p.MaxSignatureAge != 0 {
+		switch {
+		case sig.SignedAt.IsZero():
+			return fp, errors.New("unknown signing time")
+		case now.Sub(sig.SignedAt) > p.MaxSignatureAge:
+			return fp, fmt.Errorf("signed %v, too long ago", sig.SignedAt)
+		}
+	}
+
+	var err error
+	switch sig.Scheme {
+	case SchemeStandard:
+		err = sphincs256.VerifyWithOptions(sig.PublicKey, message, sig.Signature, nil)
+	case SchemeChunked:
+		err = sphincs256.VerifyChunked(sig.PublicKey, message, sig.Signature, sig.ChunkSize)
+	default:
+		err = fmt.Errorf("unknown scheme %q", sig.Scheme)
+	}
+	return fp, err
+}
+
+func (p *Policy) schemeAllowed(s Scheme) bool {
+	if len(p.AllowedSchemes) == 0 {
+		return s == SchemeStandard
+	}
+	for _, a := range p.AllowedSchemes {
+		if a == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) checkRevocation(now time.Time) error {
+	if p.Revocation == nil || p.RevocationAuthority == nil {
+		return errors.New("policy: revocation checking requires a snapshot and its authority")
+	}
+	if p.MaxRevocationAge <= 0 {
+		return errors.New("policy: revocation checking requires MaxRevocationAge")
+	}
+	if err := p.Revocation.Verify(p.RevocationAuthority); err != nil {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	if now.Sub(p.Revocation.Issued) > p.MaxRevocationAge {
+		return fmt.Errorf("%w: revocation snapshot issued %v is too old", ErrRejected, p.Revocation.Issued)
+	}
+	return nil
+}
+
+func contains(fps []Fingerprint, fp *Fingerprint) bool {
+	for i := range fps {
+		if fps[i] == *fp {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+// policy_test.go - Verification policy engine tests
+
+package policy
+
+import (
+	"crypto/rand"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/bundle"
+)
+
+func TestVerifyWithPolicy(t *testing.T) {
+	var pks [3]*[sphincs256.PublicKeySize]byte
+	var fps [3]Fingerprint
+	var sigs []Signature
+	now := time.Now()
+	msg := []byte("release manifest")
+	for i := range pks {
+		pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey() failed: %v", err)
+		}
+		pks[i], fps[i] = pk, bundle.Fingerprint(pk)
+		sigs = append(sigs, Signature{Scheme: SchemeStandard, PublicKey: pk, Signature: sphincs256.Sign(sk, msg), SignedAt: now.Add(-time.Duration(i) * time.Hour)})
+		if i == 2 {
+			sigs[i].Scheme, sigs[i].ChunkSize = SchemeChunked, 64
+			sigs[i].Signature, _ = sphincs256.SignChunked(sk, msg, 64)
+		}
+	}
+	apk, ask, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	fixed := func() time.Time { return now }
+
+	accept := func(name string, p *Policy, signers int) {
+		t.Helper()
+		p.Now = fixed
+		d, err := VerifyWithPolicy(msg, sigs, p)
+		if err != nil || !d.Accepted || len(d.Signers) != signers {
+			t.Errorf("%s: got %+v, %v", name, d, err)
+		}
+	}
+	reject := func(name string, p *Policy) {
+		t.Helper()
+		p.Now = fixed
+		d, err := VerifyWithPolicy(msg, sigs, p)
+		if !errors.Is(err, ErrRejected) || d.Accepted {
+			t.Errorf("%s: got %+v, %v", name, d, err)
+		}
+	}
+
+	reject("default", &Policy{})
+	if d, err := VerifyWithPolicy(msg, sigs, nil); !errors.Is(err, ErrRejected) || d.Accepted {
+		t.Errorf("nil policy: got %+v, %v", d, err)
+	}
+	accept("any key", &Policy{AnyKey: true}, 2)
+	accept("chunked allowed", &Policy{AllowedSchemes: []Scheme{SchemeStandard, SchemeChunked}, Trusted: fps[:], Quorum: 3}, 3)
+	reject("quorum", &Policy{Trusted: fps[:], Quorum: 3})
+	accept("trusted", &Policy{Trusted: fps[1:2]}, 1)
+	accept("required", &Policy{Required: fps[:1]}, 1)
+	reject("required chunked signer", &Policy{Required: fps[2:]})
+	accept("max age", &Policy{Trusted: fps[:], MaxSignatureAge: 90 * time.Minute}, 2)
+	reject("max age quorum", &Policy{Trusted: fps[:], MaxSignatureAge: 30 * time.Minute, Quorum: 2})
+
+	rev := bundle.NewRevocation(ask, now, fps[:1])
+	accept("revocation", &Policy{Trusted: fps[:], CheckRevocation: true, Revocation: rev, RevocationAuthority: apk, MaxRevocationAge: time.Hour}, 1)
+	reject("revoked required", &Policy{CheckRevocation: true, Revocation: rev, RevocationAuthority: apk, MaxRevocationAge: time.Hour, Required: fps[:1]})
+	reject("stale revocation", &Policy{Trusted: fps[:], CheckRevocation: true, Revocation: bundle.NewRevocation(ask, now.Add(-48*time.Hour), nil), RevocationAuthority: apk, MaxRevocationAge: 24 * time.Hour})
+	reject("wrong authority", &Policy{Trusted: fps[:], CheckRevocation: true, Revocation: rev, RevocationAuthority: pks[0], MaxRevocationAge: time.Hour})
+	if d, err := VerifyWithPolicy(msg, sigs, &Policy{Trusted: fps[:], CheckRevocation: true, Revocation: rev, RevocationAuthority: apk, Now: fixed}); err == nil || d.Accepted {
+		t.Errorf("revocation without MaxRevocationAge: got %+v, %v", d, err)
+	}
+
+	// A signature by a fresh key the signer brought along does not count
+	// unless the policy opts in to any key.
+	mpk, msk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	forged := []Signature{{Scheme: SchemeStandard, PublicKey: mpk, Signature: sphincs256.Sign(msk, msg)}}
+	for _, p := range []*Policy{{}, {Trusted: fps[:]}, {Required: fps[:1]}} {
+		p.Now = fixed
+		if d, err := VerifyWithPolicy(msg, forged, p); !errors.Is(err, ErrRejected) || d.Accepted || d.Reasons[0] != "untrusted key" {
+			t.Errorf("self-signed unknown key: got %+v, %v", d, err)
+		}
+	}
+
+	// An untrusted chunk size is rejected rather than hashed with.
+	huge := append([]Signature{}, sigs...)
+	huge[2].ChunkSize = math.MaxInt
+	if d, err := VerifyWithPolicy(msg, huge, &Policy{AllowedSchemes: []Scheme{SchemeChunked}, Trusted: fps[:], Now: fixed}); err == nil || d.Reasons[2] == "" {
+		t.Errorf("huge chunk size: got %+v, %v", d, err)
+	}
+
+	// A tampered signature is reported against that signature.
+	sigs[1].Signature[100] ^= 1
+	d, err := VerifyWithPolicy(msg, sigs, &Policy{Trusted: fps[:], Quorum: 2, Now: fixed})
+	if err == nil || d.Reasons[0] != "" || d.Reasons[1] == "" {
+		t.Errorf("tampered signature: got %+v, %v", d, err)
+	}
+}
@@ -0,0 +1,111 @@
+// possession.go - Seed commitments and proofs of possession
+
+package sphincs256
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+const (
+	// MinChallengeSize is the minimum length of a proof of possession
+	// challenge in bytes.
+	MinChallengeSize = 16
+
+	// MaxPossessionContextSize is the maximum length of a proof of
+	// possession context in bytes.
+	MaxPossessionContextSize = 255
+
+	possessionLabel     = "sphincs256 proof of possession v1\x00"
+	seedCommitmentLabel = "sphincs256 seed commitment v1\x00"
+)
+
+// ErrNoPossession is the error returned when a proof of possession is
+// invalid.
+var ErrNoPossession = errors.New("sphincs256: invalid proof of possession")
+
+// ProvePossession returns a proof that the caller holds privateKey, for
+// enrollment and keyring admission flows.  The proof is a signature over
+// the challenge, which the verifier must choose at random, bound to the
+// public key and to context, which names the flow (for instance
+// "example.com CA enrollment").
+//
+// The signed message is:
+//
+//	"sphincs256 proof of possession v1\x00" || len(context) || context ||
+//	SHA-256(publicKey) || challenge
+//
+// with the context length a single byte.  Signers must not use Sign on
+// untrusted messages that start with the label.
+func ProvePossession(privateKey *[PrivateKeySize]byte, challenge, context []byte) (*[SignatureSize]byte, error) {
+	pk := (*PrivateKey)(privateKey).Public().(*PublicKey)
+	m, err := possessionMessage((*[PublicKeySize]byte)(pk), challenge, context)
+	if err != nil {
+		return nil, err
+	}
+	return Sign(privateKey, m), nil
+}
+
+// VerifyPossession returns nil if proof is a valid proof of possession of
+// the private key for publicKey, for challenge and context.
+func VerifyPossession(publicKey *[PublicKeySize]byte, challenge, context []byte, proof *[SignatureSize]byte) error {
+	m, err := possessionMessage(publicKey, challenge, context)
+	if err != nil {
+		return err
+	}
+	if err = VerifyWithOptions(publicKey, m, proof, nil); err != nil {
+		return fmt.Errorf("%w: %v", ErrNoPossession, err)
+	}
+	return nil
+}
+
+func possessionMessage(publicKey *[PublicKeySize]byte, challenge, context []byte) ([]byte, error) {
+	if len(challenge) < MinChallengeSize {
+		return nil, fmt.Errorf("sphincs256: challenge must be at least %d bytes", MinChallengeSize)
+	}
+	if len(context) > MaxPossessionContextSize {
+		return nil, fmt.Errorf("sphincs256: context must be at most %d bytes", MaxPossessionContextSize)
+	}
+
+	kh := sha256.Sum256(publicKey[:])
+	m := make([]byte, 0, len(possessionLabel)+1+len(context)+len(kh)+len(challenge))
+	m = append(m, possessionLabel...)
+	m = append(m, byte(len(context)))
+	m = append(m, context...)
+	m = append(m, kh[:]...)
+	return append(m, challenge...), nil
+}
+
+// SeedCommitment returns a commitment to the secret seed of privateKey,
+// bound to its public key:
+//
+//	SHA-256("sphincs256 seed commitment v1\x00" || publicKey || seed)
+//
+// It can be recorded alongside a proof of possession at enrollment, so
+// that the key's holder can later show, by revealing the private key (for
+// instance once the key is retired, or recovered from escrow), that the
+// enrolled key was generated from that seed.  The commitment reveals
+// nothing about the seed, which is uniformly random.
+func SeedCommitment(privateKey *[PrivateKeySize]byte) [CommitmentSize]byte {
+	pk := (*PrivateKey)(privateKey).Public().(*PublicKey)
+	h := sha256.New()
+	h.Write([]byte(seedCommitmentLabel))
+	h.Write(pk[:])
+	h.Write(privateKey[:seedBytes])
+
+	var c [CommitmentSize]byte
+	h.Sum(c[:0])
+	return c
+}
+
+// CheckSeedCommitment returns nil iff commitment is the SeedCommitment of
+// privateKey.
+func CheckSeedCommitment(privateKey *[PrivateKeySize]byte, commitment *[CommitmentSize]byte) error {
+	c := SeedCommitment(privateKey)
+	if subtle.ConstantTimeCompare(c[:], commitment[:]) != 1 {
+		return errors.New("sphincs256: seed does not match commitment")
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// possession_test.go - Seed commitment and proof of possession tests
+
+package sphincs256
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestPossession(t *testing.T) {
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	otherPk, otherSk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+
+	challenge := make([]byte, 32)
+	rand.Read(challenge)
+	ctx := []byte("example CA enrollment")
+	proof, err := ProvePossession(sk, challenge, ctx)
+	if err != nil {
+		t.Fatalf("ProvePossession() failed: %v", err)
+	}
+	if err = VerifyPossession(pk, challenge, ctx, proof); err != nil {
+		t.Fatalf("VerifyPossession() failed: %v", err)
+	}
+
+	other := append([]byte{}, challenge...)
+	other[0] ^= 1
+	for _, tc := range []struct {
+		name      string
+		pk        *[PublicKeySize]byte
+		challenge []byte
+		ctx       []byte
+	}{
+		{"another key", otherPk, challenge, ctx},
+		{"another challenge", pk, other, ctx},
+		{"another context", pk, challenge, []byte("keyring admission")},
+	} {
+		if err = VerifyPossession(tc.pk, tc.challenge, tc.ctx, proof); !errors.Is(err, ErrNoPossession) {
+			t.Errorf("VerifyPossession() with %s: got %v", tc.name, err)
+		}
+	}
+
+	// A plain signature over the challenge is not a proof.
+	if err = VerifyPossession(pk, challenge, ctx, Sign(sk, challenge)); !errors.Is(err, ErrNoPossession) {
+		t.Errorf("VerifyPossession() accepted a plain signature: %v", err)
+	}
+	if _, err = ProvePossession(sk, challenge[:MinChallengeSize-1], ctx); err == nil {
+		t.Errorf("ProvePossession() accepted a short challenge")
+	}
+
+	c := SeedCommitment(sk)
+	if err = CheckSeedCommitment(sk, &c); err != nil {
+		t.Errorf("CheckSeedCommitment() failed: %v", err)
+	}
+	if err = CheckSeedCommitment(otherSk, &c); err == nil {
+		t.Errorf("CheckSeedCommitment() accepted another key")
+	}
+}
@@ -0,0 +1,49 @@
+// prepared.go - Prepared public keys
+
+package sphincs256
+
+import "github.com/yawning/sphincs256/hash"
+
+// PreparedPublicKey is a public key that has been validated and prepared
+// for repeated verification.  It holds a private copy of the key with the
+// mask and root slices pinned, which saves Verify from copying and splitting
+// the key on every call.  It is safe for concurrent use.
+type PreparedPublicKey struct {
+	key   [PublicKeySize]byte
+	masks []byte
+	root  []byte
+}
+
+// NewPreparedPublicKey validates publicKey and returns it prepared for
+// verification.
+func NewPreparedPublicKey(publicKey *[PublicKeySize]byte) (*PreparedPublicKey, error) {
+	// Any byte string is a structurally valid key, however all zero masks or
+	// an all zero root are only ever the result of a wiped key.
+	if err := CheckPublicKey(publicKey); err != nil {
+		return nil, err
+	}
+
+	p := new(PreparedPublicKey)
+	copy(p.key[:], publicKey[:])
+	p.masks = p.key[:nMasks*hash.Size]
+	p.root = p.key[nMasks*hash.Size:]
+	return p, nil
+}
+
+// Verify takes a message and signature and returns true if the signature is
+// valid.
+func (p *PreparedPublicKey) Verify(message []byte, signature *[SignatureSize]byte) bool {
+	return p.VerifyWithOptions(message, signature, nil) == nil
+}
+
+// VerifyWithOptions takes a message and signature and returns nil if the
+// signature is valid, using the provided options.
+func (p *PreparedPublicKey) VerifyWithOptions(message []byte, signature *[SignatureSize]byte, opts *VerifyOptions) error {
+	if err := opts.limits().check(int64(len(message)), VerifyMemory); err != nil {
+		return err
+	}
+	if err := checkVerify(&p.key); err != nil {
+		return err
+	}
+	return verify(p.masks, p.root, hashMessage(signature[:], p.key[:], message), signature, opts)
+}
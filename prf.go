@@ -0,0 +1,68 @@
+// prf.go - Pluggable seed derivation
+
+package sphincs256
+
+import (
+	"encoding/binary"
+	gohash "hash"
+
+	"github.com/yawning/sphincs256/hash"
+	"github.com/yawning/sphincs256/utils"
+)
+
+// SeedSize is the length of the secret seed at the start of a private key,
+// and of each seed derived from it, in bytes.
+const SeedSize = seedBytes
+
+// PRF derives the secret seeds of the WOTS and HORST instances of a key.  A
+// PRF is bound to a single key, so implementations backed by hardware need
+// never expose the key's secret seed.
+type PRF interface {
+	// Seed writes the seed of the instance at address to seed.  The address
+	// is packed as by Address.Pack.
+	//
+	// Seed must be safe for concurrent use, as signing and key derivation
+	// call it from several goroutines at once.
+	Seed(seed *[SeedSize]byte, address uint64)
+}
+
+// Blake256PRF is the standard SPHINCS-256 PRF, keyed with the secret seed of
+// a private key.  It derives each seed as BLAKE-256 over the key followed by
+// the address encoded as a 64 bit little endian integer.
+type Blake256PRF [SeedSize]byte
+
+// Seed implements PRF.
+func (k *Blake256PRF) Seed(seed *[SeedSize]byte, address uint64) {
+	var buffer [SeedSize + 8]byte
+	copy(buffer[:SeedSize], k[:])
+	binary.LittleEndian.PutUint64(buffer[SeedSize:], address)
+	hash.Varlen(seed[:], buffer[:])
+	utils.Zerobytes(buffer[:SeedSize])
+}
+
+// newDefaultPRF returns the standard PRF keyed with the seed in sk.  The PRF
+// aliases sk.
+func newDefaultPRF(sk []byte) PRF {
+	return (*Blake256PRF)(sk[:SeedSize])
+}
+
+// SignWithPRF signs the message like Sign, with the instance seeds derived
+// by prf instead of from the secret seed of privateKey, which is ignored.
+// The masks and the randomization seed of privateKey are used as usual.
+func SignWithPRF(prf PRF, privateKey *[PrivateKeySize]byte, message []byte) *[SignatureSize]byte {
+	leafidx, r := deriveRandomness(privateKey[:], message)
+
+	sm, _ := signMessage(privateKey, prf, leafidx, &r, nil, false, func(h gohash.Hash) error {
+		h.Write(message)
+		return nil
+	})
+	return sm
+}
+
+// DerivePublicKeyWithPRF returns the public key corresponding to the masks
+// of privateKey and the instance seeds derived by prf.
+func DerivePublicKeyWithPRF(prf PRF, privateKey *[PrivateKeySize]byte) *[PublicKeySize]byte {
+	pk := new([PublicKeySize]byte)
+	derivePublicKeyPRF(pk[:], privateKey[:], prf)
+	return pk
+}
@@ -0,0 +1,54 @@
+// prf_test.go - Pluggable seed derivation tests
+
+package sphincs256
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+)
+
+// sha256PRF stands in for an external PRF that holds its own key.
+type sha256PRF struct {
+	key [32]byte
+}
+
+func (p *sha256PRF) Seed(seed *[SeedSize]byte, address uint64) {
+	h := sha256.New()
+	h.Write(p.key[:])
+	binary.Write(h, binary.LittleEndian, address)
+	h.Sum(seed[:0])
+}
+
+func TestPRF(t *testing.T) {
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	msg := []byte("pluggable PRF")
+
+	// The default PRF must reproduce Sign.
+	prf := Blake256PRF(*(*[SeedSize]byte)(sk[:]))
+	if *DerivePublicKeyWithPRF(&prf, sk) != *pk {
+		t.Fatalf("DerivePublicKeyWithPRF() with the default PRF mismatch")
+	}
+	if !bytes.Equal(SignWithPRF(&prf, sk, msg)[:], Sign(sk, msg)[:]) {
+		t.Fatalf("SignWithPRF() with the default PRF mismatch")
+	}
+
+	// An external PRF, with no seed in the private key.
+	ext := new(sha256PRF)
+	rand.Read(ext.key[:])
+	var esk [PrivateKeySize]byte
+	copy(esk[SeedSize:], sk[SeedSize:])
+	epk := DerivePublicKeyWithPRF(ext, &esk)
+	sig := SignWithPRF(ext, &esk, msg)
+	if !Verify(epk, msg, sig) {
+		t.Errorf("SignWithPRF() signature failed to verify")
+	}
+	if Verify(pk, msg, sig) {
+		t.Errorf("SignWithPRF() signature verified with the wrong key")
+	}
+}
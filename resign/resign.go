@@ -0,0 +1,224 @@
+// resign.go - Signature aging and re-signing
+
+// Package resign keeps the signatures in a sigstore.Store verifiable under
+// evolving policy, for long-lived archives.  A Scheduler periodically scans
+// the store, and re-signs with the current Signer every signature that is
+// nearing the policy's maximum age, was made with a deprecated scheme or
+// key, or has no metadata at all.
+//
+// Re-signing needs the signed content, which the store does not hold, so
+// the Scheduler fetches it by digest from a caller supplied ContentFunc,
+// and checks it against the digest before signing.
+package resign
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/bundle"
+	"github.com/yawning/sphincs256/sigstore"
+)
+
+// Policy determines which signatures are re-signed.
+type Policy struct {
+	// MaxAge, if non-zero, is the age at which signatures stop being
+	// acceptable.
+	MaxAge time.Duration
+
+	// Margin is how long before reaching MaxAge signatures are re-signed.
+	Margin time.Duration
+
+	// DeprecatedSchemes are the schemes whose signatures are re-signed.
+	DeprecatedSchemes []string
+
+	// DeprecatedKeys are the lowercase hex fingerprints of the keys whose
+	// signatures are re-signed (see bundle.FingerprintHex).  The Scheduler's
+	// own key must not be among them.
+	DeprecatedKeys []string
+
+	// KeepUnknown leaves signatures without metadata alone, rather than
+	// re-signing them.
+	KeepUnknown bool
+}
+
+// Reason returns why the signature with md must be re-signed at now, or ""
+// if it need not be.  A nil md is a signature without metadata.
+func (p *Policy) Reason(md *sigstore.Metadata, now time.Time) string {
+	if md == nil {
+		if p.KeepUnknown {
+			return ""
+		}
+		return "no metadata"
+	}
+	for _, s := range p.DeprecatedSchemes {
+		if md.Scheme == s {
+			return fmt.Sprintf("deprecated scheme %q", s)
+		}
+	}
+	for _, k := range p.DeprecatedKeys {
+		if md.Fingerprint == k {
+			return "deprecated key"
+		}
+	}
+	if p.MaxAge != 0 && now.Sub(md.SignedAt) >= p.MaxAge-p.Margin {
+		return fmt.Sprintf("signed %v, nearing the maximum age", md.SignedAt)
+	}
+	return ""
+}
+
+// ErrSignerDeprecated is the error returned by Scan when the Scheduler's own
+// key is in Policy.DeprecatedKeys, as every pass would then re-sign the
+// signatures made by the last.
+var ErrSignerDeprecated = errors.New("resign: signer key is deprecated by the policy")
+
+// ContentFunc returns the content with the given digest.
+type ContentFunc func(ctx context.Context, digest *[sigstore.DigestSize]byte) ([]byte, error)
+
+// Result is the outcome for a signature that needed re-signing.
+type Result struct {
+	Digest [sigstore.DigestSize]byte
+
+	// Reason is why the signature needed re-signing.
+	Reason string
+
+	// Err is nil iff the signature was re-signed.
+	Err error
+}
+
+// Report is the outcome of a scan.
+type Report struct {
+	// Scanned is the number of signatures examined.
+	Scanned int
+
+	// Results are the signatures that needed re-signing.
+	Results []Result
+}
+
+// Resigned returns the number of signatures that were re-signed.
+func (r *Report) Resigned() int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Scheduler re-signs the signatures in a store as needed by a Policy.
+type Scheduler struct {
+	// Store is the signature store.  Its backend must implement
+	// sigstore.Lister.
+	Store *sigstore.Store
+
+	// Signer is the current signer.
+	Signer *sphincs256.Signer
+
+	// Content fetches the signed content.
+	Content ContentFunc
+
+	// Policy is the re-signing policy.
+	Policy Policy
+
+	// Interval is the time between scans in Run, 24 hours if zero.
+	Interval time.Duration
+
+	// OnScan, if non-nil, is called with the report of each scan by Run.
+	OnScan func(*Report, error)
+
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// Scan makes a single pass over the store, re-signing signatures as needed.
+// Failures to re-sign a signature are recorded in the report, and do not
+// stop the scan.  The error is only non-nil if the store can not be listed
+// or ctx is done, or the Scheduler is misconfigured.
+func (s *Scheduler) Scan(ctx context.Context) (*Report, error) {
+	pk := s.Signer.Public().(*sphincs256.PublicKey)
+	fp := bundle.FingerprintHex((*[sphincs256.PublicKeySize]byte)(pk))
+	for _, k := range s.Policy.DeprecatedKeys {
+		if k == fp {
+			return nil, ErrSignerDeprecated
+		}
+	}
+
+	digests, err := s.Store.Digests()
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(Report)
+	for i := range digests {
+		if err = ctx.Err(); err != nil {
+			return r, err
+		}
+		d := &digests[i]
+		r.Scanned++
+
+		md, err := s.Store.Metadata(d)
+		switch {
+		case errors.Is(err, sigstore.ErrNotFound):
+			md = nil
+		case err != nil:
+			r.Results = append(r.Results, Result{Digest: *d, Err: err})
+			continue
+		}
+		if reason := s.Policy.Reason(md, s.now()); reason != "" {
+			r.Results = append(r.Results, Result{Digest: *d, Reason: reason, Err: s.resign(ctx, d)})
+		}
+	}
+	return r, nil
+}
+
+func (s *Scheduler) resign(ctx context.Context, digest *[sigstore.DigestSize]byte) error {
+	content, err := s.Content(ctx, digest)
+	if err != nil {
+		return fmt.Errorf("resign: failed to fetch %x: %w", digest[:], err)
+	}
+	if d := sha256.Sum256(content); !bytes.Equal(d[:], digest[:]) {
+		return fmt.Errorf("resign: content fetched for %x does not match its digest", digest[:])
+	}
+
+	pk := s.Signer.Public().(*sphincs256.PublicKey)
+	sig, err := s.Signer.SignMessage(content)
+	if err != nil {
+		return fmt.Errorf("resign: failed to sign %x: %w", digest[:], err)
+	}
+	md := sigstore.NewMetadata((*[sphincs256.PublicKeySize]byte)(pk), s.now())
+	return s.Store.PutWithMetadata(digest, sig, md)
+}
+
+// Run scans the store every Interval, starting immediately, until ctx is
+// done, and then returns ctx.Err().
+func (s *Scheduler) Run(ctx context.Context) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		r, err := s.Scan(ctx)
+		if s.OnScan != nil && ctx.Err() == nil {
+			s.OnScan(r, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (s *Scheduler) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,105 @@
+// resign_test.go - Signature aging and re-signing tests
+
+package resign
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/bundle"
+	"github.com/yawning/sphincs256/sigstore"
+)
+
+func TestScheduler(t *testing.T) {
+	oldPk, oldSk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	newPk, newSk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+
+	now := time.Now()
+	store := sigstore.New(sigstore.NewMemory())
+	contents := make(map[[sigstore.DigestSize]byte][]byte)
+	put := func(content string, sk *[sphincs256.PrivateKeySize]byte, pk *[sphincs256.PublicKeySize]byte, age time.Duration, withMetadata bool) [sigstore.DigestSize]byte {
+		d := sigstore.Digest([]byte(content))
+		contents[d] = []byte(content)
+		sig := sphincs256.Sign(sk, []byte(content))
+		if withMetadata {
+			err = store.PutWithMetadata(&d, sig, sigstore.NewMetadata(pk, now.Add(-age)))
+		} else {
+			err = store.Put(&d, sig)
+		}
+		if err != nil {
+			t.Fatalf("storing %q failed: %v", content, err)
+		}
+		return d
+	}
+
+	fresh := put("fresh", newSk, newPk, time.Hour, true)
+	aging := put("aging", newSk, newPk, 350*24*time.Hour, true)
+	deprecated := put("deprecated key", oldSk, oldPk, time.Hour, true)
+	unknown := put("no metadata", newSk, newPk, 0, false)
+	lost := put("content lost", newSk, newPk, 400*24*time.Hour, true)
+	delete(contents, lost)
+
+	s := &Scheduler{
+		Store:  store,
+		Signer: sphincs256.NewSigner(newSk, nil),
+		Content: func(ctx context.Context, d *[sigstore.DigestSize]byte) ([]byte, error) {
+			c, ok := contents[*d]
+			if !ok {
+				return nil, errors.New("not found")
+			}
+			return c, nil
+		},
+		Policy: Policy{
+			MaxAge:         365 * 24 * time.Hour,
+			Margin:         30 * 24 * time.Hour,
+			DeprecatedKeys: []string{bundle.FingerprintHex(oldPk)},
+		},
+		Now: func() time.Time { return now },
+	}
+	r, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() failed: %v", err)
+	}
+	if r.Scanned != 5 || len(r.Results) != 4 || r.Resigned() != 3 {
+		t.Fatalf("Scan() reported %+v", r)
+	}
+	for _, res := range r.Results {
+		if (res.Err != nil) != (res.Digest == lost) {
+			t.Errorf("result for %x: %v", res.Digest[:4], res.Err)
+		}
+		if res.Digest == fresh {
+			t.Errorf("fresh signature was re-signed")
+		}
+	}
+
+	for _, d := range [][sigstore.DigestSize]byte{aging, deprecated, unknown} {
+		if err = store.Verify(newPk, contents[d]); err != nil {
+			t.Errorf("re-signed %q does not verify: %v", contents[d], err)
+		}
+		md, err := store.Metadata(&d)
+		if err != nil || !md.SignedAt.Equal(now.UTC()) || md.Fingerprint != bundle.FingerprintHex(newPk) {
+			t.Errorf("re-signed %q has metadata %+v, %v", contents[d], md, err)
+		}
+	}
+
+	// A second scan only retries the lost content.
+	if r, _ = s.Scan(context.Background()); len(r.Results) != 1 || r.Results[0].Digest != lost {
+		t.Errorf("second Scan() reported %+v", r)
+	}
+
+	// A policy that deprecates the signer's own key is rejected.
+	s.Policy.DeprecatedKeys = append(s.Policy.DeprecatedKeys, bundle.FingerprintHex(newPk))
+	if _, err = s.Scan(context.Background()); err != ErrSignerDeprecated {
+		t.Errorf("Scan() with the signer's key deprecated returned %v", err)
+	}
+}
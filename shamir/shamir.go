@@ -0,0 +1,129 @@
+// shamir.go - Shamir's secret sharing
+
+// Package shamir implements Shamir's secret sharing over GF(2^8), splitting
+// a secret into n shares such that any k of them recover it, and fewer
+// reveal nothing about it.
+//
+// Each byte of the secret is shared independently, with the field
+// arithmetic done in constant time (no table lookups), using the AES
+// polynomial x^8 + x^4 + x^3 + x + 1.
+package shamir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxShares is the largest number of shares a secret can be split into.
+const MaxShares = 255
+
+// Share is a share of a secret.
+type Share struct {
+	// X is the non-zero evaluation point of the share, its 1 based index.
+	X byte
+
+	// Y is the value of the sharing polynomials at X, one byte per byte of
+	// the secret.
+	Y []byte
+}
+
+// Split splits secret into n shares, any k of which recover it, using
+// rand as the source of entropy.
+func Split(secret []byte, n, k int, rand io.Reader) ([]Share, error) {
+	if k < 1 || k > n || n > MaxShares {
+		return nil, fmt.Errorf("shamir: invalid threshold %d of %d", k, n)
+	}
+
+	// coeffs[j*len(secret)+i] is the coefficient of x^(j+1) of the
+	// polynomial for byte i.
+	coeffs := make([]byte, (k-1)*len(secret))
+	defer zero(coeffs)
+	if _, err := io.ReadFull(rand, coeffs); err != nil {
+		return nil, err
+	}
+
+	shares := make([]Share, n)
+	for s := range shares {
+		x := byte(s + 1)
+		y := make([]byte, len(secret))
+		for i := range y {
+			// Horner's method, from the highest degree coefficient.
+			var v byte
+			for j := k - 2; j >= 0; j-- {
+				v = mul(v^coeffs[j*len(secret)+i], x)
+			}
+			y[i] = v ^ secret[i]
+		}
+		shares[s] = Share{X: x, Y: y}
+	}
+	return shares, nil
+}
+
+// Combine recovers the secret from shares.  With fewer shares than the
+// threshold, the result is unrelated to the secret, and there is no way to
+// tell, so callers should check the recovered secret where possible.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("shamir: no shares")
+	}
+	size := len(shares[0].Y)
+	for i, s := range shares {
+		if s.X == 0 {
+			return nil, errors.New("shamir: invalid share index 0")
+		}
+		if len(s.Y) != size {
+			return nil, errors.New("shamir: shares have different lengths")
+		}
+		for _, t := range shares[:i] {
+			if t.X == s.X {
+				return nil, fmt.Errorf("shamir: duplicate share %d", s.X)
+			}
+		}
+	}
+
+	secret := make([]byte, size)
+	for i, s := range shares {
+		// The Lagrange basis polynomial of share i, evaluated at 0.
+		num, den := byte(1), byte(1)
+		for j, t := range shares {
+			if j != i {
+				num = mul(num, t.X)
+				den = mul(den, t.X^s.X)
+			}
+		}
+		l := mul(num, inv(den))
+		for b := range secret {
+			secret[b] ^= mul(s.Y[b], l)
+		}
+	}
+	return secret, nil
+}
+
+// mul returns a * b in GF(2^8).
+func mul(a, b byte) byte {
+	var r byte
+	for i := 0; i < 8; i++ {
+		r ^= -(b & 1) & a
+		b >>= 1
+		a = a<<1 ^ -(a>>7)&0x1b
+	}
+	return r
+}
+
+// inv returns the inverse of a non-zero a in GF(2^8), a^254.
+func inv(a byte) byte {
+	b := mul(a, a)
+	r := b
+	for i := 0; i < 6; i++ {
+		b = mul(b, b)
+		r = mul(r, b)
+	}
+	return r
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,56 @@
+// shamir_test.go - Shamir's secret sharing tests
+
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestField(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		if mul(byte(a), inv(byte(a))) != 1 {
+			t.Fatalf("inv(%d) is not an inverse", a)
+		}
+	}
+	// x * (x^7 + 1) = x^8 + x = x^4 + x^3 + 1 (mod the AES polynomial).
+	if m := mul(0x02, 0x81); m != 0x19 {
+		t.Fatalf("mul(0x02, 0x81) = %#x", m)
+	}
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("That is not dead which can eternal lie.")
+	shares, err := Split(secret, 5, 3, rand.Reader)
+	if err != nil {
+		t.Fatalf("Split() failed: %v", err)
+	}
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var s []Share
+		for _, i := range subset {
+			s = append(s, shares[i])
+		}
+		got, err := Combine(s)
+		if err != nil || !bytes.Equal(got, secret) {
+			t.Errorf("Combine(%v) failed: %v", subset, err)
+		}
+	}
+
+	if got, _ := Combine(shares[:2]); bytes.Equal(got, secret) {
+		t.Errorf("Combine() recovered the secret from too few shares")
+	}
+	if _, err = Combine([]Share{shares[0], shares[0]}); err == nil {
+		t.Errorf("Combine() accepted duplicate shares")
+	}
+	if _, err = Split(secret, 2, 3, rand.Reader); err == nil {
+		t.Errorf("Split() accepted a threshold above the share count")
+	}
+
+	// A threshold of 1 is plain replication.
+	shares, _ = Split(secret, 2, 1, rand.Reader)
+	if !bytes.Equal(shares[1].Y, secret) {
+		t.Errorf("Split() with threshold 1 did not replicate the secret")
+	}
+}
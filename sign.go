@@ -7,7 +7,9 @@ package sphincs256
 import (
 	"crypto/subtle"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	gohash "hash"
 	"io"
 
 	"github.com/yawning/sphincs256/hash"
@@ -35,29 +37,103 @@ const (
 	skRandSeedBytes      = 32
 	messageHashSeedBytes = 32
 	nMasks               = 2 * horst.LogT // has to be the max of (2*(subtreeHeight+wotsLogL)) and (wotsW-1) and 2*horstLogT
+
+	// randomnessSize is the length of R and the leaf index at the start of a
+	// signature.
+	randomnessSize = messageHashSeedBytes + (totalTreeHeight+7)/8
 )
 
-type leafaddr struct {
-	level   int
-	subtree uint64
-	subleaf int
+var (
+	// ErrVerifyFailed is the error returned when a signature is invalid.
+	ErrVerifyFailed = errors.New("sphincs256: signature verification failed")
+
+	// ErrMalformedChain is matched by the VerifyError returned when a WOTS
+	// signature contains a chain value that is all zero or repeats another
+	// one (see wots.Malformed).
+	ErrMalformedChain = errors.New("sphincs256: malformed WOTS chain value")
+)
+
+// LayerHORST is the VerifyError layer index of the HORST signature.
+const LayerHORST = nLevels
+
+// VerifyError is the error returned when a signature is invalid, recording
+// where in the signature verification failed.  It wraps ErrVerifyFailed.
+//
+// Failures in one of the K secret key and authentication path parts of the
+// HORST signature are pinpointed to that part, as are malformed WOTS chain
+// values (see ErrMalformedChain).  Everything else can only be checked as a
+// whole, against the root in the public key, so such failures are reported
+// at the top layer even though the corruption may be anywhere.
+type VerifyError struct {
+	// Layer is the index of the layer where the failure was detected, with
+	// 0 being the bottom subtree, nLevels - 1 the top subtree, and
+	// LayerHORST the HORST signature.
+	Layer int
+
+	// Offset is the offset in bytes from the start of the signature of the
+	// component that failed verification.
+	Offset int
+
+	// Malformed is set if the component is a malformed WOTS chain value,
+	// which is pinpointed exactly.
+	Malformed bool
 }
 
-func getSeed(seed, sk []byte, a *leafaddr) {
-//	seed = seed[:seedBytes]
+func (e *VerifyError) Error() string {
+	if e.Malformed {
+		return fmt.Sprintf("%s: %s (layer %d, offset %d)", ErrVerifyFailed.Error(), ErrMalformedChain.Error(), e.Layer, e.Offset)
+	}
+	return fmt.Sprintf("%s (layer %d, offset %d)", ErrVerifyFailed.Error(), e.Layer, e.Offset)
+}
+
+// Unwrap returns ErrVerifyFailed.
+func (e *VerifyError) Unwrap() error {
+	return ErrVerifyFailed
+}
 
-	var buffer [seedBytes + 8]byte
-	copy(buffer[0:seedBytes], sk[0:seedBytes])
+// Is returns true iff target is ErrMalformedChain and e is a malformed chain
+// value error.
+func (e *VerifyError) Is(target error) bool {
+	return e.Malformed && target == ErrMalformedChain
+}
 
-	// 4 bits to encode level.
-	t := uint64(a.level)
-	// 55 bits to encode subtree.
-	t |= a.subtree << 4
-	// 5 bits to encode leaf.
-	t |= uint64(a.subleaf) << 59
+func newHorstError(part int) *VerifyError {
+	const partSize = horst.SkBytes + (horst.LogT-6)*hash.Size
+	return &VerifyError{Layer: LayerHORST, Offset: randomnessSize + 64*hash.Size + part*partSize}
+}
 
-	binary.LittleEndian.PutUint64(buffer[seedBytes:], t)
-	hash.Varlen(seed, buffer[:])
+// layerOffset returns the offset of the WOTS signature of layer in the
+// signature.
+func layerOffset(layer int) int {
+	return randomnessSize + horst.SigBytes + layer*(wots.SigBytes+subtreeHeight*hash.Size)
+}
+
+// VerifyOptions are the options for signature verification.
+type VerifyOptions struct {
+	// EarlyAbort makes verification return as soon as a layer of the
+	// signature is found to be invalid, instead of always processing every
+	// layer.  This makes rejecting garbage signatures considerably cheaper,
+	// at the cost of leaking where verification failed through timing.
+	EarlyAbort bool
+
+	// Limits, if non-nil, are the resource limits.  Messages larger than
+	// Limits.MaxMessageSize are rejected before being hashed.
+	Limits *Limits
+}
+
+func (o *VerifyOptions) limits() *Limits {
+	if o == nil {
+		return nil
+	}
+	return o.Limits
+}
+
+var defaultVerifyOptions VerifyOptions
+
+func getSeed(seed []byte, prf PRF, a *Address) {
+//	seed = seed[:seedBytes]
+
+	prf.Seed((*[SeedSize]byte)(seed), a.Pack())
 }
 
 func lTree(leaf, wotsPk, masks []byte) {
@@ -77,25 +153,29 @@ func lTree(leaf, wotsPk, masks []byte) {
 	copy(leaf[:hash.Size], wotsPk[:])
 }
 
-func genLeafWots(leaf, masks, sk []byte, a *leafaddr) {
+func genLeafWots(leaf, masks []byte, prf PRF, a *Address) {
 	var seed [seedBytes]byte
 	var pk [wots.L * hash.Size]byte
 
-	getSeed(seed[:], sk, a)
+	getSeed(seed[:], prf, a)
 	wots.Pkgen(pk[:], seed[:], masks)
 	lTree(leaf, pk[:], masks)
+
+	utils.Zerobytes(seed[:])
 }
 
-func treehash(node []byte, height int, sk []byte, leaf *leafaddr, masks []byte) {
+// treehash computes the root of the height <= subtreeHeight tree starting at
+// leaf in node, calling yield (if non-nil) after each leaf.
+func treehash(node []byte, height int, prf PRF, leaf *Address, masks []byte, yield func()) {
 	a := *leaf
-	stack := make([]byte, (height+1)*hash.Size)
-	stacklevels := make([]uint, height+1)
+	var stack [(subtreeHeight + 1) * hash.Size]byte
+	var stacklevels [subtreeHeight + 1]uint
 	var stackoffset, maskoffset uint
 
-	lastnode := a.subleaf + (1 << uint(height))
+	lastnode := a.Leaf + (1 << uint(height))
 
-	for ; a.subleaf < lastnode; a.subleaf++ {
-		genLeafWots(stack[stackoffset*hash.Size:], masks, sk, &a)
+	for ; a.Leaf < lastnode; a.Leaf++ {
+		genLeafWots(stack[stackoffset*hash.Size:], masks, prf, &a)
 		stacklevels[stackoffset] = 0
 		stackoffset++
 		for stackoffset > 1 && stacklevels[stackoffset-1] == stacklevels[stackoffset-2] {
@@ -105,6 +185,9 @@ func treehash(node []byte, height int, sk []byte, leaf *leafaddr, masks []byte)
 			stacklevels[stackoffset-2]++
 			stackoffset--
 		}
+		if yield != nil {
+			yield()
+		}
 	}
 	copy(node[0:hash.Size], stack[0:hash.Size])
 }
@@ -135,167 +218,324 @@ func validateAuthpath(root, leaf *[hash.Size]byte, leafidx uint, authpath, masks
 	hash.Hash_2n_n_mask(root[:], buffer[:], masks[2*(wots.LogL+height-1)*hash.Size:])
 }
 
-func computeAuthpathWots(root *[hash.Size]byte, authpath []byte, a *leafaddr, sk, masks []byte, height uint) {
-	ta := *a
-	var tree [2 * (1 << subtreeHeight) * hash.Size]byte
-	var seed [(1 << subtreeHeight) * seedBytes]byte
-	var pk [(1 << subtreeHeight) * wots.L * hash.Size]byte
+// subtree is a complete binary tree of height subtreeHeight, stored with the
+// root at node 1 and the leaves at nodes 1<<subtreeHeight and up.
+type subtree [2 * (1 << subtreeHeight) * hash.Size]byte
 
+// genSubtrees builds the subtree at each address in as into the matching
+// entry of trees.  The WOTS leaves of all the subtrees are independent, so
+// they are spread over up to workers() goroutines.
+func genSubtrees(trees []subtree, as []Address, prf PRF, masks []byte) {
 	// Level 0.
-	for ta.subleaf = 0; ta.subleaf < 1<<subtreeHeight; ta.subleaf++ {
-		getSeed(seed[ta.subleaf*seedBytes:], sk, &ta)
-	}
-	for ta.subleaf = 0; ta.subleaf < 1<<subtreeHeight; ta.subleaf++ {
-		wots.Pkgen(pk[ta.subleaf*wots.L*hash.Size:], seed[ta.subleaf*seedBytes:], masks)
-	}
-	for ta.subleaf = 0; ta.subleaf < 1<<subtreeHeight; ta.subleaf++ {
-		lTree(tree[(1<<subtreeHeight)*hash.Size+ta.subleaf*hash.Size:], pk[ta.subleaf*wots.L*hash.Size:], masks)
-	}
+	parallelFor(len(as)<<subtreeHeight, func(i int) {
+		t, ta := &trees[i>>subtreeHeight], as[i>>subtreeHeight]
+		ta.Leaf = i & ((1 << subtreeHeight) - 1)
+		genLeafWots(t[((1<<subtreeHeight)+ta.Leaf)*hash.Size:], masks, prf, &ta)
+	})
 
 	// Tree.
-	level := 0
-	for i := 1 << subtreeHeight; i > 0; i >>= 1 {
-		for j := 0; j < i; j += 2 {
-			hash.Hash_2n_n_mask(tree[(i>>1)*hash.Size+(j>>1)*hash.Size:], tree[i*hash.Size+j*hash.Size:], masks[2*(wots.LogL+level)*hash.Size:])
+	for t := range trees {
+		tree := &trees[t]
+		level := 0
+		for i := 1 << subtreeHeight; i > 0; i >>= 1 {
+			for j := 0; j < i; j += 2 {
+				hash.Hash_2n_n_mask(tree[(i>>1)*hash.Size+(j>>1)*hash.Size:], tree[i*hash.Size+j*hash.Size:], masks[2*(wots.LogL+level)*hash.Size:])
+			}
+			level++
 		}
-		level++
 	}
+}
 
-	// Copy authpath.
-	idx := a.subleaf
+// authpath copies the authentication path of leaf idx to authpath.
+func (tree *subtree) authpath(authpath []byte, idx int, height uint) {
 	for i := uint(0); i < height; i++ {
 		dst := authpath[i*hash.Size : (i+1)*hash.Size]
 		src := tree[((1<<subtreeHeight)>>i)*hash.Size+((idx>>i)^1)*hash.Size:]
 		copy(dst[:], src[:])
 	}
+}
 
-	// Copy root.
-	copy(root[:], tree[hash.Size:])
+// root returns the root of the subtree.
+func (tree *subtree) root() []byte {
+	return tree[hash.Size : 2*hash.Size]
 }
 
-// GenerateKey generates a public/private key pair using randomness from rand.
+// GenerateKey generates a public/private key pair using randomness from rand,
+// or from the default Source if rand is nil.
 func GenerateKey(rand io.Reader) (publicKey *[PublicKeySize]byte, privateKey *[PrivateKeySize]byte, err error) {
 	privateKey = new([PrivateKeySize]byte)
 	publicKey = new([PublicKeySize]byte)
-	_, err = io.ReadFull(rand, privateKey[:])
+	_, err = io.ReadFull(randReader(rand), privateKey[:])
 	if err != nil {
 		return nil, nil, err
 	}
-	copy(publicKey[:nMasks*hash.Size], privateKey[seedBytes:])
+	derivePublicKey(publicKey[:], privateKey[:])
+	return
+}
+
+// GenerateKeyInto generates a public/private key pair using randomness from
+// rand, like GenerateKey, but writes the keys to caller provided storage.
+//
+// It is intended for memory constrained targets: all work is done on the
+// calling goroutine, the tree is built with a fixed size stack of a few KiB
+// rather than held whole, and yield (if non-nil) is called after each of the
+// 32 leaves of the top subtree is computed, so that cooperative schedulers
+// can run other tasks.  It does make small, short lived heap allocations for
+// hash and PRF state.
+func GenerateKeyInto(publicKey *[PublicKeySize]byte, privateKey *[PrivateKeySize]byte, rand io.Reader, yield func()) error {
+	if _, err := io.ReadFull(randReader(rand), privateKey[:]); err != nil {
+		utils.Zerobytes(privateKey[:])
+		return err
+	}
+	derivePublicKeyYield(publicKey[:], privateKey[:], yield)
+	return nil
+}
+
+// derivePublicKey constructs the public key corresponding to sk in pk,
+// spreading the work over up to workers() goroutines.
+func derivePublicKey(pk, sk []byte) {
+	derivePublicKeyPRF(pk, sk, newDefaultPRF(sk))
+}
+
+// derivePublicKeyPRF is derivePublicKey, with the leaf seeds derived by prf
+// rather than from the seed in sk.
+func derivePublicKeyPRF(pk, sk []byte, prf PRF) {
+	var tree [1]subtree
+	a := [1]Address{{Level: nLevels - 1, Subtree: 0, Leaf: 0}}
+
+	copy(pk[:nMasks*hash.Size], sk[seedBytes:])
+	genSubtrees(tree[:], a[:], prf, pk)
+	copy(pk[nMasks*hash.Size:PublicKeySize], tree[0].root())
+}
+
+// derivePublicKeyYield constructs the public key corresponding to sk in pk on
+// the calling goroutine, calling yield (if non-nil) after each leaf.
+func derivePublicKeyYield(pk, sk []byte, yield func()) {
+	copy(pk[:nMasks*hash.Size], sk[seedBytes:])
 
 	// Initialization of top-subtree address.
-	a := leafaddr{level: nLevels - 1, subtree: 0, subleaf: 0}
+	a := Address{Level: nLevels - 1, Subtree: 0, Leaf: 0}
 
 	// Construct top subtree.
-	treehash(publicKey[nMasks*hash.Size:], subtreeHeight, privateKey[:], &a, publicKey[:])
-	return
+	treehash(pk[nMasks*hash.Size:PublicKeySize], subtreeHeight, newDefaultPRF(sk), &a, pk, yield)
 }
 
-// Sign signs the message with privateKey and returns the signature.
-func Sign(privateKey *[PrivateKeySize]byte, message []byte) *[SignatureSize]byte {
-	var sm [SignatureSize]byte
-	var leafidx uint64
-	var r [messageHashSeedBytes]byte
-	var mH []byte
-	var tsk [PrivateKeySize]byte
-	var root [hash.Size]byte
-	var seed [seedBytes]byte
-	var masks [nMasks * hash.Size]byte
+// deriveRandomness deterministically derives the leaf index and the message
+// hash randomizer R from the secret random seed in sk and the message.
+func deriveRandomness(sk, message []byte) (leafidx uint64, r [messageHashSeedBytes]byte) {
+	h := newRandomnessHash(sk)
+	h.Write(message)
+	return randomnessFromHash(h)
+}
 
-	copy(tsk[:], privateKey[:])
+// newRandomnessHash returns the hash that the message is written to, to
+// derive the leaf index and R.
+func newRandomnessHash(sk []byte) gohash.Hash {
+	// XXX: Why Blake 512?
+	h := blake512.New()
+	h.Write(sk[PrivateKeySize-skRandSeedBytes : PrivateKeySize])
+	return h
+}
 
-	// Create leafidx deterministically.
-	{
-		// Shift scratch upwards for convinience.
-		scratch := sm[SignatureSize-skRandSeedBytes:]
+func randomnessFromHash(h gohash.Hash) (leafidx uint64, r [messageHashSeedBytes]byte) {
+	rnd := h.Sum(nil)
 
-		// Copy secret random seed to scratch.
-		copy(scratch[:skRandSeedBytes], tsk[PrivateKeySize-skRandSeedBytes:])
+	// XXX/Yawning: The original code doesn't do endian conversion when
+	// using rnd.  This is probably wrong, so do the Right Thing(TM).
+	leafidx = binary.LittleEndian.Uint64(rnd[0:]) & 0xfffffffffffffff
+	copy(r[:], rnd[16:])
+	utils.Zerobytes(rnd)
+	return
+}
 
-		// XXX: Why Blake 512?
-		h := blake512.New()
-		h.Write(scratch[:skRandSeedBytes])
-		h.Write(message)
-		rnd := h.Sum(nil)
+// putRandomness writes R followed by the leaf index to sigp.
+func putRandomness(sigp []byte, leafidx uint64, r *[messageHashSeedBytes]byte) {
+	copy(sigp[0:messageHashSeedBytes], r[:])
+	sigp = sigp[messageHashSeedBytes:]
 
-		// XXX/Yawning: The original code doesn't do endian conversion when
-		// using rnd.  This is probably wrong, so do the Right Thing(TM).
-		leafidx = binary.LittleEndian.Uint64(rnd[0:]) & 0xfffffffffffffff
-		copy(r[:], rnd[16:])
+	for i := uint64(0); i < (totalTreeHeight+7)/8; i++ {
+		sigp[i] = byte((leafidx >> (8 * i)) & 0xff)
+	}
+}
 
-		// Prepare msgHash
-		scratch = sm[SignatureSize-messageHashSeedBytes-PublicKeySize:]
+// hashMessage computes the randomized message digest that HORST signs.
+func hashMessage(r, pk, message []byte) []byte {
+	h := newMessageHash(r, pk)
+	h.Write(message)
+	return h.Sum(nil)
+}
 
-		// Copy R.
-		copy(scratch[:], r[:])
+// newMessageHash returns the hash that the message is written to, to compute
+// the randomized message digest.
+func newMessageHash(r, pk []byte) gohash.Hash {
+	h := blake512.New()
+	h.Write(r[:messageHashSeedBytes])
+	h.Write(pk[:PublicKeySize])
+	return h
+}
 
-		// Construct and copy pk.
-		a := leafaddr{level: nLevels - 1, subtree: 0, subleaf: 0}
-		pk := scratch[messageHashSeedBytes:]
-		copy(pk[:nMasks*hash.Size], tsk[seedBytes:])
-		treehash(pk[nMasks*hash.Size:], subtreeHeight, tsk[:], &a, pk)
+// horstAddress returns the address of the HORST instance used for leafidx.
+func horstAddress(leafidx uint64) Address {
+	// Use unique value $d$ for HORST address.
+	return Address{Level: nLevels, Leaf: int(leafidx & ((1 << subtreeHeight) - 1)), Subtree: leafidx >> subtreeHeight}
+}
 
-		h.Reset()
-		h.Write(scratch[:messageHashSeedBytes+PublicKeySize])
-		h.Write(message)
-		mH = h.Sum(nil)
+// layerAddresses returns the addresses of the WOTS instances that sign the
+// root of the HORST instance at a, and of each subtree above it.
+func layerAddresses(a Address) (as [nLevels]Address) {
+	for i := 0; i < nLevels; i++ {
+		a.Level = i
+		as[i] = a
+		a.Leaf = int(a.Subtree & ((1 << subtreeHeight) - 1))
+		a.Subtree >>= subtreeHeight
 	}
+	return
+}
 
-	// Use unique value $d$ for HORST address.
-	a := leafaddr{level: nLevels, subleaf: int(leafidx & ((1 << subtreeHeight) - 1)), subtree: leafidx >> subtreeHeight}
+// signHorst writes R, the leaf index and the HORST signature of the message
+// digest mH to sigp, and the HORST root to root, using arena as scratch space
+// if it is non-nil.  It returns the address of the HORST instance used.
+func signHorst(sigp []byte, root *[hash.Size]byte, leafidx uint64, r *[messageHashSeedBytes]byte, prf PRF, masks, mH []byte, arena *horst.Arena) Address {
+	var seed [seedBytes]byte
 
-	sigp := sm[:]
+	a := horstAddress(leafidx)
 
-	copy(sigp[0:messageHashSeedBytes], r[:])
-	sigp = sigp[messageHashSeedBytes:]
+	putRandomness(sigp, leafidx, r)
+	sigp = sigp[messageHashSeedBytes+(totalTreeHeight+7)/8:]
 
-	copy(masks[:], tsk[seedBytes:])
-	for i := uint64(0); i < (totalTreeHeight+7)/8; i++ {
-		sigp[i] = byte((leafidx >> (8 * i)) & 0xff)
+	getSeed(seed[:], prf, &a)
+	if arena == nil {
+		arena = new(horst.Arena)
 	}
-	sigp = sigp[(totalTreeHeight+7)/8:]
+	arena.Sign(sigp, root, nil, &seed, masks, mH, workers())
+	utils.Zerobytes(seed[:])
 
-	getSeed(seed[:], tsk[:], &a)
-	horst.Sign(sigp, &root, message, &seed, masks[:], mH)
-	sigp = sigp[horst.SigBytes:]
+	return a
+}
+
+// signLayers writes the WOTS signatures and authentication paths for all
+// nLevels subtrees to sigp, starting with root signed by the leaf at a.
+func signLayers(sigp []byte, root *[hash.Size]byte, a Address, prf PRF, masks []byte) {
+	var trees [nLevels]subtree
+	var roots [nLevels][hash.Size]byte
 
+	// The subtrees only depend on the leaf address, so build all of them
+	// before producing any signatures.
+	as := layerAddresses(a)
+	genSubtrees(trees[:], as[:], prf, masks)
+
+	roots[0] = *root
 	for i := 0; i < nLevels; i++ {
-		a.level = i
+		off := layerOffset(i) - layerOffset(0)
+		trees[i].authpath(sigp[off+wots.SigBytes:], as[i].Leaf, subtreeHeight)
+		if i+1 < nLevels {
+			copy(roots[i+1][:], trees[i].root())
+		} else {
+			copy(root[:], trees[i].root())
+		}
+	}
 
-		getSeed(seed[:], tsk[:], &a) // XXX: Don't use the same address as for horst_sign here!
-		wots.Sign(sigp, &root, &seed, masks[:])
-		sigp = sigp[wots.SigBytes:]
+	// Each WOTS signature signs the root of the layer below it.
+	parallelFor(nLevels, func(i int) {
+		var seed [seedBytes]byte
 
-		computeAuthpathWots(&root, sigp, &a, tsk[:], masks[:], subtreeHeight)
-		sigp = sigp[subtreeHeight*hash.Size:]
+		getSeed(seed[:], prf, &as[i]) // XXX: Don't use the same address as for horst_sign here!
+		wots.Sign(sigp[layerOffset(i)-layerOffset(0):], &roots[i], &seed, masks)
+
+		utils.Zerobytes(seed[:])
+	})
+}
+
+// Sign signs the message with privateKey and returns the signature.
+func Sign(privateKey *[PrivateKeySize]byte, message []byte) *[SignatureSize]byte {
+	return sign(privateKey, message, nil)
+}
+
+// sign is Sign, using arena as the HORST scratch space if it is non-nil.
+func sign(privateKey *[PrivateKeySize]byte, message []byte, arena *horst.Arena) *[SignatureSize]byte {
+	// Create leafidx deterministically.
+	leafidx, r := deriveRandomness(privateKey[:], message)
+
+	sm, _ := signMessage(privateKey, nil, leafidx, &r, arena, false, func(h gohash.Hash) error {
+		h.Write(message)
+		return nil
+	})
+	return sm
+}
+
+// signMessage signs the message written by writeMessage to the message hash,
+// with the leaf index and R previously derived from the same message.  If
+// prf is nil, the leaf seeds are derived from the seed in privateKey.
+//
+// If chunked is true, the message digest is separated into the domain of
+// SignChunkedDigest.
+func signMessage(privateKey *[PrivateKeySize]byte, prf PRF, leafidx uint64, r *[messageHashSeedBytes]byte, arena *horst.Arena, chunked bool, writeMessage func(gohash.Hash) error) (*[SignatureSize]byte, error) {
+	var sm [SignatureSize]byte
+	var tsk [PrivateKeySize]byte
+	var pk [PublicKeySize]byte
+	var root [hash.Size]byte
+	var masks [nMasks * hash.Size]byte
 
-		a.subleaf = int(a.subtree & ((1 << subtreeHeight) - 1))
-		a.subtree >>= subtreeHeight
+	copy(tsk[:], privateKey[:])
+	defer utils.Zerobytes(tsk[:])
+	copy(masks[:], tsk[seedBytes:])
+	if prf == nil {
+		prf = newDefaultPRF(tsk[:])
 	}
 
-	utils.Zerobytes(tsk[:])
+	// Prepare msgHash.
+	derivePublicKeyPRF(pk[:], tsk[:], prf)
+	h := newMessageHash(r[:], pk[:])
+	if err := writeMessage(h); err != nil {
+		return nil, err
+	}
+	mH := h.Sum(nil)
+	if chunked {
+		mH = chunkedDomain(mH)
+	}
 
-	return &sm
+	a := signHorst(sm[:], &root, leafidx, r, prf, masks[:], mH, arena)
+	signLayers(sm[randomnessSize+horst.SigBytes:], &root, a, prf, masks[:])
+
+	return &sm, nil
 }
 
 // Verify takes a public key, message and signature and returns true if the
 // signature is valid.
 func Verify(publicKey *[PublicKeySize]byte, message []byte, signature *[SignatureSize]byte) bool {
-	var leafidx uint64
-	var wotsPk [wots.L * hash.Size]byte
-	var pkhash [hash.Size]byte
-	var root [hash.Size]byte
+	return VerifyWithOptions(publicKey, message, signature, nil) == nil
+}
+
+// VerifyWithOptions takes a public key, message and signature and returns nil
+// if the signature is valid, using the provided options.  A nil opts is
+// equivalent to the zero value.  If misuse checks are enabled (see
+// SetMisuseChecks), the key is checked first.
+func VerifyWithOptions(publicKey *[PublicKeySize]byte, message []byte, signature *[SignatureSize]byte, opts *VerifyOptions) error {
 	var tpk [PublicKeySize]byte
-	var mH []byte
 
+	if err := opts.limits().check(int64(len(message)), VerifyMemory); err != nil {
+		return err
+	}
+	if err := checkVerify(publicKey); err != nil {
+		return err
+	}
 	copy(tpk[:], publicKey[:])
+	return verify(tpk[:nMasks*hash.Size], tpk[nMasks*hash.Size:], hashMessage(signature[:], tpk[:], message), signature, opts)
+}
 
-	// Construct message hash.
-	h := blake512.New()
-	h.Write(signature[:messageHashSeedBytes])
-	h.Write(tpk[:])
-	h.Write(message)
-	mH = h.Sum(nil)
+// verify is VerifyWithOptions with the public key split into its masks and
+// root, and the message digest mH already computed.  The caller must ensure
+// that the public key is not modified during the call.
+func verify(masks, rewt, mH []byte, signature *[SignatureSize]byte, opts *VerifyOptions) error {
+	if opts == nil {
+		opts = &defaultVerifyOptions
+	}
+
+	var leafidx uint64
+	var malformed *VerifyError
+	var wotsPk [wots.L * hash.Size]byte
+	var pkhash [hash.Size]byte
+	var root [hash.Size]byte
 
 	sigp := signature[:]
 	sigp = sigp[messageHashSeedBytes:]
@@ -303,29 +543,58 @@ func Verify(publicKey *[PublicKeySize]byte, message []byte, signature *[Signatur
 		leafidx |= uint64(sigp[i]) << (8 * i)
 	}
 
-	// XXX/Yawning: Check the return value?
-	horst.Verify(root[:], sigp[(totalTreeHeight+7)/8:], sigp[SignatureSize-messageHashSeedBytes:], tpk[:], mH[:])
+	// On failure the HORST root is zeroed, so the final comparison will fail
+	// even if the remaining layers are processed.
+	horstBad := horst.VerifyIndex(root[:], sigp[(totalTreeHeight+7)/8:], sigp[SignatureSize-messageHashSeedBytes:], masks, mH[:])
+	if horstBad >= 0 && opts.EarlyAbort {
+		return newHorstError(horstBad)
+	}
 
 	sigp = sigp[(totalTreeHeight+7)/8:]
 	sigp = sigp[horst.SigBytes:]
 
 	for i := 0; i < nLevels; i++ {
-		wots.Verify(&wotsPk, sigp, &root, tpk[:])
+		if bad := wots.Verify(&wotsPk, sigp, &root, masks); bad >= 0 && malformed == nil {
+			malformed = &VerifyError{Layer: i, Offset: layerOffset(i) + bad*hash.Size, Malformed: true}
+			if opts.EarlyAbort {
+				return malformed
+			}
+		}
 		sigp = sigp[wots.SigBytes:]
 
-		lTree(pkhash[:], wotsPk[:], tpk[:])
-		validateAuthpath(&root, &pkhash, uint(leafidx&0x1f), sigp, tpk[:], subtreeHeight)
+		lTree(pkhash[:], wotsPk[:], masks)
+		validateAuthpath(&root, &pkhash, uint(leafidx&0x1f), sigp, masks, subtreeHeight)
 		leafidx >>= 5
 		sigp = sigp[subtreeHeight*hash.Size:]
 	}
 
-	tpkRewt := tpk[nMasks*hash.Size:]
-	return subtle.ConstantTimeCompare(root[:], tpkRewt) == 1
+	if horstBad >= 0 {
+		return newHorstError(horstBad)
+	}
+	if malformed != nil {
+		return malformed
+	}
+	if subtle.ConstantTimeCompare(root[:], rewt) != 1 {
+		return &VerifyError{Layer: nLevels - 1, Offset: layerOffset(nLevels - 1)}
+	}
+	return nil
 }
 
 // Open takes a signed message and public key and returns the message if the
 // signature is valid.
 func Open(publicKey *[PublicKeySize]byte, message []byte) (body []byte, err error) {
+	return OpenWithOptions(publicKey, message, nil)
+}
+
+// OpenWithOptions is Open, using the provided options.  A nil opts is
+// equivalent to the zero value.  Signed messages larger than
+// opts.Limits.MaxEnvelopeSize are rejected.
+func OpenWithOptions(publicKey *[PublicKeySize]byte, message []byte, opts *VerifyOptions) (body []byte, err error) {
+	if l := opts.limits(); l != nil {
+		if err = checkLimit("envelope", int64(len(message)), l.MaxEnvelopeSize); err != nil {
+			return nil, err
+		}
+	}
 	if len(message) < SignatureSize {
 		return nil, fmt.Errorf("sphincs256: message length is too short to be valid")
 	}
@@ -334,8 +603,8 @@ func Open(publicKey *[PublicKeySize]byte, message []byte) (body []byte, err erro
 	copy(sig[:], message[:SignatureSize])
 	body = message[SignatureSize:]
 
-	if Verify(publicKey, body, &sig) == false {
-		return nil, fmt.Errorf("sphics256: signature verification failed")
+	if err = VerifyWithOptions(publicKey, body, &sig, opts); err != nil {
+		return nil, err
 	}
 	return body, nil
 }
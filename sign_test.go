@@ -6,7 +6,10 @@ import (
 	"bytes"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"testing"
+
+	"github.com/yawning/sphincs256/hash"
 )
 
 func TestGenerateKey(t *testing.T) {
@@ -136,3 +139,145 @@ func BenchmarkVerify(b *testing.B) {
 		b.StartTimer()
 	}
 }
+
+func TestGenerateKeyInto(t *testing.T) {
+	entropy := make([]byte, PrivateKeySize)
+	for i := range entropy {
+		entropy[i] = byte(i)
+	}
+	expectedPk, expectedSk, err := GenerateKey(bytes.NewReader(entropy))
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+
+	var pk [PublicKeySize]byte
+	var sk [PrivateKeySize]byte
+	yields := 0
+	if err = GenerateKeyInto(&pk, &sk, bytes.NewReader(entropy), func() { yields++ }); err != nil {
+		t.Fatalf("failed GenerateKeyInto(): %s", err)
+	}
+	if !bytes.Equal(pk[:], expectedPk[:]) || !bytes.Equal(sk[:], expectedSk[:]) {
+		t.Errorf("GenerateKeyInto() does not match GenerateKey()")
+	}
+	if yields != 1<<subtreeHeight {
+		t.Errorf("GenerateKeyInto() yielded %d times, expected %d", yields, 1<<subtreeHeight)
+	}
+}
+
+func TestPreparedPublicKey(t *testing.T) {
+	const msg = "The oldest and strongest emotion of mankind is fear."
+
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	p, err := NewPreparedPublicKey(pk)
+	if err != nil {
+		t.Fatalf("failed NewPreparedPublicKey(): %s", err)
+	}
+	sig := Sign(sk, []byte(msg))
+	if !p.Verify([]byte(msg), sig) {
+		t.Errorf("failed Verify()")
+	}
+	if p.Verify([]byte(msg[1:]), sig) {
+		t.Errorf("Verify() accepted a different message")
+	}
+
+	var zero [PublicKeySize]byte
+	if _, err = NewPreparedPublicKey(&zero); err == nil {
+		t.Errorf("NewPreparedPublicKey() accepted a zeroed key")
+	}
+}
+
+func TestVerifyWithOptions(t *testing.T) {
+	const msg = "Searchers after horror haunt strange, far places."
+
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	sig := Sign(sk, []byte(msg))
+
+	for _, opts := range []*VerifyOptions{nil, {EarlyAbort: true}} {
+		if err = VerifyWithOptions(pk, []byte(msg), sig, opts); err != nil {
+			t.Errorf("failed VerifyWithOptions(%+v): %s", opts, err)
+		}
+
+		// Corrupt the HORST signature and the last authentication path.
+		for _, off := range []int{randomnessSize + 64*hash.Size + 1, SignatureSize - 1} {
+			bad := *sig
+			bad[off] ^= 0x01
+			err = VerifyWithOptions(pk, []byte(msg), &bad, opts)
+			if !errors.Is(err, ErrVerifyFailed) {
+				t.Errorf("VerifyWithOptions(%+v) returned %v for a corrupted signature (offset %d)", opts, err, off)
+			}
+			var verr *VerifyError
+			if !errors.As(err, &verr) || verr.Offset > off {
+				t.Errorf("VerifyWithOptions(%+v) returned %v, expected a VerifyError at or before offset %d", opts, err, off)
+			}
+		}
+	}
+}
+
+func TestMalformedChain(t *testing.T) {
+	const msg = "That is not dead which can eternal lie."
+
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	sig := Sign(sk, []byte(msg))
+
+	// Zero fill a chain value, and duplicate another, in different layers.
+	zeroed, dup := *sig, *sig
+	zoff := layerOffset(3) + 5*hash.Size
+	copy(zeroed[zoff:zoff+hash.Size], make([]byte, hash.Size))
+	doff := layerOffset(7) + 9*hash.Size
+	copy(dup[doff:doff+hash.Size], dup[doff-hash.Size:doff])
+
+	for _, opts := range []*VerifyOptions{nil, {EarlyAbort: true}} {
+		for _, c := range []struct {
+			sig   *[SignatureSize]byte
+			layer int
+			off   int
+		}{{&zeroed, 3, zoff}, {&dup, 7, doff}} {
+			err = VerifyWithOptions(pk, []byte(msg), c.sig, opts)
+			var verr *VerifyError
+			if !errors.Is(err, ErrMalformedChain) || !errors.Is(err, ErrVerifyFailed) || !errors.As(err, &verr) {
+				t.Fatalf("VerifyWithOptions(%+v) returned %v, expected a malformed chain error", opts, err)
+			}
+			if verr.Layer != c.layer || verr.Offset != c.off {
+				t.Errorf("VerifyWithOptions(%+v) returned %v, expected layer %d offset %d", opts, err, c.layer, c.off)
+			}
+		}
+	}
+	if err = VerifyWithOptions(pk, []byte(msg), sig, nil); errors.Is(err, ErrMalformedChain) {
+		t.Errorf("VerifyWithOptions() flagged a valid signature: %v", err)
+	}
+}
+
+func TestCanonicalizeSignature(t *testing.T) {
+	const msg = "Almost nobody dances sober, unless they happen to be insane."
+
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	sig := Sign(sk, []byte(msg))
+	if _, err = CanonicalizeSignature(sig[:]); err != nil {
+		t.Errorf("failed CanonicalizeSignature(): %s", err)
+	}
+	if _, err = CanonicalizeSignature(append(sig[:], 0)); err == nil {
+		t.Errorf("CanonicalizeSignature() accepted a padded signature")
+	}
+
+	// The malleated signature still verifies, but is rejected.
+	bad := *sig
+	bad[randomnessSize-1] |= 0x80
+	if !Verify(pk, []byte(msg), &bad) {
+		t.Fatalf("malleated signature no longer verifies, test is stale")
+	}
+	if _, err = CanonicalizeSignature(bad[:]); err == nil {
+		t.Errorf("CanonicalizeSignature() accepted a non-canonical leaf index")
+	}
+}
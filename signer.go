@@ -0,0 +1,301 @@
+// signer.go - Usage tracking signer
+
+package sphincs256
+
+import (
+	"crypto"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/yawning/sphincs256/horst"
+	"github.com/yawning/sphincs256/utils"
+)
+
+// defaultRateWindow is the RateWindow used if MaxRate is set without one.
+const defaultRateWindow = time.Minute
+
+// ErrSignerDestroyed is the error returned when signing with a Signer after
+// Destroy has been called.
+var ErrSignerDestroyed = errors.New("sphincs256: signer destroyed")
+
+// AlarmKind is the kind of threshold an Alarm reports.
+type AlarmKind int
+
+const (
+	// AlarmMaxSignatures is raised once, when the number of signatures
+	// issued reaches SignerOptions.MaxSignatures.
+	AlarmMaxSignatures AlarmKind = iota
+
+	// AlarmMaxFailures is raised once, when the number of failed signing
+	// operations reaches SignerOptions.MaxFailures.
+	AlarmMaxFailures
+
+	// AlarmMaxRate is raised when more than SignerOptions.MaxRate signatures
+	// are issued within SignerOptions.RateWindow (a minute, if 0).  It is
+	// raised again only after the rate has dropped back to the limit.
+	AlarmMaxRate
+)
+
+func (k AlarmKind) String() string {
+	switch k {
+	case AlarmMaxSignatures:
+		return "max-signatures"
+	case AlarmMaxFailures:
+		return "max-failures"
+	case AlarmMaxRate:
+		return "max-rate"
+	default:
+		return "unknown"
+	}
+}
+
+// SignerStats are the usage counters of a Signer.
+type SignerStats struct {
+	// Signatures is the number of signatures issued.
+	Signatures uint64
+
+	// Failures is the number of failed signing operations.
+	Failures uint64
+
+	// Rate is the number of signatures issued within the rate window.
+	Rate int
+}
+
+// Alarm is an anomaly reported by a Signer.
+type Alarm struct {
+	Kind  AlarmKind
+	Stats SignerStats
+}
+
+// SignerOptions are the options for a Signer.  Thresholds that are 0 are
+// disabled.  If MaxRate is set and RateWindow is 0, the window is a minute.
+type SignerOptions struct {
+	MaxSignatures uint64
+	MaxFailures   uint64
+	MaxRate       int
+	RateWindow    time.Duration
+
+	// OnAlarm is called synchronously, without locks held, from the
+	// goroutine whose operation crossed a threshold.
+	OnAlarm func(Alarm)
+
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+
+	// ScratchArenas is the number of HORST scratch arenas, horst.ArenaSize
+	// bytes each, that are kept for reuse by later signing operations.  If
+	// 0, one arena is kept, and if negative, none are.  Concurrent
+	// operations beyond this number allocate their own.
+	ScratchArenas int
+
+	// Limits, if non-nil, are the resource limits applied by the signing
+	// methods.
+	Limits *Limits
+
+	// PublicKey, if non-nil, is the public key the caller expects the
+	// Signer to sign for.  If misuse checks are enabled, Sign and
+	// SignMessage check it with CheckKeyPair.
+	PublicKey *[PublicKeySize]byte
+}
+
+// Signer signs messages with a private key while tracking how the key is
+// used, and raises alarms when usage crosses configured thresholds, so that
+// an unexpectedly chatty signer (possible key misuse or compromise) is
+// noticed from within the custody boundary.  It implements crypto.Signer,
+// and is safe for concurrent use.
+//
+// The Signer keeps its own copy of the private key, which Destroy wipes.
+type Signer struct {
+	public  PublicKey
+	opts    SignerOptions
+	scratch chan *horst.Arena
+
+	keyMu     sync.RWMutex
+	key       PrivateKey
+	destroyed bool
+
+	mu         sync.Mutex
+	stats      SignerStats
+	recent     []time.Time
+	rateRaised bool
+}
+
+// NewSigner returns a Signer for privateKey.  A nil opts is equivalent to
+// the zero value.
+func NewSigner(privateKey *[PrivateKeySize]byte, opts *SignerOptions) *Signer {
+	s := new(Signer)
+	copy(s.key[:], privateKey[:])
+	derivePublicKey(s.public[:], s.key[:])
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.Now == nil {
+		s.opts.Now = time.Now
+	}
+	if s.opts.MaxRate > 0 && s.opts.RateWindow <= 0 {
+		s.opts.RateWindow = defaultRateWindow
+	}
+	switch {
+	case s.opts.ScratchArenas == 0:
+		s.scratch = make(chan *horst.Arena, 1)
+	case s.opts.ScratchArenas > 0:
+		s.scratch = make(chan *horst.Arena, s.opts.ScratchArenas)
+	}
+	return s
+}
+
+// Public returns the *PublicKey corresponding to the Signer's private key.
+func (s *Signer) Public() crypto.PublicKey {
+	pub := s.public
+	return &pub
+}
+
+// Sign signs message, and returns the signature.  opts.HashFunc() must
+// return 0, and rand is ignored.
+//
+// This method implements crypto.Signer.
+func (s *Signer) Sign(rand io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.Hash(0) {
+		s.record(false)
+		return nil, errors.New("sphincs256: cannot sign hashed message")
+	}
+	sig, err := s.SignMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	return sig[:], nil
+}
+
+// SignMessage signs message, and returns the signature.  It applies the same
+// resource limits and misuse checks as Sign.
+func (s *Signer) SignMessage(message []byte) (*[SignatureSize]byte, error) {
+	if err := s.opts.Limits.check(int64(len(message)), SignMemory); err != nil {
+		s.record(false)
+		return nil, err
+	}
+
+	s.keyMu.RLock()
+	defer s.keyMu.RUnlock()
+	if s.destroyed {
+		s.record(false)
+		return nil, ErrSignerDestroyed
+	}
+	if err := checkSign((*[PrivateKeySize]byte)(&s.key), s.opts.PublicKey, message); err != nil {
+		s.record(false)
+		return nil, err
+	}
+	arena := s.getArena()
+	sig := sign((*[PrivateKeySize]byte)(&s.key), message, arena)
+	s.putArena(arena)
+	s.record(true)
+	return sig, nil
+}
+
+// SignReader signs the message read from r, as with the package level
+// SignReader.
+func (s *Signer) SignReader(r io.ReadSeeker) (*[SignatureSize]byte, error) {
+	if err := s.opts.Limits.check(0, SignMemory); err != nil {
+		s.record(false)
+		return nil, err
+	}
+	s.keyMu.RLock()
+	defer s.keyMu.RUnlock()
+	if s.destroyed {
+		s.record(false)
+		return nil, ErrSignerDestroyed
+	}
+	arena := s.getArena()
+	sig, err := signReader((*[PrivateKeySize]byte)(&s.key), r, arena, s.opts.Limits)
+	s.putArena(arena)
+	s.record(err == nil)
+	return sig, err
+}
+
+// Destroy wipes the Signer's copy of the private key, after waiting for
+// signing operations in progress to finish.  Later signing operations fail
+// with ErrSignerDestroyed.
+func (s *Signer) Destroy() {
+	s.keyMu.Lock()
+	defer s.keyMu.Unlock()
+	utils.Zerobytes(s.key[:])
+	s.destroyed = true
+}
+
+// getArena returns a retained scratch arena, or a new one if there is none.
+func (s *Signer) getArena() *horst.Arena {
+	select {
+	case a := <-s.scratch:
+		return a
+	default:
+		return new(horst.Arena)
+	}
+}
+
+// putArena retains a for reuse, if there is room.
+func (s *Signer) putArena(a *horst.Arena) {
+	select {
+	case s.scratch <- a:
+	default:
+	}
+}
+
+// Stats returns the current usage counters.
+func (s *Signer) Stats() SignerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trim(s.opts.Now())
+	return s.stats
+}
+
+func (s *Signer) trim(now time.Time) {
+	if s.opts.RateWindow <= 0 {
+		return
+	}
+	i := 0
+	for i < len(s.recent) && now.Sub(s.recent[i]) >= s.opts.RateWindow {
+		i++
+	}
+	s.recent = s.recent[i:]
+	s.stats.Rate = len(s.recent)
+}
+
+func (s *Signer) record(ok bool) {
+	var alarms []AlarmKind
+
+	s.mu.Lock()
+	if !ok {
+		s.stats.Failures++
+		if s.stats.Failures == s.opts.MaxFailures {
+			alarms = append(alarms, AlarmMaxFailures)
+		}
+	} else {
+		s.stats.Signatures++
+		if s.stats.Signatures == s.opts.MaxSignatures {
+			alarms = append(alarms, AlarmMaxSignatures)
+		}
+		if s.opts.RateWindow > 0 {
+			now := s.opts.Now()
+			s.recent = append(s.recent, now)
+			s.trim(now)
+		}
+	}
+	if s.opts.MaxRate > 0 {
+		over := s.stats.Rate > s.opts.MaxRate
+		if over && !s.rateRaised {
+			alarms = append(alarms, AlarmMaxRate)
+		}
+		s.rateRaised = over
+	}
+	stats := s.stats
+	s.mu.Unlock()
+
+	if s.opts.OnAlarm != nil {
+		for _, k := range alarms {
+			s.opts.OnAlarm(Alarm{Kind: k, Stats: stats})
+		}
+	}
+}
+
+var _ crypto.Signer = (*Signer)(nil)
@@ -0,0 +1,138 @@
+// signer_test.go - Usage tracking signer tests
+
+package sphincs256
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/yawning/sphincs256/horst"
+)
+
+func TestSignerAlarms(t *testing.T) {
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+
+	now := time.Unix(0, 0)
+	var alarms []AlarmKind
+	s := NewSigner(sk, &SignerOptions{
+		MaxSignatures: 3,
+		MaxFailures:   1,
+		MaxRate:       1,
+		RateWindow:    time.Minute,
+		OnAlarm:       func(a Alarm) { alarms = append(alarms, a.Kind) },
+		Now:           func() time.Time { return now },
+	})
+	if !(*PublicKey)(pk).Equal(s.Public()) {
+		t.Fatalf("Public() does not match the key pair")
+	}
+
+	msg := []byte("The Whisperer in Darkness")
+	sig, err := s.SignMessage(msg)
+	if err != nil {
+		t.Fatalf("failed SignMessage(): %s", err)
+	}
+	if !Verify(pk, msg, sig) {
+		t.Errorf("failed Verify()")
+	}
+	s.SignMessage(msg) // Two in a minute: rate alarm.
+	now = now.Add(2 * time.Minute)
+	s.SignMessage(msg) // Third signature: count alarm, rate re-armed.
+	if _, err = s.Sign(nil, msg, crypto.SHA512); err == nil {
+		t.Errorf("Sign() accepted a prehashed message")
+	}
+
+	expected := []AlarmKind{AlarmMaxRate, AlarmMaxSignatures, AlarmMaxFailures}
+	if len(alarms) != len(expected) {
+		t.Fatalf("alarms = %v, expected %v", alarms, expected)
+	}
+	for i := range expected {
+		if alarms[i] != expected[i] {
+			t.Errorf("alarms = %v, expected %v", alarms, expected)
+		}
+	}
+	if st := s.Stats(); st.Signatures != 3 || st.Failures != 1 || st.Rate != 1 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
+
+func TestSignerScratch(t *testing.T) {
+	_, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	msg := []byte("reuse the arena")
+	s := NewSigner(sk, nil)
+	sig, err := s.SignMessage(msg)
+	if err != nil {
+		t.Fatalf("failed Signer.SignMessage(): %s", err)
+	}
+	if *sig != *Sign(sk, msg) {
+		t.Fatalf("Signer.SignMessage() differs from Sign()")
+	}
+
+	// The retained arena is reused, so a second signature allocates far
+	// less than an arena.
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	s.SignMessage(msg)
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n >= horst.ArenaSize {
+		t.Errorf("Signer.SignMessage() allocated %d bytes with a retained arena", n)
+	}
+}
+
+func TestSignerRateWindow(t *testing.T) {
+	_, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+
+	// MaxRate without a RateWindow uses the default window.
+	now := time.Unix(0, 0)
+	var alarms []AlarmKind
+	s := NewSigner(sk, &SignerOptions{
+		MaxRate: 1,
+		OnAlarm: func(a Alarm) { alarms = append(alarms, a.Kind) },
+		Now:     func() time.Time { return now },
+	})
+	msg := []byte("The Shadow over Innsmouth")
+	s.SignMessage(msg)
+	s.SignMessage(msg)
+	if len(alarms) != 1 || alarms[0] != AlarmMaxRate {
+		t.Errorf("alarms = %v, expected the rate alarm", alarms)
+	}
+	now = now.Add(defaultRateWindow)
+	if st := s.Stats(); st.Rate != 0 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
+
+func TestSignerDestroy(t *testing.T) {
+	_, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	msg := []byte("The Thing on the Doorstep")
+	s := NewSigner(sk, nil)
+	s.Destroy()
+
+	if s.key != (PrivateKey{}) {
+		t.Errorf("Destroy() did not wipe the private key")
+	}
+	if _, err = s.Sign(nil, msg, crypto.Hash(0)); err != ErrSignerDestroyed {
+		t.Errorf("Sign() after Destroy() returned %v", err)
+	}
+	if _, err = s.SignReader(bytes.NewReader(msg)); err != ErrSignerDestroyed {
+		t.Errorf("SignReader() after Destroy() returned %v", err)
+	}
+	if _, err = s.SignMessage(msg); err != ErrSignerDestroyed {
+		t.Errorf("SignMessage() after Destroy() returned %v", err)
+	}
+}
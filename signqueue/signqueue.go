@@ -0,0 +1,361 @@
+// signqueue.go - Asynchronous signing queue
+
+// Package signqueue implements an asynchronous SPHINCS-256 signing queue, so
+// that latency sensitive code can offload CPU heavy signing.  Messages are
+// submitted to the queue, and the signatures are polled for or awaited by
+// job ID.  Signing is done by a sphincs256.Signer, so the queue's usage is
+// accounted for, and limited, with that of the Signer's other callers.
+//
+// If a persistence directory is configured, each submitted message is
+// written to disk before Submit returns, and each signature before the job
+// completes.  Jobs that were pending when the process exited are resumed
+// when a Queue is next opened on the directory, and completed signatures
+// remain retrievable until removed.
+package signqueue
+
+import (
+	"context"
+	"crypto"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yawning/sphincs256"
+)
+
+const (
+	msgExt = ".msg"
+	sigExt = ".sig"
+
+	defaultMaxAttempts = 3
+	retryDelay         = 100 * time.Millisecond
+)
+
+var (
+	// ErrNotFound is the error returned for unknown job IDs.
+	ErrNotFound = errors.New("signqueue: job not found")
+
+	// ErrClosed is the error returned when submitting to a closed queue, and
+	// for jobs that were not started before the queue was closed.
+	ErrClosed = errors.New("signqueue: queue is closed")
+)
+
+// ID is a job identifier.
+type ID string
+
+// Options are the options for a Queue.
+type Options struct {
+	// Workers is the number of signing goroutines, GOMAXPROCS if 0.
+	Workers int
+
+	// Dir is the persistence directory.  Jobs are only held in memory if
+	// empty.
+	Dir string
+
+	// MaxAttempts is the number of times writing a job's signature to the
+	// persistence directory is attempted before the job fails, 3 if 0.
+	// Only persistence is retried.  A job that the Signer fails to sign,
+	// such as for exceeding its limits, fails at once and is removed from
+	// the persistence directory.
+	MaxAttempts int
+}
+
+type job struct {
+	id   ID
+	msg  []byte
+	done chan struct{}
+	sig  *[sphincs256.SignatureSize]byte
+	err  error
+}
+
+// Queue is an asynchronous signing queue.  It is safe for concurrent use.
+type Queue struct {
+	signer *sphincs256.Signer
+	opts   Options
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*job
+	jobs    map[ID]*job
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// New returns a Queue that signs with signer, resuming any jobs that are
+// pending in the persistence directory.  A nil opts is equivalent to the
+// zero value.
+func New(signer *sphincs256.Signer, opts *Options) (*Queue, error) {
+	if signer == nil {
+		return nil, errors.New("signqueue: nil signer")
+	}
+	q := &Queue{
+		signer: signer,
+		jobs:   make(map[ID]*job),
+	}
+	if opts != nil {
+		q.opts = *opts
+	}
+	if q.opts.Workers <= 0 {
+		q.opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	if q.opts.MaxAttempts <= 0 {
+		q.opts.MaxAttempts = defaultMaxAttempts
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	if q.opts.Dir != "" {
+		if err := q.resume(); err != nil {
+			return nil, err
+		}
+	}
+
+	q.wg.Add(q.opts.Workers)
+	for i := 0; i < q.opts.Workers; i++ {
+		go q.worker()
+	}
+	return q, nil
+}
+
+func (q *Queue) resume() error {
+	if err := os.MkdirAll(q.opts.Dir, 0700); err != nil {
+		return err
+	}
+	matches, err := filepath.Glob(filepath.Join(q.opts.Dir, "*"+msgExt))
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		id := ID(strings.TrimSuffix(filepath.Base(m), msgExt))
+		msg, err := os.ReadFile(m)
+		if err != nil {
+			return err
+		}
+		j := &job{id: id, msg: msg, done: make(chan struct{})}
+		q.jobs[id] = j
+		q.pending = append(q.pending, j)
+	}
+	return nil
+}
+
+// Submit queues message for signing, and returns the job ID.
+func (q *Queue) Submit(message []byte) (ID, error) {
+	if q.isClosed() {
+		return "", ErrClosed
+	}
+
+	var b [16]byte
+	if _, err := io.ReadFull(sphincs256.DefaultSource(), b[:]); err != nil {
+		return "", err
+	}
+	j := &job{
+		id:   ID(hex.EncodeToString(b[:])),
+		msg:  append([]byte{}, message...),
+		done: make(chan struct{}),
+	}
+	if q.opts.Dir != "" {
+		if err := writeFile(q.path(j.id, msgExt), j.msg); err != nil {
+			return "", err
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		// Close won the race, so the job must not be resumed later either.
+		if q.opts.Dir != "" {
+			os.Remove(q.path(j.id, msgExt))
+		}
+		return "", ErrClosed
+	}
+	q.jobs[j.id] = j
+	q.pending = append(q.pending, j)
+	q.cond.Signal()
+	return j.id, nil
+}
+
+// Poll returns the signature for the job if it has completed.  It returns
+// nil, nil if the job is still pending.
+func (q *Queue) Poll(id ID) (*[sphincs256.SignatureSize]byte, error) {
+	j, err := q.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-j.done:
+		return j.sig, j.err
+	default:
+		return nil, nil
+	}
+}
+
+// Wait waits for the job to complete, and returns the signature.
+func (q *Queue) Wait(ctx context.Context, id ID) (*[sphincs256.SignatureSize]byte, error) {
+	j, err := q.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-j.done:
+		return j.sig, j.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Remove forgets a completed job, deleting its persisted signature, and its
+// message if the job failed or was not started, so that it is not resumed.
+func (q *Queue) Remove(id ID) error {
+	j, err := q.lookup(id)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-j.done:
+	default:
+		return errors.New("signqueue: job is still pending")
+	}
+
+	q.mu.Lock()
+	delete(q.jobs, id)
+	q.mu.Unlock()
+	if q.opts.Dir != "" {
+		for _, ext := range []string{sigExt, msgExt} {
+			if err = os.Remove(q.path(id, ext)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close stops accepting jobs, and waits for the workers to finish the jobs
+// that are in progress.  Jobs that have not been started complete with
+// ErrClosed, but remain pending in the persistence directory, if any, to be
+// resumed when a Queue is next opened on it.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	q.wg.Wait()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, j := range q.pending {
+		j.err = ErrClosed
+		close(j.done)
+	}
+	q.pending = nil
+}
+
+func (q *Queue) isClosed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+func (q *Queue) lookup(id ID) (*job, error) {
+	q.mu.Lock()
+	j, ok := q.jobs[id]
+	q.mu.Unlock()
+	if ok {
+		return j, nil
+	}
+
+	// Completed jobs from a previous process are only on disk.
+	if q.opts.Dir == "" || strings.ContainsAny(string(id), `/\.`) {
+		return nil, ErrNotFound
+	}
+	b, err := os.ReadFile(q.path(id, sigExt))
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	sig, err := sphincs256.CanonicalizeSignature(b)
+	if err != nil {
+		return nil, err
+	}
+	j = &job{id: id, done: make(chan struct{}), sig: sig}
+	close(j.done)
+	return j, nil
+}
+
+func (q *Queue) worker() {
+	defer q.wg.Done()
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		j := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		var sig []byte
+		if sig, j.err = q.signer.Sign(nil, j.msg, crypto.Hash(0)); j.err == nil {
+			j.sig = (*[sphincs256.SignatureSize]byte)(sig)
+		}
+		if q.opts.Dir != "" {
+			if j.err == nil {
+				j.err = q.persist(j)
+			} else {
+				// Signing failures are terminal, and would recur each time
+				// the job is resumed.
+				os.Remove(q.path(j.id, msgExt))
+			}
+		}
+		if j.err != nil {
+			j.sig = nil
+		}
+		close(j.done)
+	}
+}
+
+func (q *Queue) persist(j *job) error {
+	var err error
+	for i := 0; i < q.opts.MaxAttempts; i++ {
+		if i > 0 {
+			time.Sleep(retryDelay << uint(i-1))
+		}
+		if err = writeFile(q.path(j.id, sigExt), j.sig[:]); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(q.path(j.id, msgExt))
+}
+
+func (q *Queue) path(id ID, ext string) string {
+	return filepath.Join(q.opts.Dir, string(id)+ext)
+}
+
+func writeFile(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
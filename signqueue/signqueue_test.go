@@ -0,0 +1,190 @@
+// signqueue_test.go - Asynchronous signing queue tests
+
+package signqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yawning/sphincs256"
+)
+
+func TestQueue(t *testing.T) {
+	pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, dir := range []string{"", t.TempDir()} {
+		signer := sphincs256.NewSigner(sk, nil)
+		q, err := New(signer, &Options{Workers: 2, Dir: dir})
+		if err != nil {
+			t.Fatalf("failed New(): %s", err)
+		}
+
+		msgs := []string{"Nyarlathotep", "Azathoth", "Shub-Niggurath"}
+		ids := make([]ID, len(msgs))
+		for i, m := range msgs {
+			if ids[i], err = q.Submit([]byte(m)); err != nil {
+				t.Fatalf("failed Submit(): %s", err)
+			}
+		}
+		for i, id := range ids {
+			sig, err := q.Wait(ctx, id)
+			if err != nil {
+				t.Fatalf("failed Wait(): %s", err)
+			}
+			if !sphincs256.Verify(pk, []byte(msgs[i]), sig) {
+				t.Errorf("signature %d does not verify", i)
+			}
+		}
+		q.Close()
+		if st := signer.Stats(); st.Signatures != uint64(len(msgs)) {
+			t.Errorf("Signer stats: %+v", st)
+		}
+		if _, err = q.Submit(nil); err != ErrClosed {
+			t.Errorf("Submit() to a closed queue returned %v", err)
+		}
+		if dir != "" {
+			if m, _ := filepath.Glob(filepath.Join(dir, "*"+msgExt)); len(m) != 0 {
+				t.Errorf("Submit() to a closed queue persisted %v", m)
+			}
+		}
+
+		if dir == "" {
+			continue
+		}
+
+		// Completed jobs survive a restart.
+		q, err = New(signer, &Options{Dir: dir})
+		if err != nil {
+			t.Fatalf("failed New(): %s", err)
+		}
+		if sig, err := q.Poll(ids[0]); err != nil || !sphincs256.Verify(pk, []byte(msgs[0]), sig) {
+			t.Errorf("persisted signature not recovered: %v", err)
+		}
+		if err = q.Remove(ids[0]); err != nil {
+			t.Errorf("failed Remove(): %s", err)
+		}
+		if _, err = q.Poll(ids[0]); err != ErrNotFound {
+			t.Errorf("Poll() of a removed job returned %v", err)
+		}
+		q.Close()
+
+		// As do pending ones.
+		if err = os.WriteFile(filepath.Join(dir, "pending"+msgExt), []byte("Dagon"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		q, err = New(signer, &Options{Dir: dir})
+		if err != nil {
+			t.Fatalf("failed New(): %s", err)
+		}
+		sig, err := q.Wait(ctx, "pending")
+		if err != nil || !sphincs256.Verify(pk, []byte("Dagon"), sig) {
+			t.Errorf("pending job not resumed: %v", err)
+		}
+		q.Close()
+	}
+}
+
+func TestCloseQueued(t *testing.T) {
+	pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, dir := range []string{"", t.TempDir()} {
+		signer := sphincs256.NewSigner(sk, nil)
+		q, err := New(signer, &Options{Workers: 1, Dir: dir})
+		if err != nil {
+			t.Fatalf("failed New(): %s", err)
+		}
+
+		// The single worker can start at most one job before Close.
+		const n = 8
+		ids := make([]ID, n)
+		for i := range ids {
+			if ids[i], err = q.Submit([]byte("Yog-Sothoth")); err != nil {
+				t.Fatalf("failed Submit(): %s", err)
+			}
+		}
+		q.Close()
+
+		closed := 0
+		for _, id := range ids {
+			sig, err := q.Wait(ctx, id)
+			switch err {
+			case nil:
+				if !sphincs256.Verify(pk, []byte("Yog-Sothoth"), sig) {
+					t.Errorf("signature does not verify")
+				}
+			case ErrClosed:
+				closed++
+				if sig, err = q.Poll(id); sig != nil || err != ErrClosed {
+					t.Errorf("Poll() of an unstarted job returned %v", err)
+				}
+			default:
+				t.Fatalf("Wait() returned %v", err)
+			}
+		}
+		if closed < n-1 {
+			t.Errorf("Close() left %d unstarted jobs unfinished", n-1-closed)
+		}
+
+		if dir == "" {
+			continue
+		}
+
+		// Unstarted jobs are resumed from the persistence directory.
+		if m, _ := filepath.Glob(filepath.Join(dir, "*"+msgExt)); len(m) != closed {
+			t.Errorf("%d unstarted jobs, %d persisted", closed, len(m))
+		}
+		q, err = New(signer, &Options{Dir: dir})
+		if err != nil {
+			t.Fatalf("failed New(): %s", err)
+		}
+		for _, id := range ids {
+			if _, err = q.Wait(ctx, id); err != nil {
+				t.Errorf("job not resumed: %v", err)
+			}
+		}
+		q.Close()
+	}
+}
+
+func TestSignFailure(t *testing.T) {
+	_, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir := t.TempDir()
+	signer := sphincs256.NewSigner(sk, &sphincs256.SignerOptions{Limits: &sphincs256.Limits{MaxMessageSize: 4}})
+	q, err := New(signer, &Options{Dir: dir})
+	if err != nil {
+		t.Fatalf("failed New(): %s", err)
+	}
+	id, err := q.Submit([]byte("Cthugha"))
+	if err != nil {
+		t.Fatalf("failed Submit(): %s", err)
+	}
+	if _, err = q.Wait(ctx, id); err == nil {
+		t.Fatalf("Wait() of an oversized message succeeded")
+	}
+	q.Close()
+
+	// The failed job is not resumed.
+	if m, _ := filepath.Glob(filepath.Join(dir, "*"+msgExt)); len(m) != 0 {
+		t.Errorf("failed job left %v", m)
+	}
+}
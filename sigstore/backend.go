@@ -0,0 +1,154 @@
+// backend.go - Signature store backends
+
+package sigstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNotFound is the error returned when a store has no signature for
+	// a digest.
+	ErrNotFound = errors.New("sigstore: signature not found")
+
+	// ErrInvalidKey is the error returned when a backend is passed a key
+	// that is not a lower case hexadecimal digest.
+	ErrInvalidKey = errors.New("sigstore: invalid key")
+)
+
+// Backend is a key/value store that holds encoded signatures.  Keys are
+// lower case hexadecimal digests.  Implementations must be safe for
+// concurrent use, and Get must return ErrNotFound for missing keys.
+type Backend interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+}
+
+// Dir is a Backend that stores each signature in a file named after its key
+// under the directory, sharded by the first two characters of the key.  Keys
+// that are not lower case hexadecimal, optionally followed by the metadata
+// suffix, are rejected with ErrInvalidKey.
+type Dir string
+
+func (d Dir) path(key string) (string, error) {
+	hexKey := strings.TrimSuffix(key, metadataSuffix)
+	if len(hexKey) < 2 {
+		return "", ErrInvalidKey
+	}
+	for _, c := range hexKey {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return "", ErrInvalidKey
+		}
+	}
+	return filepath.Join(string(d), key[:2], key), nil
+}
+
+// Get implements Backend.
+func (d Dir) Get(key string) ([]byte, error) {
+	p, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+// List implements Lister.
+func (d Dir) List() ([]string, error) {
+	shards, err := os.ReadDir(string(d))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var keys []string
+	for _, shard := range shards {
+		if !shard.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(string(d), shard.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() && !strings.HasPrefix(e.Name(), ".tmp-") {
+				keys = append(keys, e.Name())
+			}
+		}
+	}
+	return keys, nil
+}
+
+// Put implements Backend.  The file is written atomically.
+func (d Dir) Put(key string, value []byte) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-"+key)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(value); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// Memory is an in-memory Backend.
+type Memory struct {
+	mu sync.RWMutex
+	m  map[string][]byte
+}
+
+// NewMemory returns an empty in-memory Backend.
+func NewMemory() *Memory {
+	return &Memory{m: make(map[string][]byte)}
+}
+
+// Get implements Backend.
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v, ok := m.m[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, v...), nil
+}
+
+// List implements Lister.
+func (m *Memory) List() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]string, 0, len(m.m))
+	for k := range m.m {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// Put implements Backend.
+func (m *Memory) Put(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.m[key] = append([]byte{}, value...)
+	return nil
+}
@@ -0,0 +1,131 @@
+// metadata.go - Signature metadata
+
+package sigstore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/bundle"
+)
+
+const (
+	// SchemeSPHINCS256 is the Metadata scheme of sphincs256.Sign
+	// signatures.
+	SchemeSPHINCS256 = "sphincs256"
+
+	metadataSuffix = ".meta"
+)
+
+// ErrNotListable is the error returned by Digests when the backend does not
+// implement Lister.
+var ErrNotListable = errors.New("sigstore: backend can not list signatures")
+
+// Lister is implemented by Backends that can enumerate their keys.
+type Lister interface {
+	List() ([]string, error)
+}
+
+// Metadata records how a stored signature was made, so that signatures can
+// be aged out and re-signed as policy evolves.
+type Metadata struct {
+	// Scheme is the signature scheme, such as SchemeSPHINCS256.
+	Scheme string `json:"scheme"`
+
+	// Fingerprint is the lowercase hex fingerprint of the signer's public
+	// key (see bundle.FingerprintHex).
+	Fingerprint string `json:"fingerprint"`
+
+	// SignedAt is the time the signature was made.
+	SignedAt time.Time `json:"signed_at"`
+}
+
+// NewMetadata returns the metadata of a SchemeSPHINCS256 signature by
+// publicKey made at signedAt.
+func NewMetadata(publicKey *[sphincs256.PublicKeySize]byte, signedAt time.Time) *Metadata {
+	return &Metadata{Scheme: SchemeSPHINCS256, Fingerprint: bundle.FingerprintHex(publicKey), SignedAt: signedAt.UTC()}
+}
+
+// PutWithMetadata stores the detached signature for the content with the
+// given digest, along with its metadata.
+func (s *Store) PutWithMetadata(digest *[DigestSize]byte, signature *[sphincs256.SignatureSize]byte, md *Metadata) error {
+	b, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	// The metadata is written last, so that if either write fails, the
+	// stored signature has no metadata rather than metadata describing a
+	// signature that was never stored.
+	if err = s.Put(digest, signature); err != nil {
+		return err
+	}
+	return s.backend.Put(metadataKey(digest), b)
+}
+
+// Metadata returns the metadata of the signature for the content with the
+// given digest, or ErrNotFound if there is none.
+func (s *Store) Metadata(digest *[DigestSize]byte) (*Metadata, error) {
+	b, err := s.backend.Get(metadataKey(digest))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, ErrNotFound
+	}
+	md := new(Metadata)
+	if err = json.Unmarshal(b, md); err != nil {
+		return nil, fmt.Errorf("sigstore: invalid metadata: %v", err)
+	}
+	return md, nil
+}
+
+// invalidateMetadata empties the metadata of the signature for the content
+// with the given digest, if there is any, as Backend has no way to delete
+// keys.
+func (s *Store) invalidateMetadata(digest *[DigestSize]byte) error {
+	key := metadataKey(digest)
+	b, err := s.backend.Get(key)
+	switch {
+	case errors.Is(err, ErrNotFound) || (err == nil && len(b) == 0):
+		return nil
+	case err != nil:
+		return err
+	}
+	return s.backend.Put(key, nil)
+}
+
+func metadataKey(digest *[DigestSize]byte) string {
+	return hex.EncodeToString(digest[:]) + metadataSuffix
+}
+
+// Digests returns the digests of all stored signatures, sorted.  The
+// backend must implement Lister.
+func (s *Store) Digests() ([][DigestSize]byte, error) {
+	l, ok := s.backend.(Lister)
+	if !ok {
+		return nil, ErrNotListable
+	}
+	keys, err := l.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	var digests [][DigestSize]byte
+	for _, k := range keys {
+		if len(k) != 2*DigestSize || strings.ToLower(k) != k {
+			continue
+		}
+		var d [DigestSize]byte
+		if _, err = hex.Decode(d[:], []byte(k)); err == nil {
+			digests = append(digests, d)
+		}
+	}
+	return digests, nil
+}
@@ -0,0 +1,74 @@
+// sigstore.go - Content addressed signature store
+
+// Package sigstore implements a store that maps content digests to detached
+// SPHINCS-256 signatures, so that artifact mirrors can serve signatures
+// alongside blobs.  Content is addressed by its SHA-256 digest.
+package sigstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/yawning/sphincs256"
+)
+
+// DigestSize is the length of a content digest in bytes.
+const DigestSize = sha256.Size
+
+// Digest returns the digest that content is addressed by.
+func Digest(content []byte) [DigestSize]byte {
+	return sha256.Sum256(content)
+}
+
+// Store is a content addressed signature store.
+type Store struct {
+	backend Backend
+}
+
+// New returns a Store backed by backend.
+func New(backend Backend) *Store {
+	return &Store{backend: backend}
+}
+
+// Put stores the detached signature for the content with the given digest.
+// Only canonically encoded signatures are accepted.  Any metadata of the
+// signature being replaced is invalidated first.
+func (s *Store) Put(digest *[DigestSize]byte, signature *[sphincs256.SignatureSize]byte) error {
+	if _, err := sphincs256.CanonicalizeSignature(signature[:]); err != nil {
+		return err
+	}
+	if err := s.invalidateMetadata(digest); err != nil {
+		return err
+	}
+	return s.backend.Put(hex.EncodeToString(digest[:]), signature[:])
+}
+
+// Get returns the detached signature for the content with the given digest.
+func (s *Store) Get(digest *[DigestSize]byte) (*[sphincs256.SignatureSize]byte, error) {
+	b, err := s.backend.Get(hex.EncodeToString(digest[:]))
+	if err != nil {
+		return nil, err
+	}
+	return sphincs256.CanonicalizeSignature(b)
+}
+
+// Sign signs content with privateKey and stores the signature, with its
+// Metadata.
+func (s *Store) Sign(privateKey *[sphincs256.PrivateKeySize]byte, content []byte) error {
+	digest := Digest(content)
+	pk := (*sphincs256.PrivateKey)(privateKey).Public().(*sphincs256.PublicKey)
+	md := NewMetadata((*[sphincs256.PublicKeySize]byte)(pk), time.Now())
+	return s.PutWithMetadata(&digest, sphincs256.Sign(privateKey, content), md)
+}
+
+// Verify looks up the signature for content, and returns nil iff it is a
+// valid signature of content by publicKey.
+func (s *Store) Verify(publicKey *[sphincs256.PublicKeySize]byte, content []byte) error {
+	digest := Digest(content)
+	sig, err := s.Get(&digest)
+	if err != nil {
+		return err
+	}
+	return sphincs256.VerifyWithOptions(publicKey, content, sig, nil)
+}
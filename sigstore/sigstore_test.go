@@ -0,0 +1,84 @@
+// sigstore_test.go - Signature store tests
+
+package sigstore
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yawning/sphincs256"
+)
+
+func TestStore(t *testing.T) {
+	pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	content := []byte("The Call of Cthulhu")
+
+	for name, b := range map[string]Backend{"Dir": Dir(t.TempDir()), "Memory": NewMemory()} {
+		s := New(b)
+		if err = s.Verify(pk, content); err != ErrNotFound {
+			t.Errorf("%s: Verify() of missing content returned %v", name, err)
+		}
+		if err = s.Sign(sk, content); err != nil {
+			t.Fatalf("%s: failed Sign(): %s", name, err)
+		}
+		if err = s.Verify(pk, content); err != nil {
+			t.Errorf("%s: failed Verify(): %s", name, err)
+		}
+		digest := Digest(content)
+		if _, err = s.Metadata(&digest); err != nil {
+			t.Errorf("%s: failed Metadata(): %s", name, err)
+		}
+
+		// Store a signature for other content under this digest.
+		if err = s.Put(&digest, sphincs256.Sign(sk, []byte("The Shadow over Innsmouth"))); err != nil {
+			t.Fatalf("%s: failed Put(): %s", name, err)
+		}
+		if err = s.Verify(pk, content); err == nil {
+			t.Errorf("%s: Verify() accepted a mismatched signature", name)
+		}
+		if _, err = s.Metadata(&digest); err != ErrNotFound {
+			t.Errorf("%s: Metadata() after Put() returned %v", name, err)
+		}
+	}
+
+	// A failed signature write leaves no metadata behind.
+	s := New(failingBackend{NewMemory()})
+	digest := Digest(content)
+	md := NewMetadata(pk, time.Now())
+	if err = s.PutWithMetadata(&digest, sphincs256.Sign(sk, content), md); err == nil {
+		t.Fatalf("PutWithMetadata() ignored a failed signature write")
+	}
+	if _, err = s.Metadata(&digest); err != ErrNotFound {
+		t.Errorf("Metadata() after a failed signature write returned %v", err)
+	}
+
+	// Dir rejects keys that could escape the directory, instead of using
+	// them.
+	d := Dir(t.TempDir())
+	for _, key := range []string{"", "a", "../../etc", "ab/cd", "ABCD", ".meta"} {
+		if _, err = d.Get(key); err != ErrInvalidKey {
+			t.Errorf("Dir.Get(%q) returned %v", key, err)
+		}
+		if err = d.Put(key, content); err != ErrInvalidKey {
+			t.Errorf("Dir.Put(%q) returned %v", key, err)
+		}
+	}
+}
+
+// failingBackend fails to store signatures, but not metadata.
+type failingBackend struct {
+	*Memory
+}
+
+func (b failingBackend) Put(key string, value []byte) error {
+	if !strings.HasSuffix(key, metadataSuffix) {
+		return errors.New("write failed")
+	}
+	return b.Memory.Put(key, value)
+}
@@ -0,0 +1,350 @@
+// sitesign.go - Signature files for static sites
+
+// Package sitesign emits and verifies SPHINCS-256 signature files for
+// artifacts served from static hosting, laid out so that download pages,
+// client side verifiers and command line tools can find them without
+// configuration.
+//
+// All paths are slash separated and relative to the site root:
+//
+//	<artifact>.sig                the raw signature of the artifact (see SignedMessage)
+//	keys/<fingerprint>.pub        the PEM encoded public key of a signer
+//	sphincs256.json               the Index
+//
+// where fingerprint is the lowercase hex bundle.Fingerprint of the key.
+// The Index maps each signer's fingerprint to its key file and signature
+// files, and lists every artifact with its digest, so that templates can
+// render download links with {{range .Artifacts}}.
+//
+// Each signature is over the artifact's path and SHA-256 digest (see
+// SignedMessage), not its raw content, so that a validly signed artifact
+// can not be moved under another name along with its signature.
+//
+// Key files are published for convenience only.  Anyone who can write to
+// the site can replace them, so Verify only accepts keys the caller trusts.
+package sitesign
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/bundle"
+)
+
+const (
+	// IndexPath is the path of the index.
+	IndexPath = "sphincs256.json"
+
+	// SignatureExt is appended to an artifact's path to form the path of
+	// its signature file.
+	SignatureExt = ".sig"
+
+	// KeyDir is the directory of the public key files.
+	KeyDir = "keys"
+
+	// IndexVersion is the index format version.
+	IndexVersion = 1
+
+	signedLabel = "sphincs256 sitesign\x00"
+)
+
+var (
+	// ErrNotIndexed is the error returned when an artifact is not in the
+	// index.
+	ErrNotIndexed = errors.New("sitesign: artifact is not in the index")
+
+	// ErrUntrustedKey is the error returned when no trusted key has signed
+	// an artifact.
+	ErrUntrustedKey = errors.New("sitesign: artifact is not signed by a trusted key")
+
+	// ErrDigestMismatch is the error returned when an artifact does not
+	// match the digest or size in its index entry.
+	ErrDigestMismatch = errors.New("sitesign: artifact does not match the index")
+)
+
+// Index is the signature index of a site.
+type Index struct {
+	Version int `json:"version"`
+
+	// Keys maps lowercase hex fingerprints to the signers' files.
+	Keys map[string]*Key `json:"keys"`
+
+	// Artifacts are the signed artifacts, sorted by path.
+	Artifacts []*Artifact `json:"artifacts"`
+}
+
+// Key is a signer's entry in the index.
+type Key struct {
+	// PublicKey is the path of the signer's public key file.
+	PublicKey string `json:"public_key"`
+
+	// Signatures are the paths of the signer's signature files, sorted.
+	Signatures []string `json:"signatures"`
+}
+
+// Artifact is an artifact's entry in the index.
+type Artifact struct {
+	Path        string `json:"path"`
+	Signature   string `json:"signature"`
+	Fingerprint string `json:"fingerprint"`
+	SHA256      string `json:"sha256"`
+	Size        int64  `json:"size"`
+}
+
+// SignaturePath returns the path of the signature file of artifact.
+func SignaturePath(artifact string) string {
+	return artifact + SignatureExt
+}
+
+// KeyPath returns the path of the key file of publicKey.
+func KeyPath(publicKey *[sphincs256.PublicKeySize]byte) string {
+	return path.Join(KeyDir, bundle.FingerprintHex(publicKey)+".pub")
+}
+
+// Artifact returns the entry for the artifact at p, or nil.
+func (idx *Index) Artifact(p string) *Artifact {
+	for _, a := range idx.Artifacts {
+		if a.Path == p {
+			return a
+		}
+	}
+	return nil
+}
+
+// ReadIndex reads the index of the site in fsys.
+func ReadIndex(fsys fs.FS) (*Index, error) {
+	b, err := fs.ReadFile(fsys, IndexPath)
+	if err != nil {
+		return nil, err
+	}
+	idx := new(Index)
+	if err = json.Unmarshal(b, idx); err != nil {
+		return nil, fmt.Errorf("sitesign: invalid index: %v", err)
+	}
+	if idx.Version != IndexVersion {
+		return nil, fmt.Errorf("sitesign: unsupported index version %d", idx.Version)
+	}
+	return idx, nil
+}
+
+// Emit signs the artifacts, given as paths relative to the site root dir,
+// with privateKey, and writes their signature files, the signer's key file,
+// and the updated index.  Entries for other signers and artifacts in an
+// existing index are kept, and an artifact signed again replaces its entry.
+func Emit(dir string, privateKey *[sphincs256.PrivateKeySize]byte, artifacts []string) (*Index, error) {
+	idx, err := ReadIndex(os.DirFS(dir))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		idx = &Index{Version: IndexVersion}
+	case err != nil:
+		return nil, err
+	}
+	if idx.Keys == nil {
+		idx.Keys = make(map[string]*Key)
+	}
+
+	pk := (*sphincs256.PrivateKey)(privateKey).Public().(*sphincs256.PublicKey)
+	fp := bundle.FingerprintHex((*[sphincs256.PublicKeySize]byte)(pk))
+	key := idx.Keys[fp]
+	if key == nil {
+		key = &Key{PublicKey: KeyPath((*[sphincs256.PublicKeySize]byte)(pk))}
+		idx.Keys[fp] = key
+	}
+	if err = writeFile(dir, key.PublicKey, pk.MarshalPEM()); err != nil {
+		return nil, err
+	}
+
+	for _, p := range artifacts {
+		a, sig, err := signArtifact(dir, p, privateKey)
+		if err != nil {
+			return nil, err
+		}
+		a.Fingerprint = fp
+		if err = writeFile(dir, a.Signature, sig[:]); err != nil {
+			return nil, err
+		}
+		idx.add(a)
+	}
+
+	b, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = writeFile(dir, IndexPath, append(b, '\n')); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// add adds a to the index, replacing any entry for the same path.
+func (idx *Index) add(a *Artifact) {
+	if old := idx.Artifact(a.Path); old != nil {
+		if k := idx.Keys[old.Fingerprint]; k != nil {
+			k.Signatures = remove(k.Signatures, old.Signature)
+		}
+		*old = *a
+	} else {
+		idx.Artifacts = append(idx.Artifacts, a)
+		sort.Slice(idx.Artifacts, func(i, j int) bool { return idx.Artifacts[i].Path < idx.Artifacts[j].Path })
+	}
+	k := idx.Keys[a.Fingerprint]
+	k.Signatures = append(remove(k.Signatures, a.Signature), a.Signature)
+	sort.Strings(k.Signatures)
+}
+
+func signArtifact(dir, p string, privateKey *[sphincs256.PrivateKeySize]byte) (*Artifact, *[sphincs256.SignatureSize]byte, error) {
+	if !fs.ValidPath(p) || p == IndexPath {
+		return nil, nil, fmt.Errorf("sitesign: invalid artifact path %q", p)
+	}
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(p)))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	// The signature is over the digest, so the indexed digest is the one
+	// that is signed, even if the file changes meanwhile.
+	digest, size, err := digestOf(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	sig := sphincs256.Sign(privateKey, SignedMessage(p, &digest))
+	return &Artifact{
+		Path:      p,
+		Signature: SignaturePath(p),
+		SHA256:    hex.EncodeToString(digest[:]),
+		Size:      size,
+	}, sig, nil
+}
+
+// SignedMessage returns the message signed for the artifact at p with the
+// SHA-256 digest of its content:
+//
+//	"sphincs256 sitesign\x00" || version || length || p || digest
+//
+// where version is IndexVersion as a byte, and length is the length of p
+// as a 32 bit big endian integer.
+func SignedMessage(p string, digest *[sha256.Size]byte) []byte {
+	m := make([]byte, 0, len(signedLabel)+1+4+len(p)+sha256.Size)
+	m = append(m, signedLabel...)
+	m = append(m, IndexVersion)
+	m = binary.BigEndian.AppendUint32(m, uint32(len(p)))
+	m = append(m, p...)
+	return append(m, digest[:]...)
+}
+
+func digestOf(r io.Reader) ([sha256.Size]byte, int64, error) {
+	var digest [sha256.Size]byte
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return digest, 0, err
+	}
+	h.Sum(digest[:0])
+	return digest, n, nil
+}
+
+// Verify verifies the artifact at p in the site in fsys, using the index to
+// locate its signature.  The artifact must match the digest and size in the
+// index, and be signed under p by one of trusted.
+func Verify(fsys fs.FS, p string, trusted []*[sphincs256.PublicKeySize]byte) error {
+	idx, err := ReadIndex(fsys)
+	if err != nil {
+		return err
+	}
+	a := idx.Artifact(p)
+	if a == nil {
+		return ErrNotIndexed
+	}
+
+	var pk *[sphincs256.PublicKeySize]byte
+	for _, k := range trusted {
+		if bundle.FingerprintHex(k) == a.Fingerprint {
+			pk = k
+			break
+		}
+	}
+	if pk == nil {
+		return ErrUntrustedKey
+	}
+
+	if a.Signature != SignaturePath(p) {
+		return fmt.Errorf("sitesign: unexpected signature path %s", a.Signature)
+	}
+	sig, err := fs.ReadFile(fsys, a.Signature)
+	if err != nil {
+		return err
+	}
+	if len(sig) != sphincs256.SignatureSize {
+		return fmt.Errorf("sitesign: invalid signature file %s", a.Signature)
+	}
+	f, err := fsys.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	digest, size, err := digestOf(f)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(digest[:]) != a.SHA256 || size != a.Size {
+		return ErrDigestMismatch
+	}
+	return sphincs256.VerifyWithOptions(pk, SignedMessage(p, &digest), (*[sphincs256.SignatureSize]byte)(sig), nil)
+}
+
+func writeFile(dir, p string, b []byte) error {
+	name := filepath.Join(dir, filepath.FromSlash(p))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if old, err := os.ReadFile(name); err == nil && bytes.Equal(old, b) {
+		return nil
+	}
+
+	// The file is replaced atomically, so that a crash never leaves it
+	// truncated.
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+func remove(s []string, v string) []string {
+	out := s[:0]
+	for _, x := range s {
+		if x != v {
+			out = append(out, x)
+		}
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+// sitesign_test.go - Static site signature file tests
+
+package sitesign
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/bundle"
+)
+
+func TestSite(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "dist"), 0755)
+	os.WriteFile(filepath.Join(dir, "dist", "app.tar.gz"), []byte("release tarball"), 0644)
+	os.WriteFile(filepath.Join(dir, "README"), []byte("readme"), 0644)
+
+	pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	otherPk, otherSk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+
+	if _, err = Emit(dir, sk, []string{"dist/app.tar.gz"}); err != nil {
+		t.Fatalf("Emit() failed: %v", err)
+	}
+	idx, err := Emit(dir, otherSk, []string{"README"})
+	if err != nil {
+		t.Fatalf("Emit() failed: %v", err)
+	}
+	if len(idx.Keys) != 2 || len(idx.Artifacts) != 2 {
+		t.Fatalf("Emit() did not merge the index: %+v", idx)
+	}
+	if k := idx.Keys[bundle.FingerprintHex(pk)]; k == nil || k.Signatures[0] != "dist/app.tar.gz.sig" || k.PublicKey != KeyPath(pk) {
+		t.Errorf("index entry for the first signer: %+v", k)
+	}
+	if _, err = os.Stat(filepath.Join(dir, filepath.FromSlash(KeyPath(otherPk)))); err != nil {
+		t.Errorf("key file not written: %v", err)
+	}
+	if a, d := idx.Artifact("README"), sha256.Sum256([]byte("readme")); a.SHA256 != hex.EncodeToString(d[:]) || a.Size != 6 {
+		t.Errorf("index entry for README: %+v", a)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, IndexPath)); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("index not written world readable: %v", err)
+	}
+
+	fsys := os.DirFS(dir)
+	trusted := []*[sphincs256.PublicKeySize]byte{pk}
+	if err = Verify(fsys, "dist/app.tar.gz", trusted); err != nil {
+		t.Errorf("Verify() failed: %v", err)
+	}
+	if err = Verify(fsys, "README", trusted); !errors.Is(err, ErrUntrustedKey) {
+		t.Errorf("Verify() of an artifact by an untrusted key: got %v", err)
+	}
+	if err = Verify(fsys, "missing", trusted); !errors.Is(err, ErrNotIndexed) {
+		t.Errorf("Verify() of an unindexed artifact: got %v", err)
+	}
+
+	// The index renders directly in templates.
+	tmpl := template.Must(template.New("").Parse(`{{range .Artifacts}}{{.Path}} {{.Signature}}
+{{end}}`))
+	var sb strings.Builder
+	if err = tmpl.Execute(&sb, idx); err != nil {
+		t.Fatalf("template failed: %v", err)
+	}
+	if sb.String() != "README README.sig\ndist/app.tar.gz dist/app.tar.gz.sig\n" {
+		t.Errorf("template rendered %q", sb.String())
+	}
+
+	// An older signed artifact moved in under another name, along with its
+	// signature and index entry, is rejected.
+	os.WriteFile(filepath.Join(dir, "dist", "old.tar.gz"), []byte("old tarball"), 0644)
+	if idx, err = Emit(dir, sk, []string{"dist/old.tar.gz"}); err != nil {
+		t.Fatalf("Emit() failed: %v", err)
+	}
+	old, cur := idx.Artifact("dist/old.tar.gz"), idx.Artifact("dist/app.tar.gz")
+	for _, p := range []string{"", SignatureExt} {
+		b, _ := os.ReadFile(filepath.Join(dir, "dist", "old.tar.gz"+p))
+		os.WriteFile(filepath.Join(dir, "dist", "app.tar.gz"+p), b, 0644)
+	}
+	cur.SHA256, cur.Size = old.SHA256, old.Size
+	b, _ := json.Marshal(idx)
+	os.WriteFile(filepath.Join(dir, IndexPath), b, 0644)
+	if err = Verify(fsys, "dist/app.tar.gz", trusted); !errors.Is(err, sphincs256.ErrVerifyFailed) {
+		t.Errorf("Verify() of a swapped artifact: got %v", err)
+	}
+	if err = Verify(fsys, "dist/old.tar.gz", trusted); err != nil {
+		t.Errorf("Verify() failed: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "dist", "old.tar.gz"), []byte("tampered tarball"), 0644)
+	if err = Verify(fsys, "dist/old.tar.gz", trusted); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Verify() of a tampered artifact: got %v", err)
+	}
+}
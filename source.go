@@ -0,0 +1,141 @@
+// source.go - Randomness sources
+
+package sphincs256
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	gohash "hash"
+	"io"
+	"sync/atomic"
+
+	"github.com/yawning/sphincs256/utils"
+)
+
+// FailurePolicy determines what a Source does when its reader fails.
+type FailurePolicy int
+
+const (
+	// FailClosed returns the reader's error.  This is the default.
+	FailClosed FailurePolicy = iota
+
+	// FallBack reads from crypto/rand instead, if the reader fails.
+	FallBack
+
+	// Mix always reads from both the reader and crypto/rand, and returns
+	// the XOR of the two, which is uniformly random if either is and they
+	// are independent.  A failure of either is returned.
+	Mix
+)
+
+// Source is a source of randomness with an explicit failure policy.  The
+// key generation functions and SignHedged read from the default Source
+// (see SetDefaultSource) when given a nil io.Reader, and the subpackages
+// read from it for their own randomness, so that all entropy used by an
+// application can be routed through one audited path.
+type Source struct {
+	// Reader is the primary entropy source, crypto/rand.Reader if nil.
+	Reader io.Reader
+
+	// Policy is the failure policy.
+	Policy FailurePolicy
+
+	// OnFailure, if non-nil, is called with every error from Reader, even
+	// if the policy recovers from it, so that failures can be alerted on.
+	OnFailure func(error)
+}
+
+var defaultSource atomic.Pointer[Source]
+
+func init() {
+	defaultSource.Store(new(Source))
+}
+
+// SetDefaultSource sets the default Source.  A nil s restores the default,
+// crypto/rand failing closed.
+func SetDefaultSource(s *Source) {
+	if s == nil {
+		s = new(Source)
+	}
+	defaultSource.Store(s)
+}
+
+// DefaultSource returns the default Source.
+func DefaultSource() *Source {
+	return defaultSource.Load()
+}
+
+// randReader returns r, or the default Source if r is nil.
+func randReader(r io.Reader) io.Reader {
+	if r == nil {
+		return DefaultSource()
+	}
+	return r
+}
+
+// Read fills p with random bytes, according to the failure policy.  It
+// always fills p completely, or returns an error.
+func (s *Source) Read(p []byte) (int, error) {
+	if s.Reader == nil {
+		if s.Policy == Mix {
+			return 0, errors.New("sphincs256: Mix requires a reader other than crypto/rand")
+		}
+		return io.ReadFull(rand.Reader, p)
+	}
+
+	_, err := io.ReadFull(s.Reader, p)
+	if err != nil && s.OnFailure != nil {
+		s.OnFailure(err)
+	}
+
+	switch s.Policy {
+	case FailClosed:
+	case FallBack:
+		if err != nil {
+			_, err = io.ReadFull(rand.Reader, p)
+		}
+	case Mix:
+		if err == nil {
+			q := make([]byte, len(p))
+			defer utils.Zerobytes(q)
+			if _, err = io.ReadFull(rand.Reader, q); err == nil {
+				for i := range p {
+					p[i] ^= q[i]
+				}
+			}
+		}
+	default:
+		return 0, fmt.Errorf("sphincs256: invalid randomness failure policy %d", s.Policy)
+	}
+	if err != nil {
+		utils.Zerobytes(p)
+		return 0, fmt.Errorf("sphincs256: randomness source failed: %w", err)
+	}
+	return len(p), nil
+}
+
+// SignHedged signs message with privateKey, like Sign, but mixes fresh
+// randomness from rand (the default Source if nil) into the derivation of
+// R and the leaf index, alongside the message and the key's randomization
+// seed.  This hedges against fault attacks on deterministic signing, and
+// remains secure if rand fails to be random.
+//
+// Hedged signatures verify like any other, but differ each time and so can
+// not be checked with AuditSignature.
+func SignHedged(rand io.Reader, privateKey *[PrivateKeySize]byte, message []byte) (*[SignatureSize]byte, error) {
+	var noise [SeedSize]byte
+	defer utils.Zerobytes(noise[:])
+	if _, err := io.ReadFull(randReader(rand), noise[:]); err != nil {
+		return nil, err
+	}
+
+	h := newRandomnessHash(privateKey[:])
+	h.Write(noise[:])
+	h.Write(message)
+	leafidx, r := randomnessFromHash(h)
+	return signMessage(privateKey, nil, leafidx, &r, nil, false, func(h gohash.Hash) error {
+		h.Write(message)
+		return nil
+	})
+}
@@ -0,0 +1,88 @@
+// source_test.go - Randomness source tests
+
+package sphincs256
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("entropy device unplugged")
+}
+
+func TestSource(t *testing.T) {
+	fixed := bytes.Repeat([]byte{0xa5}, 64)
+	var failures int
+	onFailure := func(error) { failures++ }
+
+	buf := make([]byte, 64)
+	s := &Source{Reader: failingReader{}, OnFailure: onFailure}
+	if _, err := s.Read(buf); err == nil {
+		t.Errorf("FailClosed source read from a failed reader")
+	}
+	s.Policy = FallBack
+	if _, err := s.Read(buf); err != nil {
+		t.Errorf("FallBack source failed: %v", err)
+	}
+	s.Policy = Mix
+	if _, err := s.Read(buf); err == nil {
+		t.Errorf("Mix source read from a failed reader")
+	}
+	if failures != 3 {
+		t.Errorf("OnFailure called %d times, expected 3", failures)
+	}
+
+	s = &Source{Reader: bytes.NewReader(fixed), Policy: Mix}
+	if _, err := s.Read(buf); err != nil || bytes.Equal(buf, fixed) {
+		t.Errorf("Mix source did not mix: %v", err)
+	}
+
+	// The default Source is used for nil readers.
+	SetDefaultSource(&Source{Reader: failingReader{}})
+	_, _, err := GenerateKey(nil)
+	SetDefaultSource(nil)
+	if err == nil {
+		t.Errorf("GenerateKey(nil) did not use the default Source")
+	}
+	entropy := make([]byte, PrivateKeySize)
+	rand.Read(entropy)
+	SetDefaultSource(&Source{Reader: bytes.NewReader(entropy)})
+	pk, _, err := GenerateKey(nil)
+	SetDefaultSource(nil)
+	expected, _, _ := GenerateKey(bytes.NewReader(entropy))
+	if err != nil || *pk != *expected {
+		t.Errorf("GenerateKey(nil) with a fixed default Source: %v", err)
+	}
+}
+
+func TestSignHedged(t *testing.T) {
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed GenerateKey(): %s", err)
+	}
+	msg := []byte("The color out of space.")
+
+	sig1, err := SignHedged(nil, sk, msg)
+	if err != nil {
+		t.Fatalf("SignHedged() failed: %v", err)
+	}
+	sig2, err := SignHedged(rand.Reader, sk, msg)
+	if err != nil {
+		t.Fatalf("SignHedged() failed: %v", err)
+	}
+	if !Verify(pk, msg, sig1) || !Verify(pk, msg, sig2) {
+		t.Fatalf("hedged signature failed to verify")
+	}
+	if *sig1 == *sig2 || *sig1 == *Sign(sk, msg) {
+		t.Errorf("hedged signatures are deterministic")
+	}
+	if _, err = SignHedged(io.LimitReader(rand.Reader, 1), sk, msg); err == nil {
+		t.Errorf("SignHedged() succeeded with a failed reader")
+	}
+}
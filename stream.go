@@ -0,0 +1,131 @@
+// stream.go - Streaming message signing and verification
+
+package sphincs256
+
+import (
+	"crypto/subtle"
+	"errors"
+	gohash "hash"
+	"io"
+
+	"github.com/yawning/sphincs256/hash"
+	"github.com/yawning/sphincs256/horst"
+)
+
+// ErrMessageChanged is the error returned by SignReader when the message
+// read on the second pass differs from that read on the first.
+var ErrMessageChanged = errors.New("sphincs256: message changed while being signed")
+
+// SignReader signs the message read from r with privateKey and returns the
+// signature.  The signature is identical to that of Sign.
+//
+// The message is read twice: once to derive the signature randomness, and
+// once more after seeking back to the starting offset to compute the
+// message digest, so that arbitrarily large messages can be signed without
+// buffering them.  The message must not change between the two passes, and
+// if it does, ErrMessageChanged is returned rather than a signature.
+func SignReader(privateKey *[PrivateKeySize]byte, r io.ReadSeeker) (*[SignatureSize]byte, error) {
+	return signReader(privateKey, r, nil, nil)
+}
+
+// signReader is SignReader, using arena as the HORST scratch space if it is
+// non-nil, and rejecting messages that exceed limits.
+func signReader(privateKey *[PrivateKeySize]byte, r io.ReadSeeker, arena *horst.Arena, limits *Limits) (*[SignatureSize]byte, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	h := newRandomnessHash(privateKey[:])
+	n, err := io.Copy(h, limitReader(r, limits, "message"))
+	if err != nil {
+		return nil, err
+	}
+	first := h.Sum(nil)
+	leafidx, rnd := randomnessFromHash(h)
+
+	if _, err = r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	// The randomness is recomputed over the second pass, so that a message
+	// that changed is never signed with the randomness (and leaf) derived
+	// from another.
+	return signMessage(privateKey, nil, leafidx, &rnd, arena, false, func(mh gohash.Hash) error {
+		h = newRandomnessHash(privateKey[:])
+		n2, err := io.Copy(io.MultiWriter(mh, h), limitReader(r, limits, "message"))
+		if err != nil {
+			return err
+		}
+		if n2 != n || subtle.ConstantTimeCompare(h.Sum(nil), first) != 1 {
+			return ErrMessageChanged
+		}
+		return nil
+	})
+}
+
+// VerifyReader takes a public key, the message read from r and a signature,
+// and returns nil if the signature is valid.  The message is read in a
+// single pass.
+func VerifyReader(publicKey *[PublicKeySize]byte, r io.Reader, signature *[SignatureSize]byte) error {
+	v := NewVerifier(publicKey, signature)
+	if _, err := io.Copy(v, r); err != nil {
+		return err
+	}
+	return v.Verify()
+}
+
+// Verifier verifies a signature over a message that is written to it in
+// pieces.
+//
+// There is no equivalent for signing, as signing needs two passes over the
+// message.  Use SignReader instead.
+type Verifier struct {
+	key  [PublicKeySize]byte
+	sig  [SignatureSize]byte
+	h    gohash.Hash
+	opts *VerifyOptions
+	n    int64
+	err  error
+}
+
+// NewVerifier returns a Verifier for signature by publicKey.
+func NewVerifier(publicKey *[PublicKeySize]byte, signature *[SignatureSize]byte) *Verifier {
+	return NewVerifierWithOptions(publicKey, signature, nil)
+}
+
+// NewVerifierWithOptions returns a Verifier for signature by publicKey,
+// using the provided options.  A nil opts is equivalent to the zero value.
+// The key and signature are copied, and the misuse checks that
+// VerifyWithOptions applies are applied here.
+func NewVerifierWithOptions(publicKey *[PublicKeySize]byte, signature *[SignatureSize]byte, opts *VerifyOptions) *Verifier {
+	v := &Verifier{sig: *signature, opts: opts}
+	copy(v.key[:], publicKey[:])
+	v.h = newMessageHash(v.sig[:], v.key[:])
+	if v.err = opts.limits().check(0, VerifyMemory); v.err == nil {
+		v.err = checkVerify(&v.key)
+	}
+	return v
+}
+
+// Write adds more data to the message.  It only returns an error, a
+// LimitError, once the message exceeds opts.Limits.MaxMessageSize.
+func (v *Verifier) Write(p []byte) (int, error) {
+	if v.err == nil {
+		v.n += int64(len(p))
+		v.err = v.opts.limits().check(v.n, 0)
+	}
+	if v.err != nil {
+		return 0, v.err
+	}
+	return v.h.Write(p)
+}
+
+// Verify returns nil if the signature is valid for the message written so
+// far.
+func (v *Verifier) Verify() error {
+	if v.err != nil {
+		return v.err
+	}
+	return verify(v.key[:nMasks*hash.Size], v.key[nMasks*hash.Size:], v.h.Sum(nil), &v.sig, v.opts)
+}
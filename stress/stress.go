@@ -0,0 +1,376 @@
+// stress.go - Mixed workload stress and soak runner
+
+// Package stress runs long, mixed SPHINCS-256 workloads, to qualify the
+// package for production on a given machine and toolchain.  The
+// cmd/sphincs256-stress command runs it from the command line.
+//
+// Concurrent workers interleave key generation, signing through a shared
+// Signer and a signqueue.Queue, and verification against a cache of
+// prepared public keys that is continually churned.  Queue waits are
+// cancelled at random, and every result is checked, including that
+// corrupted signatures are rejected.
+//
+// While the workload runs, the heap and goroutine count are sampled, and
+// the run fails if either has grown by the end.  Data races are only
+// detected when built with the race detector (go test -race, or go build
+// -race for the command), which is recommended for qualification runs.
+package stress
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/signqueue"
+)
+
+// Config is the stress run configuration.  Zero fields take their defaults.
+type Config struct {
+	// Workers is the number of concurrent workers, 2 * GOMAXPROCS by
+	// default.
+	Workers int
+
+	// Duration is how long to run for, 1 minute by default.
+	Duration time.Duration
+
+	// CacheSize is the number of keys in the prepared public key cache, 8
+	// by default.
+	CacheSize int
+
+	// MessageSize is the length of the signed messages in bytes, 1024 by
+	// default.
+	MessageSize int
+
+	// SampleInterval is how often memory use is sampled, 100 ms by
+	// default.
+	SampleInterval time.Duration
+
+	// MaxHeapGrowth is how much the live heap may grow over the run in
+	// bytes, 64 MiB by default.
+	MaxHeapGrowth uint64
+
+	// Rand is the source of keys, sphincs256.DefaultSource() by default.
+	Rand io.Reader
+}
+
+// Report is the result of a stress run.
+type Report struct {
+	Workers int
+	Elapsed time.Duration
+
+	// KeyGenerations, Signatures, Verifications and Cancellations count
+	// the operations performed.
+	KeyGenerations uint64
+	Signatures     uint64
+	Verifications  uint64
+	Cancellations  uint64
+
+	// Failures counts operations with a wrong result.
+	Failures uint64
+
+	// BaseHeap, PeakHeap and FinalHeap are the live heap in bytes before,
+	// at most during, and after the run.
+	BaseHeap, PeakHeap, FinalHeap uint64
+
+	// BaseGoroutines and FinalGoroutines are the number of goroutines
+	// before and after the run.
+	BaseGoroutines, FinalGoroutines int
+
+	// Problems describes every failed check.
+	Problems []string
+}
+
+// OK returns true iff the run found no problems.
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *Report) String() string {
+	s := fmt.Sprintf("%d workers for %v: %d key generations, %d signatures, %d verifications, %d cancellations, %d failures; heap %d -> %d (peak %d) bytes, goroutines %d -> %d",
+		r.Workers, r.Elapsed.Round(time.Millisecond), r.KeyGenerations, r.Signatures, r.Verifications, r.Cancellations, r.Failures,
+		r.BaseHeap, r.FinalHeap, r.PeakHeap, r.BaseGoroutines, r.FinalGoroutines)
+	for _, p := range r.Problems {
+		s += "\n" + p
+	}
+	return s
+}
+
+// entry is a cached key, with a message signed by it.
+type entry struct {
+	key *sphincs256.PreparedPublicKey
+	msg []byte
+	sig *[sphincs256.SignatureSize]byte
+}
+
+type runner struct {
+	c Config
+
+	signer    *sphincs256.Signer
+	signerKey *sphincs256.PreparedPublicKey
+	queue     *signqueue.Queue
+	queueKey  *sphincs256.PreparedPublicKey
+
+	sync.Mutex
+	cache []*entry
+
+	keygens, signatures, verifications, cancellations, failures atomic.Uint64
+}
+
+// Run runs a stress test.  It stops early, with a partial report, if ctx is
+// done.
+func Run(ctx context.Context, cfg *Config) (*Report, error) {
+	c := Config{}
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.Workers <= 0 {
+		c.Workers = 2 * runtime.GOMAXPROCS(0)
+	}
+	if c.Duration <= 0 {
+		c.Duration = time.Minute
+	}
+	if c.CacheSize <= 0 {
+		c.CacheSize = 8
+	}
+	if c.MessageSize <= 0 {
+		c.MessageSize = 1024
+	}
+	if c.SampleInterval <= 0 {
+		c.SampleInterval = 100 * time.Millisecond
+	}
+	if c.MaxHeapGrowth == 0 {
+		c.MaxHeapGrowth = 64 << 20
+	}
+	if c.Rand == nil {
+		c.Rand = sphincs256.DefaultSource()
+	}
+
+	r := &Report{Workers: c.Workers}
+	r.BaseHeap, r.BaseGoroutines = liveHeap(), runtime.NumGoroutine()
+	r.PeakHeap = r.BaseHeap
+
+	s, err := newRunner(&c)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < c.Workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; ctx.Err() == nil; i++ {
+				s.step(ctx, w, i)
+			}
+		}(w)
+	}
+
+	// Sample the heap until the workers are done.
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	var ms runtime.MemStats
+	ticker := time.NewTicker(c.SampleInterval)
+	for sampling := true; sampling; {
+		select {
+		case <-ticker.C:
+			runtime.ReadMemStats(&ms)
+			if ms.HeapAlloc > r.PeakHeap {
+				r.PeakHeap = ms.HeapAlloc
+			}
+		case <-done:
+			sampling = false
+		}
+	}
+	ticker.Stop()
+	s.queue.Close()
+	r.Elapsed = time.Since(start)
+
+	r.KeyGenerations, r.Signatures = s.keygens.Load(), s.signatures.Load()
+	r.Verifications, r.Cancellations = s.verifications.Load(), s.cancellations.Load()
+	r.Failures = s.failures.Load()
+
+	// Drop the workload's state before measuring what is left.
+	s = nil
+	r.FinalHeap = liveHeap()
+	r.FinalGoroutines = settledGoroutines(r.BaseGoroutines)
+
+	if r.Failures != 0 {
+		r.Problems = append(r.Problems, fmt.Sprintf("%d operations returned wrong results", r.Failures))
+	}
+	if r.FinalHeap > r.BaseHeap+c.MaxHeapGrowth {
+		r.Problems = append(r.Problems, fmt.Sprintf("live heap grew by %d bytes, more than the limit of %d", r.FinalHeap-r.BaseHeap, c.MaxHeapGrowth))
+	}
+	if r.FinalGoroutines > r.BaseGoroutines {
+		r.Problems = append(r.Problems, fmt.Sprintf("%d goroutines leaked", r.FinalGoroutines-r.BaseGoroutines))
+	}
+	return r, nil
+}
+
+func newRunner(c *Config) (*runner, error) {
+	s := &runner{c: *c, cache: make([]*entry, c.CacheSize)}
+
+	pk, sk, err := sphincs256.GenerateKey(c.Rand)
+	if err != nil {
+		return nil, err
+	}
+	s.signer = sphincs256.NewSigner(sk, &sphincs256.SignerOptions{ScratchArenas: 2})
+	if s.signerKey, err = sphincs256.NewPreparedPublicKey(pk); err != nil {
+		return nil, err
+	}
+
+	if pk, sk, err = sphincs256.GenerateKey(c.Rand); err != nil {
+		return nil, err
+	}
+	if s.queue, err = signqueue.New(sphincs256.NewSigner(sk, nil), &signqueue.Options{Workers: 2}); err != nil {
+		return nil, err
+	}
+	if s.queueKey, err = sphincs256.NewPreparedPublicKey(pk); err != nil {
+		s.queue.Close()
+		return nil, err
+	}
+
+	for i := range s.cache {
+		if s.cache[i], err = s.newEntry(0, i); err != nil {
+			s.queue.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// step runs the i-th operation of worker w.
+func (s *runner) step(ctx context.Context, w, i int) {
+	switch i % 8 {
+	case 4:
+		s.churn(w, i)
+	case 5, 6:
+		msg := s.message(w, i)
+		sig, err := s.signer.SignMessage(msg)
+		s.check(err == nil && s.signerKey.Verify(msg, sig))
+		s.signatures.Add(1)
+	case 7:
+		s.queued(ctx, w, i)
+	default:
+		s.Lock()
+		e := s.cache[i%len(s.cache)]
+		s.Unlock()
+		s.verify(e)
+	}
+}
+
+// churn replaces a cache entry with one under a new key.
+func (s *runner) churn(w, i int) {
+	e, err := s.newEntry(w, i)
+	if err != nil {
+		s.failures.Add(1)
+		return
+	}
+	s.Lock()
+	s.cache[(i/8+w)%len(s.cache)] = e
+	s.Unlock()
+}
+
+func (s *runner) newEntry(w, i int) (*entry, error) {
+	pk, sk, err := sphincs256.GenerateKey(s.c.Rand)
+	if err != nil {
+		return nil, err
+	}
+	s.keygens.Add(1)
+	key, err := sphincs256.NewPreparedPublicKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	msg := s.message(w, i)
+	sig := sphincs256.Sign(sk, msg)
+	s.signatures.Add(1)
+	return &entry{key: key, msg: msg, sig: sig}, nil
+}
+
+// queued signs through the queue, first giving up on the job after a very
+// short wait.
+func (s *runner) queued(ctx context.Context, w, i int) {
+	msg := s.message(w, i)
+	id, err := s.queue.Submit(msg)
+	if err != nil {
+		s.failures.Add(1)
+		return
+	}
+
+	short, cancel := context.WithTimeout(ctx, time.Millisecond)
+	sig, err := s.queue.Wait(short, id)
+	cancel()
+	if err != nil {
+		s.cancellations.Add(1)
+		if sig, err = s.queue.Wait(context.Background(), id); err != nil {
+			s.failures.Add(1)
+			return
+		}
+	}
+	s.check(s.queueKey.Verify(msg, sig))
+	s.signatures.Add(1)
+	if err = s.queue.Remove(id); err != nil {
+		s.failures.Add(1)
+	}
+}
+
+// verify checks that e's signature verifies, and that a corrupted copy
+// does not.
+func (s *runner) verify(e *entry) {
+	s.check(e.key.Verify(e.msg, e.sig))
+
+	// The corrupted byte is past R and the leaf index, as verification
+	// ignores the unused high bits of the latter.
+	const skip = 32 + 8
+	bad := *e.sig
+	bad[skip+int(binary.LittleEndian.Uint32(e.msg))%(len(bad)-skip)] ^= 0x40
+	s.check(!e.key.Verify(e.msg, &bad))
+	s.verifications.Add(2)
+}
+
+func (s *runner) check(ok bool) {
+	if !ok {
+		s.failures.Add(1)
+	}
+}
+
+// message returns a message unique to worker w's i-th operation.
+func (s *runner) message(w, i int) []byte {
+	msg := make([]byte, s.c.MessageSize+8)
+	binary.LittleEndian.PutUint32(msg, uint32(i))
+	binary.LittleEndian.PutUint32(msg[4:], uint32(w))
+	for j := 8; j < len(msg); j++ {
+		msg[j] = byte(j * (i + 1))
+	}
+	return msg
+}
+
+func liveHeap() uint64 {
+	var ms runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
+
+// settledGoroutines returns the number of goroutines, giving those that
+// are exiting a moment to do so.
+func settledGoroutines(target int) int {
+	n := runtime.NumGoroutine()
+	for i := 0; i < 100 && n > target; i++ {
+		time.Sleep(10 * time.Millisecond)
+		n = runtime.NumGoroutine()
+	}
+	return n
+}
@@ -0,0 +1,31 @@
+// stress_test.go - Mixed workload stress and soak runner tests
+
+package stress
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping stress run in short mode")
+	}
+
+	r, err := Run(context.Background(), &Config{
+		Workers:     4,
+		Duration:    time.Second,
+		CacheSize:   2,
+		MessageSize: 64,
+	})
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if !r.OK() {
+		t.Fatalf("Run() found problems: %s", r)
+	}
+	if r.Signatures == 0 || r.Verifications == 0 || r.KeyGenerations == 0 {
+		t.Errorf("Run() did not exercise every operation: %s", r)
+	}
+}
@@ -0,0 +1,221 @@
+// trailer.go - Constant space verification of trailer signed streams
+
+package sphincs256
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	gohash "hash"
+	"io"
+)
+
+// DefaultWindow is the default read window of OpenReader in bytes.
+const DefaultWindow = 32 << 10
+
+// OpenReaderOptions are the options for OpenReader.
+type OpenReaderOptions struct {
+	// ChunkSize is the chunk size the message was signed with, or 0 for
+	// DefaultChunkSize.
+	ChunkSize int
+
+	// Window is the number of bytes read from the underlying reader at a
+	// time, or 0 for DefaultWindow.
+	Window int
+
+	// Limits, if non-nil, are the resource limits.  The stream is rejected
+	// once it exceeds Limits.MaxEnvelopeSize, and a window that would
+	// exceed Limits.MaxMemory is refused.
+	Limits *Limits
+}
+
+// OpenReader returns a reader of the message of a signed stream read from
+// r.  The stream is the message followed by its SignChunked signature, as a
+// trailer.
+//
+// The message is verified as it is read, holding back only the last
+// SignatureSize bytes (which may turn out to be the signature) and a window
+// of at most opts.Window bytes.  The returned reader reports io.EOF only if
+// the signature is valid, and otherwise the verification error, so callers
+// that forward the message before the end of the stream must be prepared to
+// abort when that happens.
+//
+// Standard (Sign) signatures can not be verified this way, as the message
+// digest starts with R, which is only known once the trailer arrives.
+func OpenReader(publicKey *[PublicKeySize]byte, r io.Reader, opts *OpenReaderOptions) (io.Reader, error) {
+	chunkSize, window := DefaultChunkSize, DefaultWindow
+	var limits *Limits
+	if opts != nil {
+		limits = opts.Limits
+		if opts.ChunkSize != 0 {
+			chunkSize = opts.ChunkSize
+		}
+		if opts.Window != 0 {
+			window = opts.Window
+		}
+	}
+	if err := checkChunkSize(chunkSize); err != nil {
+		return nil, err
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("sphincs256: invalid window: %d", window)
+	}
+
+	if err := limits.check(0, int64(SignatureSize+window)); err != nil {
+		return nil, err
+	}
+
+	o := &openReader{
+		r:   limitReader(r, limits, "envelope"),
+		h:   newChunkedHasher(chunkSize),
+		buf: make([]byte, SignatureSize+window),
+	}
+	copy(o.key[:], publicKey[:])
+	return o, nil
+}
+
+type openReader struct {
+	key [PublicKeySize]byte
+	r   io.Reader
+	h   *chunkedHasher
+
+	buf        []byte
+	start, end int
+	eof        bool
+	err        error
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	for {
+		if o.err != nil {
+			return 0, o.err
+		}
+
+		// Release everything but the possible trailer.
+		if n := o.end - o.start - SignatureSize; n > 0 {
+			n = copy(p, o.buf[o.start:o.start+n])
+			o.h.Write(p[:n])
+			o.start += n
+			return n, nil
+		}
+		if o.eof {
+			o.err = o.finish()
+			continue
+		}
+
+		o.end = copy(o.buf, o.buf[o.start:o.end])
+		o.start = 0
+		n, err := o.r.Read(o.buf[o.end:])
+		o.end += n
+		switch err {
+		case nil:
+		case io.EOF:
+			o.eof = true
+		default:
+			o.err = err
+		}
+	}
+}
+
+// finish verifies the trailer, and returns io.EOF if it is valid.
+func (o *openReader) finish() error {
+	if o.end-o.start != SignatureSize {
+		return errors.New("sphincs256: signed stream is too short to be valid")
+	}
+	sig := (*[SignatureSize]byte)(o.buf[o.start:o.end])
+	if err := VerifyChunkedDigest(&o.key, o.h.Sum(), sig, nil); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// chunkedHasher computes ChunkedDigest incrementally, keeping only the
+// current chunk's hash state and one node per tree level.
+type chunkedHasher struct {
+	chunkSize int
+	length    uint64
+
+	leaf   gohash.Hash
+	inLeaf int
+	index  uint64
+
+	stack []chunkedNode
+}
+
+type chunkedNode struct {
+	hash   [sha256.Size]byte
+	height int
+}
+
+func newChunkedHasher(chunkSize int) *chunkedHasher {
+	c := &chunkedHasher{chunkSize: chunkSize, leaf: sha256.New()}
+	c.startLeaf()
+	return c
+}
+
+func (c *chunkedHasher) startLeaf() {
+	var idx [8]byte
+	binary.BigEndian.PutUint64(idx[:], c.index)
+	c.leaf.Reset()
+	c.leaf.Write([]byte{0x00})
+	c.leaf.Write(idx[:])
+	c.inLeaf = 0
+}
+
+func (c *chunkedHasher) Write(p []byte) {
+	c.length += uint64(len(p))
+	for len(p) > 0 {
+		n := c.chunkSize - c.inLeaf
+		if n > len(p) {
+			n = len(p)
+		}
+		c.leaf.Write(p[:n])
+		c.inLeaf += n
+		p = p[n:]
+		if c.inLeaf == c.chunkSize {
+			c.finishLeaf()
+		}
+	}
+}
+
+// finishLeaf pushes the current leaf, merging equal height nodes, which
+// yields the same tree as hashing level by level.
+func (c *chunkedHasher) finishLeaf() {
+	node := chunkedNode{}
+	c.leaf.Sum(node.hash[:0])
+	for len(c.stack) > 0 && c.stack[len(c.stack)-1].height == node.height {
+		node.hash = chunkedParent(&c.stack[len(c.stack)-1].hash, &node.hash)
+		node.height++
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+	c.stack = append(c.stack, node)
+	c.index++
+	c.startLeaf()
+}
+
+// Sum returns the digest of the data written so far.  It must be called at
+// most once.
+func (c *chunkedHasher) Sum() *[ChunkedDigestSize]byte {
+	// An empty message is a single empty chunk.
+	if c.inLeaf > 0 || c.index == 0 {
+		c.finishLeaf()
+	}
+
+	// Nodes without a sibling were promoted, so the remaining nodes combine
+	// right to left.
+	root := c.stack[len(c.stack)-1].hash
+	for i := len(c.stack) - 2; i >= 0; i-- {
+		root = chunkedParent(&c.stack[i].hash, &root)
+	}
+	return encodeChunkedDigest(c.chunkSize, c.length, [][sha256.Size]byte{root})
+}
+
+func chunkedParent(left, right *[sha256.Size]byte) (node [sha256.Size]byte) {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left[:])
+	h.Write(right[:])
+	h.Sum(node[:0])
+	return
+}
@@ -0,0 +1,63 @@
+// trailer_test.go - Trailer signed stream verification tests
+
+package sphincs256
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestChunkedHasher(t *testing.T) {
+	msg := make([]byte, 1000)
+	rand.Read(msg)
+	for _, n := range []int{0, 1, 63, 64, 65, 64 * 7, 64*11 + 5, 1000} {
+		h := newChunkedHasher(64)
+		h.Write(msg[:n/2])
+		h.Write(msg[n/2 : n])
+		want, _ := chunkedDigestOf(msg[:n], 64)
+		if *h.Sum() != *want {
+			t.Errorf("incremental chunked digest mismatch for %d bytes", n)
+		}
+	}
+}
+
+func TestOpenReader(t *testing.T) {
+	pk, sk, err := GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	msg := make([]byte, 100000)
+	rand.Read(msg)
+	sig, err := SignChunked(sk, msg, 4096)
+	if err != nil {
+		t.Fatalf("SignChunked() failed: %v", err)
+	}
+	stream := append(append([]byte{}, msg...), sig[:]...)
+	opts := &OpenReaderOptions{ChunkSize: 4096, Window: 1000}
+
+	r, err := OpenReader(pk, iotest.HalfReader(bytes.NewReader(stream)), opts)
+	if err != nil {
+		t.Fatalf("OpenReader() failed: %v", err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("OpenReader() rejected a valid stream: %v", err)
+	}
+	if !bytes.Equal(out, msg) {
+		t.Fatalf("OpenReader() returned the wrong message")
+	}
+
+	stream[len(msg)/2] ^= 1
+	r, _ = OpenReader(pk, bytes.NewReader(stream), opts)
+	if _, err = io.ReadAll(r); err == nil {
+		t.Errorf("OpenReader() accepted a modified stream")
+	}
+
+	r, _ = OpenReader(pk, bytes.NewReader(sig[:SignatureSize-1]), opts)
+	if _, err = io.ReadAll(r); err == nil {
+		t.Errorf("OpenReader() accepted a truncated stream")
+	}
+}
@@ -0,0 +1,68 @@
+// memory.go - In-memory transparency log
+
+package transparency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/internal/merkle"
+)
+
+// MemoryLog is a Log kept in memory, for tests and small deployments.  Each
+// submission signs a new tree head.  It is safe for concurrent use.
+type MemoryLog struct {
+	mu sync.Mutex
+
+	key     [sphincs256.PrivateKeySize]byte
+	now     func() time.Time
+	entries []*Entry
+	leaves  [][HashSize]byte
+}
+
+// NewMemoryLog returns an empty log that signs tree heads with privateKey.
+func NewMemoryLog(privateKey *[sphincs256.PrivateKeySize]byte) *MemoryLog {
+	l := &MemoryLog{now: time.Now}
+	copy(l.key[:], privateKey[:])
+	return l
+}
+
+// Submit implements Log.
+func (l *MemoryLog) Submit(ctx context.Context, entry *Entry) (*Proof, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := *entry
+	e.Metadata = append([]byte{}, entry.Metadata...)
+	l.entries = append(l.entries, &e)
+	l.leaves = append(l.leaves, e.LeafHash())
+
+	index := len(l.leaves) - 1
+	root, path := merkle.AuditPath(l.leaves, index)
+	return &Proof{
+		Index:    uint64(index),
+		Path:     path,
+		TreeHead: SignTreeHead(&l.key, uint64(len(l.leaves)), &root, l.now()),
+	}, nil
+}
+
+// Entries returns the entries logged with the key with keyHash, so that
+// the key's owner can check every use of it.
+func (l *MemoryLog) Entries(keyHash *[HashSize]byte) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var out []Entry
+	for _, e := range l.entries {
+		if e.KeyHash == *keyHash {
+			out = append(out, *e)
+		}
+	}
+	return out
+}
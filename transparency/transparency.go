@@ -0,0 +1,173 @@
+// transparency.go - Signature transparency log hooks
+
+// Package transparency submits SPHINCS-256 signatures to an external,
+// append only transparency log, and checks at verification time that a
+// signature was logged, so that key owners monitoring the log can detect
+// covert use of their keys.
+//
+// Log entries record hashes rather than the signed data.  The log is an
+// RFC 9162 style Merkle tree, and inclusion proofs are checked against a
+// tree head signed by the log's SPHINCS-256 key.
+package transparency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/internal/merkle"
+)
+
+// HashSize is the length of entry and Merkle tree hashes in bytes.
+const HashSize = merkle.Size
+
+const (
+	entryLabel    = "sphincs256 transparency entry v1\x00"
+	treeHeadLabel = "sphincs256 transparency tree head v1\x00"
+)
+
+// ErrNotLogged is the error returned when a signature has no valid
+// inclusion proof.
+var ErrNotLogged = errors.New("transparency: signature is not proven to be logged")
+
+// Entry is a log entry for a signature.
+type Entry struct {
+	// KeyHash, MessageHash and SignatureHash are SHA-256 of the public
+	// key, the message and the signature.
+	KeyHash       [HashSize]byte
+	MessageHash   [HashSize]byte
+	SignatureHash [HashSize]byte
+
+	// Metadata is opaque data describing the signature, such as the
+	// requesting service.  It is logged in the clear.
+	Metadata []byte
+}
+
+// NewEntry returns the log entry for signature of message by publicKey.
+func NewEntry(publicKey *[sphincs256.PublicKeySize]byte, message []byte, signature *[sphincs256.SignatureSize]byte, metadata []byte) *Entry {
+	return &Entry{
+		KeyHash:       sha256.Sum256(publicKey[:]),
+		MessageHash:   sha256.Sum256(message),
+		SignatureHash: sha256.Sum256(signature[:]),
+		Metadata:      append([]byte{}, metadata...),
+	}
+}
+
+// MarshalBinary encodes the entry as the label, the three hashes, and the
+// metadata prefixed by its 32 bit big endian length.
+func (e *Entry) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, len(entryLabel)+3*HashSize+4+len(e.Metadata))
+	b = append(b, entryLabel...)
+	b = append(b, e.KeyHash[:]...)
+	b = append(b, e.MessageHash[:]...)
+	b = append(b, e.SignatureHash[:]...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(e.Metadata)))
+	return append(b, e.Metadata...), nil
+}
+
+// LeafHash returns the Merkle tree leaf hash of the entry.
+func (e *Entry) LeafHash() [HashSize]byte {
+	b, _ := e.MarshalBinary()
+	return merkle.LeafHash(b)
+}
+
+// TreeHead is a signed statement of the size and root of the log.
+type TreeHead struct {
+	Size      uint64
+	Root      [HashSize]byte
+	Timestamp time.Time
+	Signature *[sphincs256.SignatureSize]byte
+}
+
+// SignTreeHead returns the tree head for size and root at timestamp (with
+// one second resolution), signed with the log's privateKey.
+func SignTreeHead(privateKey *[sphincs256.PrivateKeySize]byte, size uint64, root *[HashSize]byte, timestamp time.Time) *TreeHead {
+	th := &TreeHead{Size: size, Root: *root, Timestamp: time.Unix(timestamp.Unix(), 0)}
+	th.Signature = sphincs256.Sign(privateKey, th.signedMessage())
+	return th
+}
+
+func (th *TreeHead) signedMessage() []byte {
+	m := []byte(treeHeadLabel)
+	m = binary.BigEndian.AppendUint64(m, th.Size)
+	m = binary.BigEndian.AppendUint64(m, uint64(th.Timestamp.Unix()))
+	return append(m, th.Root[:]...)
+}
+
+// Verify returns nil if the tree head is signed by the log with publicKey.
+func (th *TreeHead) Verify(publicKey *[sphincs256.PublicKeySize]byte) error {
+	if th.Signature == nil {
+		return errors.New("transparency: tree head is not signed")
+	}
+	if err := sphincs256.VerifyWithOptions(publicKey, th.signedMessage(), th.Signature, nil); err != nil {
+		return fmt.Errorf("transparency: invalid tree head signature: %w", err)
+	}
+	return nil
+}
+
+// Proof is a proof that an entry is included in the log.
+type Proof struct {
+	// Index is the position of the entry in the log.
+	Index uint64
+
+	// Path is the audit path of the entry, leaf to root.
+	Path [][HashSize]byte
+
+	// TreeHead is a tree head that includes the entry.
+	TreeHead *TreeHead
+}
+
+// Log is a transparency log.
+type Log interface {
+	// Submit appends entry to the log, and returns a proof of its
+	// inclusion.
+	Submit(ctx context.Context, entry *Entry) (*Proof, error)
+}
+
+// Submit submits signature of message by publicKey, produced elsewhere,
+// to log.
+func Submit(ctx context.Context, log Log, publicKey *[sphincs256.PublicKeySize]byte, message []byte, signature *[sphincs256.SignatureSize]byte, metadata []byte) (*Proof, error) {
+	proof, err := log.Submit(ctx, NewEntry(publicKey, message, signature, metadata))
+	if err != nil {
+		return nil, fmt.Errorf("transparency: failed to submit signature: %w", err)
+	}
+	return proof, nil
+}
+
+// Sign signs message with privateKey, and submits the signature to log.
+// The signature is only returned once it has been logged.
+func Sign(ctx context.Context, log Log, privateKey *[sphincs256.PrivateKeySize]byte, message, metadata []byte) (*[sphincs256.SignatureSize]byte, *Proof, error) {
+	pk := (*sphincs256.PrivateKey)(privateKey).Public().(*sphincs256.PublicKey)
+	sig := sphincs256.Sign(privateKey, message)
+	proof, err := Submit(ctx, log, (*[sphincs256.PublicKeySize]byte)(pk), message, sig, metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sig, proof, nil
+}
+
+// Verify returns nil if signature is a valid signature of message by
+// publicKey, and proof shows that it was logged with metadata in the log
+// with logKey.
+func Verify(publicKey *[sphincs256.PublicKeySize]byte, message []byte, signature *[sphincs256.SignatureSize]byte, metadata []byte, proof *Proof, logKey *[sphincs256.PublicKeySize]byte) error {
+	if err := sphincs256.VerifyWithOptions(publicKey, message, signature, nil); err != nil {
+		return err
+	}
+	if proof == nil || proof.TreeHead == nil {
+		return ErrNotLogged
+	}
+	if err := proof.TreeHead.Verify(logKey); err != nil {
+		return err
+	}
+
+	leaf := NewEntry(publicKey, message, signature, metadata).LeafHash()
+	root, ok := merkle.RootFromPath(&leaf, proof.Index, proof.TreeHead.Size, proof.Path)
+	if !ok || root != proof.TreeHead.Root {
+		return ErrNotLogged
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// transparency_test.go - Signature transparency log tests
+
+package transparency
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/yawning/sphincs256"
+)
+
+func TestTransparency(t *testing.T) {
+	pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	logPk, logSk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	log := NewMemoryLog(logSk)
+	ctx := context.Background()
+
+	// A signature made elsewhere, and one made and logged together.
+	other := []byte("release 1.0")
+	otherSig := sphincs256.Sign(sk, other)
+	if _, err = Submit(ctx, log, pk, other, otherSig, nil); err != nil {
+		t.Fatalf("Submit() failed: %v", err)
+	}
+	msg, meta := []byte("release 1.1"), []byte("ci pipeline 42")
+	sig, proof, err := Sign(ctx, log, sk, msg, meta)
+	if err != nil {
+		t.Fatalf("Sign() failed: %v", err)
+	}
+
+	if err = Verify(pk, msg, sig, meta, proof, logPk); err != nil {
+		t.Fatalf("Verify() failed: %v", err)
+	}
+	if err = Verify(pk, msg, sig, []byte("other metadata"), proof, logPk); !errors.Is(err, ErrNotLogged) {
+		t.Errorf("Verify() with the wrong metadata: got %v", err)
+	}
+	if err = Verify(pk, other, otherSig, nil, proof, logPk); !errors.Is(err, ErrNotLogged) {
+		t.Errorf("Verify() with another entry's proof: got %v", err)
+	}
+	if err = Verify(pk, msg, sig, meta, nil, logPk); !errors.Is(err, ErrNotLogged) {
+		t.Errorf("Verify() without a proof: got %v", err)
+	}
+	if err = Verify(pk, msg, sig, meta, proof, pk); err == nil {
+		t.Errorf("Verify() accepted a tree head signed by the wrong key")
+	}
+
+	// The key owner sees both uses of the key.
+	kh := sha256.Sum256(pk[:])
+	if n := len(log.Entries(&kh)); n != 2 {
+		t.Errorf("Entries() returned %d entries, expected 2", n)
+	}
+}
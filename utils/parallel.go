@@ -0,0 +1,32 @@
+// parallel.go - Concurrency helpers
+
+package utils
+
+import "sync"
+
+// ParallelFor calls fn(i) for each 0 <= i < n, spread over up to workers
+// goroutines, and returns once all calls have completed.  If workers <= 1,
+// the calls are made in order on the calling goroutine.
+func ParallelFor(workers, n int, fn func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for j := 0; j < workers; j++ {
+		go func(j int) {
+			defer wg.Done()
+			for i := j; i < n; i += workers {
+				fn(i)
+			}
+		}(j)
+	}
+	wg.Wait()
+}
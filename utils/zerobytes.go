@@ -11,3 +11,13 @@ func Zerobytes(r []byte) []byte {
 	}
 	return r
 }
+
+// ConstantTimeIsZero returns true iff all the bytes in slice are 0x00.  The
+// time taken is independent of the contents of the slice.
+func ConstantTimeIsZero(r []byte) bool {
+	var v byte
+	for i := 0; i < len(r); i++ {
+		v |= r[i]
+	}
+	return v == 0
+}
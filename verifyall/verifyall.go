@@ -0,0 +1,236 @@
+// verifyall.go - Bulk artifact verification
+
+// Package verifyall verifies every artifact listed in a manifest against
+// its signature and pinned signing key, concurrently, and produces a
+// machine readable report, for release audit jobs that validate entire
+// artifact repositories.  The cmd/sphincs256-verifyall command runs it from
+// the command line.
+//
+// A manifest is JSON:
+//
+//	{"items": [{"artifact": "dist/app.tar.gz", "signature": "dist/app.tar.gz.sig", "key": "keys/release.pub", "fingerprint": "9f86d0..."}]}
+//
+// Paths are slash separated and relative to the root the manifest is
+// verified against.  Signatures are raw, and keys PEM encoded or raw.
+// Since the keys are read from the same tree as the artifacts, each item
+// pins the lowercase hex bundle.Fingerprint of its key, and an item whose
+// key does not match fails.
+package verifyall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"runtime"
+	"sync"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/bundle"
+)
+
+// Status is the outcome of verifying an item.
+type Status string
+
+const (
+	// Pass means that the signature is valid.
+	Pass Status = "pass"
+
+	// Fail means that the signature is invalid.
+	Fail Status = "fail"
+
+	// Error means that the item could not be verified, for instance
+	// because a file is missing.
+	Error Status = "error"
+)
+
+// Item is a manifest entry.
+type Item struct {
+	Artifact  string `json:"artifact"`
+	Signature string `json:"signature"`
+	Key       string `json:"key"`
+
+	// Fingerprint is the lowercase hex bundle.Fingerprint of the key.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// Manifest is a list of items to verify.
+type Manifest struct {
+	Items []Item `json:"items"`
+}
+
+// ParseManifest reads a JSON manifest from r.
+func ParseManifest(r io.Reader) (*Manifest, error) {
+	m := new(Manifest)
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	if err := d.Decode(m); err != nil {
+		return nil, fmt.Errorf("verifyall: invalid manifest: %v", err)
+	}
+	return m, nil
+}
+
+// Result is the outcome for one item.
+type Result struct {
+	Item
+	Status Status `json:"status"`
+
+	// Reason explains a Fail or Error status.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Report is the outcome for a manifest.
+type Report struct {
+	Total  int `json:"total"`
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+	Errors int `json:"errors"`
+
+	// Results are in manifest order.
+	Results []Result `json:"results"`
+}
+
+// OK returns true iff every item passed.
+func (r *Report) OK() bool {
+	return r.Passed == r.Total
+}
+
+// Options are the options for Run.
+type Options struct {
+	// Concurrency is the number of concurrent verifications, GOMAXPROCS by
+	// default.
+	Concurrency int
+}
+
+// Run verifies every item of m, with paths relative to fsys.  If ctx is
+// done, the remaining items are reported as errors.  A nil opts is
+// equivalent to the zero value.
+func Run(ctx context.Context, fsys fs.FS, m *Manifest, opts *Options) *Report {
+	n := 0
+	if opts != nil {
+		n = opts.Concurrency
+	}
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+
+	r := &Report{Total: len(m.Items), Results: make([]Result, len(m.Items))}
+	keys := &keyCache{fsys: fsys, keys: make(map[string]*keyEntry)}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				r.Results[i] = verifyItem(ctx, fsys, keys, &m.Items[i])
+			}
+		}()
+	}
+	for i := range m.Items {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, res := range r.Results {
+		switch res.Status {
+		case Pass:
+			r.Passed++
+		case Fail:
+			r.Failed++
+		default:
+			r.Errors++
+		}
+	}
+	return r
+}
+
+func verifyItem(ctx context.Context, fsys fs.FS, keys *keyCache, it *Item) Result {
+	res := Result{Item: *it, Status: Error}
+	if err := ctx.Err(); err != nil {
+		res.Reason = err.Error()
+		return res
+	}
+
+	if it.Fingerprint == "" {
+		res.Reason = "key: no fingerprint pinned"
+		return res
+	}
+	pk, err := keys.get(it.Key)
+	if err != nil {
+		res.Reason = fmt.Sprintf("key: %v", err)
+		return res
+	}
+	if bundle.FingerprintHex(pk) != it.Fingerprint {
+		res.Status, res.Reason = Fail, "key: fingerprint mismatch"
+		return res
+	}
+	sig, err := fs.ReadFile(fsys, it.Signature)
+	if err != nil {
+		res.Reason = fmt.Sprintf("signature: %v", err)
+		return res
+	}
+	if len(sig) != sphincs256.SignatureSize {
+		res.Status, res.Reason = Fail, fmt.Sprintf("signature: invalid length %d", len(sig))
+		return res
+	}
+	f, err := fsys.Open(it.Artifact)
+	if err != nil {
+		res.Reason = fmt.Sprintf("artifact: %v", err)
+		return res
+	}
+	defer f.Close()
+
+	err = sphincs256.VerifyReader(pk, f, (*[sphincs256.SignatureSize]byte)(sig))
+	switch {
+	case err == nil:
+		res.Status = Pass
+	case errors.Is(err, sphincs256.ErrVerifyFailed):
+		res.Status, res.Reason = Fail, err.Error()
+	default:
+		res.Reason = fmt.Sprintf("artifact: %v", err)
+	}
+	return res
+}
+
+// keyCache loads each key file once.
+type keyCache struct {
+	fsys fs.FS
+
+	mu   sync.Mutex
+	keys map[string]*keyEntry
+}
+
+type keyEntry struct {
+	once sync.Once
+	key  *[sphincs256.PublicKeySize]byte
+	err  error
+}
+
+func (c *keyCache) get(p string) (*[sphincs256.PublicKeySize]byte, error) {
+	c.mu.Lock()
+	e := c.keys[p]
+	if e == nil {
+		e = new(keyEntry)
+		c.keys[p] = e
+	}
+	c.mu.Unlock()
+
+	e.once.Do(func() {
+		var b []byte
+		if b, e.err = fs.ReadFile(c.fsys, p); e.err != nil {
+			return
+		}
+		var pk *sphincs256.PublicKey
+		if len(b) == sphincs256.PublicKeySize {
+			pk, e.err = sphincs256.ParsePublicKey(b)
+		} else {
+			pk, e.err = sphincs256.ParsePublicKeyPEM(b)
+		}
+		e.key = (*[sphincs256.PublicKeySize]byte)(pk)
+	})
+	return e.key, e.err
+}
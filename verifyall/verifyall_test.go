@@ -0,0 +1,74 @@
+// verifyall_test.go - Bulk artifact verification tests
+
+package verifyall
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/yawning/sphincs256"
+	"github.com/yawning/sphincs256/bundle"
+)
+
+func TestRun(t *testing.T) {
+	pk, sk, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	otherPk, _, err := sphincs256.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+
+	fsys := fstest.MapFS{
+		"a.bin":        {Data: []byte("artifact a")},
+		"b.bin":        {Data: []byte("artifact b")},
+		"a.sig":        {Data: sphincs256.Sign(sk, []byte("artifact a"))[:]},
+		"b.sig":        {Data: sphincs256.Sign(sk, []byte("something else"))[:]},
+		"release.pub":  {Data: (*sphincs256.PublicKey)(pk).MarshalPEM()},
+		"other.pub":    {Data: otherPk[:]},
+		"truncated.pb": {Data: pk[:10]},
+	}
+	m, err := ParseManifest(strings.NewReader(fmt.Sprintf(`{"items": [
+		{"artifact": "a.bin", "signature": "a.sig", "key": "release.pub", "fingerprint": "%[1]s"},
+		{"artifact": "b.bin", "signature": "b.sig", "key": "release.pub", "fingerprint": "%[1]s"},
+		{"artifact": "a.bin", "signature": "a.sig", "key": "other.pub", "fingerprint": "%[2]s"},
+		{"artifact": "a.bin", "signature": "a.sig", "key": "other.pub", "fingerprint": "%[1]s"},
+		{"artifact": "missing.bin", "signature": "a.sig", "key": "release.pub", "fingerprint": "%[1]s"},
+		{"artifact": "a.bin", "signature": "a.sig", "key": "truncated.pb", "fingerprint": "%[1]s"},
+		{"artifact": "a.bin", "signature": "a.sig", "key": "release.pub"}
+	]}`, bundle.FingerprintHex(pk), bundle.FingerprintHex(otherPk))))
+	if err != nil {
+		t.Fatalf("ParseManifest() failed: %v", err)
+	}
+
+	r := Run(context.Background(), fsys, m, &Options{Concurrency: 3})
+	expected := []Status{Pass, Fail, Fail, Fail, Error, Error, Error}
+	for i, res := range r.Results {
+		if res.Status != expected[i] {
+			t.Errorf("item %d: got %s (%s), expected %s", i, res.Status, res.Reason, expected[i])
+		}
+		if res.Status != Pass && res.Reason == "" {
+			t.Errorf("item %d: no reason given", i)
+		}
+	}
+	if r.Results[3].Reason != "key: fingerprint mismatch" {
+		t.Errorf("item 3: unexpected reason %q", r.Results[3].Reason)
+	}
+	if r.Total != 7 || r.Passed != 1 || r.Failed != 3 || r.Errors != 3 || r.OK() {
+		t.Errorf("report totals: %+v", r)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if r = Run(ctx, fsys, m, nil); r.Errors != r.Total {
+		t.Errorf("Run() with a cancelled context: %+v", r)
+	}
+	if _, err = ParseManifest(strings.NewReader(`{"itemz": []}`)); err == nil {
+		t.Errorf("ParseManifest() accepted an unknown field")
+	}
+}
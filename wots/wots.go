@@ -3,8 +3,11 @@
 package wots
 
 import (
+	"bytes"
+
 	"github.com/yawning/sphincs256/chacha"
 	"github.com/yawning/sphincs256/hash"
+	"github.com/yawning/sphincs256/utils"
 )
 
 const (
@@ -96,7 +99,10 @@ func Sign(sig []byte, msg *[hash.Size]byte, sk *[SeedBytes]byte, masks []byte) {
 	}
 }
 
-func Verify(pk *[L * hash.Size]byte, sig []byte, msg *[hash.Size]byte, masks []byte) {
+// Verify computes the WOTS public key pk from the signature sig of msg.  It
+// returns the index of the first malformed chain value in sig (see
+// Malformed), or -1 if there is none.
+func Verify(pk *[L * hash.Size]byte, sig []byte, msg *[hash.Size]byte, masks []byte) int {
 //	sig = sig[:L*hash.Size]
 //	masks = masks[:(W-1)*hash.Size]
 
@@ -140,4 +146,26 @@ func Verify(pk *[L * hash.Size]byte, sig []byte, msg *[hash.Size]byte, masks []b
 	default:
 		panic("not yet implemented")
 	}
+
+	return Malformed(sig)
+}
+
+// Malformed returns the index of the first chain value in the signature sig
+// that is all zero or equal to an earlier one, or -1 if there is none.  Every
+// chain starts from an independent secret, so an honest signer produces such
+// values only with negligible probability, while zero filled or duplicated
+// blocks are common forms of corruption in transit.
+func Malformed(sig []byte) int {
+	for i := 0; i < L; i++ {
+		v := sig[i*hash.Size : (i+1)*hash.Size]
+		if utils.ConstantTimeIsZero(v) {
+			return i
+		}
+		for j := 0; j < i; j++ {
+			if bytes.Equal(v, sig[j*hash.Size:(j+1)*hash.Size]) {
+				return i
+			}
+		}
+	}
+	return -1
 }